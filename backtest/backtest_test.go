@@ -0,0 +1,133 @@
+package backtest_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/backtest"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+var t0 = time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+
+func at(ms int) time.Time {
+	return t0.Add(time.Duration(ms) * time.Millisecond)
+}
+
+func book(bid, ask float64) ws.L2Msg {
+	return ws.L2Msg{
+		Event:  "snapshot",
+		Symbol: "BTC-USD",
+		Bids:   []ws.Level{{Px: bid, Qty: 1, Num: 1}},
+		Asks:   []ws.Level{{Px: ask, Qty: 1, Num: 1}},
+	}
+}
+
+// roundTrip buys at market on the first book and sells at market on the first report of the fill
+type roundTrip struct {
+	backtest.BaseStrategy
+	sent    bool
+	sold    bool
+	reports []time.Time
+}
+
+func (s *roundTrip) OnBook(ctx *backtest.Context, msg ws.L2Msg) {
+	if !s.sent {
+		s.sent = true
+		ctx.PlaceOrder(model.OrderRequest{Symbol: msg.Symbol, Side: model.BUY, Type: model.MARKET, Qty: 1})
+	}
+}
+
+func (s *roundTrip) OnReport(ctx *backtest.Context, msg ws.TradingMsg) {
+	s.reports = append(s.reports, ctx.Now())
+	if update := msg.(*ws.TradingUpdated); update.LastShares > 0 && !s.sold {
+		s.sold = true
+		ctx.PlaceOrder(model.OrderRequest{Symbol: update.Symbol, Side: model.SELL, Type: model.MARKET, Qty: 1})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	strategy := &roundTrip{}
+	engine := backtest.New(strategy, backtest.Config{
+		Fees:          rest.Fees{TakerRate: 0.01},
+		Latency:       10 * time.Millisecond,
+		ReportLatency: 5 * time.Millisecond,
+	})
+	report, err := engine.Run(backtest.Events(
+		backtest.Event{Time: at(0), Msg: book(99, 101)},
+		// the book moves before the order arrives
+		backtest.Event{Time: at(5), Msg: book(109, 111)},
+		backtest.Event{Time: at(30), Msg: book(89, 91)},
+	))
+	require.NoError(t, err)
+
+	// bought at 111 at 10ms, reported at 15ms, sold at 109 at 25ms
+	require.Equal(t, []time.Time{at(15), at(15), at(30), at(30)}, strategy.reports[:4])
+	require.Equal(t, 2, report.Fills)
+	require.Equal(t, 2, report.Orders)
+	require.Equal(t, 1.0, report.FillRatio)
+	require.InDelta(t, 220, report.Turnover, 1e-9)
+	require.InDelta(t, 2.2, report.Fees, 1e-9)
+	require.InDelta(t, -4.2, report.PnL, 1e-9)
+	require.Zero(t, report.Positions["BTC-USD"])
+	require.Equal(t, at(0), report.Start)
+}
+
+func TestDrawdown(t *testing.T) {
+	strategy := &roundTrip{sold: true}
+	engine := backtest.New(strategy, backtest.Config{})
+	report, err := engine.Run(backtest.Events(
+		backtest.Event{Time: at(0), Msg: book(99, 101)},
+		backtest.Event{Time: at(1), Msg: ws.TradesMsg{Symbol: "BTC-USD", Side: "buy", Qty: 1, Price: 111}},
+		backtest.Event{Time: at(2), Msg: ws.TradesMsg{Symbol: "BTC-USD", Side: "sell", Qty: 1, Price: 95}},
+		backtest.Event{Time: at(3), Msg: ws.TradesMsg{Symbol: "BTC-USD", Side: "buy", Qty: 1, Price: 105}},
+	))
+	require.NoError(t, err)
+	require.Equal(t, 1.0, report.Positions["BTC-USD"])
+	require.InDelta(t, 4, report.PnL, 1e-9)
+	require.InDelta(t, 16, report.MaxDrawdown, 1e-9)
+	require.Len(t, report.Curve, 4)
+	require.InDelta(t, 10, report.Curve[1].PnL, 1e-9)
+}
+
+type frames []ws.Frame
+
+func (f *frames) Next() (ws.Frame, error) {
+	if len(*f) == 0 {
+		return ws.Frame{}, io.EOF
+	}
+	frame := (*f)[0]
+	*f = (*f)[1:]
+	return frame, nil
+}
+
+type counter struct {
+	backtest.BaseStrategy
+	books, trades, prices int
+}
+
+func (c *counter) OnBook(*backtest.Context, ws.L2Msg)       { c.books++ }
+func (c *counter) OnTrade(*backtest.Context, ws.TradesMsg)  { c.trades++ }
+func (c *counter) OnPrices(*backtest.Context, ws.PricesMsg) { c.prices++ }
+
+func TestFrames(t *testing.T) {
+	source := frames{
+		ws.NewFrame([]byte(`{"seqnum":1,"event":"subscribed","channel":"l2","symbol":"BTC-USD"}`), at(0)),
+		ws.NewFrame([]byte(`{"seqnum":2,"event":"snapshot","channel":"l2","symbol":"BTC-USD","bids":[{"px":99,"qty":1,"num":1}],"asks":[]}`), at(1)),
+		ws.NewFrame([]byte(`{"seqnum":3,"event":"updated","channel":"trades","symbol":"BTC-USD","side":"buy","qty":1,"price":99}`), at(2)),
+		ws.NewFrame([]byte(`{"seqnum":4,"event":"updated","channel":"prices","symbol":"BTC-USD","price":[1,2,3,4,5,6]}`), at(3)),
+		ws.NewFrame([]byte(`{"seqnum":5,"event":"updated","channel":"heartbeat"}`), at(4)),
+	}
+	strategy := &counter{}
+	report, err := backtest.New(strategy, backtest.Config{}).Run(backtest.Frames(&source))
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Events)
+	require.Equal(t, 1, strategy.books)
+	require.Equal(t, 1, strategy.trades)
+	require.Equal(t, 1, strategy.prices)
+}
@@ -0,0 +1,315 @@
+// Package backtest runs a strategy against recorded market data on a
+// simulated clock, matching its orders with the paper trading exchange.
+package backtest
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/paper"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// Event is a market data message and the time it was received. Msg is one of
+// ws.L2Msg, ws.L3Msg, ws.TradesMsg, ws.TickerMsg or ws.PricesMsg.
+type Event struct {
+	Time time.Time
+	Msg  interface{}
+}
+
+// Source provides the events of a backtest in time order, io.EOF at the end
+type Source interface {
+	Next() (Event, error)
+}
+
+type frameSource struct {
+	frames ws.FrameSource
+}
+
+// Frames returns a source decoding the market data frames of a recording,
+// e.g. a record.Reader. Frames of other channels are skipped.
+func Frames(frames ws.FrameSource) Source {
+	return &frameSource{frames}
+}
+
+func (s *frameSource) Next() (Event, error) {
+	for {
+		frame, err := s.frames.Next()
+		if err != nil {
+			return Event{}, err
+		}
+		msg, err := frame.MarketData()
+		if err != nil {
+			return Event{}, fmt.Errorf("decoding %s frame at %s: %w", frame.Channel, frame.Time, err)
+		}
+		if msg != nil {
+			return Event{Time: frame.Time, Msg: msg}, nil
+		}
+	}
+}
+
+type sliceSource struct {
+	events []Event
+}
+
+// Events returns a source replaying the given events
+func Events(events ...Event) Source {
+	return &sliceSource{events}
+}
+
+func (s *sliceSource) Next() (Event, error) {
+	if len(s.events) == 0 {
+		return Event{}, io.EOF
+	}
+	event := s.events[0]
+	s.events = s.events[1:]
+	return event, nil
+}
+
+// Config of a backtest
+type Config struct {
+	// Fees applied by the simulated exchange
+	Fees rest.Fees
+	// Latency between a strategy sending an order or cancel and the exchange processing it
+	Latency time.Duration
+	// ReportLatency between the exchange executing an order and the strategy receiving the report
+	ReportLatency time.Duration
+	// QueueAhead returns the quantity assumed ahead of an order joining a price
+	// level holding levelQty, the whole level when nil. See paper.Config.
+	QueueAhead func(levelQty float64) float64
+	// SampleInterval is the minimum time between two points of the PnL curve,
+	// a point per event when zero
+	SampleInterval time.Duration
+}
+
+// action is work scheduled on the simulated clock
+type action struct {
+	due time.Time
+	seq int
+	run func()
+}
+
+type actionQueue []action
+
+func (q actionQueue) Len() int { return len(q) }
+func (q actionQueue) Less(i, j int) bool {
+	if !q[i].due.Equal(q[j].due) {
+		return q[i].due.Before(q[j].due)
+	}
+	return q[i].seq < q[j].seq
+}
+func (q actionQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *actionQueue) Push(x interface{}) { *q = append(*q, x.(action)) }
+func (q *actionQueue) Pop() interface{} {
+	old := *q
+	a := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return a
+}
+
+// Engine runs one backtest. It is not safe for concurrent use.
+type Engine struct {
+	cfg      Config
+	strategy Strategy
+	ctx      *Context
+	exchange *paper.Exchange
+
+	now     time.Time
+	actions actionQueue
+	nextSeq int
+
+	nextClOrdID int
+	fillsSeen   int
+	positions   map[string]float64
+	marks       map[string]float64
+	cash        float64
+
+	peak       float64
+	lastSample time.Time
+	report     Report
+}
+
+// New returns an engine running strategy with the given configuration
+func New(strategy Strategy, cfg Config) *Engine {
+	e := &Engine{
+		cfg:       cfg,
+		strategy:  strategy,
+		positions: make(map[string]float64),
+		marks:     make(map[string]float64),
+	}
+	e.ctx = &Context{e}
+	e.exchange = paper.NewExchange(paper.Config{
+		Fees:       cfg.Fees,
+		Now:        func() time.Time { return e.now },
+		OnReport:   e.onReport,
+		QueueAhead: cfg.QueueAhead,
+	})
+	return e
+}
+
+// Run feeds every event of source to the exchange and the strategy, then
+// processes the actions still in flight and returns the report
+func (e *Engine) Run(source Source) (*Report, error) {
+	for {
+		event, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if event.Time.Before(e.now) {
+			return nil, fmt.Errorf("event at %s is before the simulated time %s", event.Time, e.now)
+		}
+		e.advance(event.Time)
+		if e.report.Events == 0 {
+			e.report.Start = event.Time
+		}
+		e.report.Events++
+		e.dispatch(event)
+		e.advance(event.Time)
+		e.sample(false)
+	}
+	for e.actions.Len() > 0 {
+		e.advance(e.actions[0].due)
+	}
+	e.report.End = e.now
+	e.sample(true)
+	return e.finish(), nil
+}
+
+// advance runs the actions due up to t in order, moving the clock along
+func (e *Engine) advance(t time.Time) {
+	for e.actions.Len() > 0 && !e.actions[0].due.After(t) {
+		a := heap.Pop(&e.actions).(action)
+		e.now = a.due
+		a.run()
+		e.account()
+	}
+	e.now = t
+}
+
+func (e *Engine) schedule(due time.Time, run func()) {
+	e.nextSeq++
+	heap.Push(&e.actions, action{due, e.nextSeq, run})
+}
+
+func (e *Engine) dispatch(event Event) {
+	switch msg := event.Msg.(type) {
+	case ws.L2Msg:
+		e.exchange.OnL2(msg)
+		e.markBook(msg.Symbol)
+		e.account()
+		e.strategy.OnBook(e.ctx, msg)
+	case ws.L3Msg:
+		e.exchange.OnL3(msg)
+		e.markBook(msg.Symbol)
+		e.account()
+	case ws.TradesMsg:
+		e.marks[msg.Symbol] = msg.Price
+		e.exchange.OnTrade(msg)
+		e.account()
+		e.strategy.OnTrade(e.ctx, msg)
+	case ws.TickerMsg:
+		if msg.LastTradePrice > 0 {
+			e.marks[msg.Symbol] = msg.LastTradePrice
+		}
+		e.exchange.Advance()
+		e.account()
+		e.strategy.OnTicker(e.ctx, msg)
+	case ws.PricesMsg:
+		e.exchange.Advance()
+		e.account()
+		e.strategy.OnPrices(e.ctx, msg)
+	}
+}
+
+// markBook marks symbol at the mid of its book
+func (e *Engine) markBook(symbol string) {
+	if mid, ok := e.exchange.Book(symbol).Mid(); ok {
+		e.marks[symbol] = mid
+	}
+}
+
+// onReport receives the execution reports of the exchange and delivers them
+// to the strategy after the report latency
+func (e *Engine) onReport(msg ws.TradingMsg) {
+	if update, ok := msg.(*ws.TradingUpdated); ok && update.OrdStatus == string(ws.ORDER_STATUS_REJECTED) {
+		e.report.Rejected++
+	}
+	e.schedule(e.now.Add(e.cfg.ReportLatency), func() {
+		e.strategy.OnReport(e.ctx, msg)
+	})
+}
+
+// account books the executions the exchange made since the last call
+func (e *Engine) account() {
+	fills := e.exchange.FillsFrom(e.fillsSeen)
+	e.fillsSeen += len(fills)
+	for _, fill := range fills {
+		qty := fill.Qty
+		if fill.Side == model.SELL {
+			qty = -qty
+		}
+		e.positions[fill.Symbol] += qty
+		e.cash -= qty*fill.Price + fill.Fee
+		if _, ok := e.marks[fill.Symbol]; !ok {
+			e.marks[fill.Symbol] = fill.Price
+		}
+		e.report.Fills++
+		e.report.FilledQty += fill.Qty
+		e.report.Turnover += fill.Qty * fill.Price
+		e.report.Fees += fill.Fee
+	}
+}
+
+// pnl returns the cash plus the positions marked to market
+func (e *Engine) pnl() float64 {
+	pnl := e.cash
+	for symbol, qty := range e.positions {
+		pnl += qty * e.marks[symbol]
+	}
+	return pnl
+}
+
+// sample adds a point to the PnL curve and tracks the drawdown
+func (e *Engine) sample(force bool) {
+	if e.report.Events == 0 {
+		return
+	}
+	pnl := e.pnl()
+	if pnl > e.peak {
+		e.peak = pnl
+	}
+	if drawdown := e.peak - pnl; drawdown > e.report.MaxDrawdown {
+		e.report.MaxDrawdown = drawdown
+	}
+	if !force && len(e.report.Curve) > 0 && e.now.Sub(e.lastSample) < e.cfg.SampleInterval {
+		return
+	}
+	if n := len(e.report.Curve); n > 0 && e.report.Curve[n-1].Time.Equal(e.now) {
+		e.report.Curve[n-1].PnL = pnl
+		return
+	}
+	e.lastSample = e.now
+	e.report.Curve = append(e.report.Curve, PnLPoint{Time: e.now, PnL: pnl})
+}
+
+func (e *Engine) finish() *Report {
+	r := e.report
+	r.PnL = e.pnl()
+	if r.OrderedQty > 0 {
+		r.FillRatio = r.FilledQty / r.OrderedQty
+	}
+	r.Positions = make(map[string]float64, len(e.positions))
+	for symbol, qty := range e.positions {
+		r.Positions[symbol] = qty
+	}
+	orders, _ := e.exchange.OpenOrders("")
+	r.OpenOrders = len(orders)
+	return &r
+}
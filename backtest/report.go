@@ -0,0 +1,52 @@
+package backtest
+
+import (
+	"fmt"
+	"time"
+)
+
+// PnLPoint is the marked-to-market profit and loss at a point in time
+type PnLPoint struct {
+	Time time.Time
+	PnL  float64
+}
+
+// Report summarises a backtest
+type Report struct {
+	// Start and End are the times of the first event and of the last event or action
+	Start time.Time
+	End   time.Time
+	// Events is the number of market data events processed
+	Events int
+	// Orders, Cancels and Rejected count the orders and cancels the strategy
+	// sent and the orders the exchange rejected
+	Orders   int
+	Cancels  int
+	Rejected int
+	// OpenOrders is the number of orders still live at the end
+	OpenOrders int
+	// Fills is the number of executions
+	Fills int
+	// OrderedQty and FilledQty sum the quantities ordered and executed.
+	// FillRatio is FilledQty / OrderedQty.
+	OrderedQty float64
+	FilledQty  float64
+	FillRatio  float64
+	// Turnover is the notional executed, in the counter currency
+	Turnover float64
+	// Fees paid, included in PnL
+	Fees float64
+	// PnL at the end, positions marked at the latest trade, ticker or book mid price
+	PnL float64
+	// MaxDrawdown is the largest fall of the PnL from a previous peak
+	MaxDrawdown float64
+	// Positions held at the end by symbol
+	Positions map[string]float64
+	// Curve of the PnL over time, sampled every Config.SampleInterval
+	Curve []PnLPoint
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("%s - %s: pnl %.2f, max drawdown %.2f, fees %.2f, turnover %.2f, %d orders, %d fills, fill ratio %.2f%%",
+		r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339), r.PnL, r.MaxDrawdown, r.Fees, r.Turnover, r.Orders, r.Fills, r.FillRatio*100)
+}
@@ -0,0 +1,92 @@
+package backtest
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/book"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// Strategy receives the market data of a backtest as the same ws messages a
+// live connection delivers, and the execution reports of its own orders
+type Strategy interface {
+	OnBook(ctx *Context, msg ws.L2Msg)
+	OnTrade(ctx *Context, msg ws.TradesMsg)
+	OnTicker(ctx *Context, msg ws.TickerMsg)
+	OnPrices(ctx *Context, msg ws.PricesMsg)
+	OnReport(ctx *Context, msg ws.TradingMsg)
+}
+
+// BaseStrategy ignores every event. Embed it to implement only the handlers a
+// strategy needs.
+type BaseStrategy struct{}
+
+func (BaseStrategy) OnBook(*Context, ws.L2Msg)        {}
+func (BaseStrategy) OnTrade(*Context, ws.TradesMsg)   {}
+func (BaseStrategy) OnTicker(*Context, ws.TickerMsg)  {}
+func (BaseStrategy) OnPrices(*Context, ws.PricesMsg)  {}
+func (BaseStrategy) OnReport(*Context, ws.TradingMsg) {}
+
+// Context is the view of the simulation given to a strategy. Orders and
+// cancels reach the simulated exchange after Config.Latency.
+type Context struct {
+	e *Engine
+}
+
+// Now returns the simulated time
+func (c *Context) Now() time.Time {
+	return c.e.now
+}
+
+// PlaceOrder sends an order and returns its client order id, generated when
+// the request has none
+func (c *Context) PlaceOrder(request model.OrderRequest) string {
+	if request.ClOrdID == "" {
+		c.e.nextClOrdID++
+		request.ClOrdID = "bt-" + strconv.Itoa(c.e.nextClOrdID)
+	}
+	c.e.report.Orders++
+	c.e.report.OrderedQty += request.Qty
+	c.e.schedule(c.e.now.Add(c.e.cfg.Latency), func() {
+		c.e.exchange.PlaceOrder(request)
+	})
+	return request.ClOrdID
+}
+
+// CancelOrder sends a cancel for an order id received in an execution report
+func (c *Context) CancelOrder(orderID string) {
+	c.e.report.Cancels++
+	c.e.schedule(c.e.now.Add(c.e.cfg.Latency), func() {
+		c.e.exchange.CancelOrder(orderID)
+	})
+}
+
+// CancelAll sends a cancel for the live orders of symbol, of every symbol when empty
+func (c *Context) CancelAll(symbol string) {
+	c.e.schedule(c.e.now.Add(c.e.cfg.Latency), func() {
+		c.e.exchange.CancelAll(symbol)
+	})
+}
+
+// OpenOrders returns the live orders of symbol as the exchange sees them now
+func (c *Context) OpenOrders(symbol string) []model.Order {
+	orders, _ := c.e.exchange.OpenOrders(symbol)
+	return orders
+}
+
+// Book returns a copy of the simulated order book of symbol
+func (c *Context) Book(symbol string) *book.Book {
+	return c.e.exchange.Book(symbol)
+}
+
+// Position returns the net quantity held in symbol
+func (c *Context) Position(symbol string) float64 {
+	return c.e.positions[symbol]
+}
+
+// PnL returns the marked-to-market profit and loss, net of fees
+func (c *Context) PnL() float64 {
+	return c.e.pnl()
+}
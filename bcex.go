@@ -29,3 +29,11 @@ func New(apiKey, apiSecret string) *Client {
 	})
 	return &Client{api, ws, true}
 }
+
+// Trader returns a Trader placing orders over the websocket session when it is
+// connected and authenticated, and over the Rest API otherwise
+func (c *Client) Trader() Trader {
+	return NewRouter(NewWsTrader(c.Ws), NewRestTrader(c.Rest), func() bool {
+		return c.websocketOn && c.Ws.IsAuthenticated()
+	})
+}
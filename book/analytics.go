@@ -0,0 +1,221 @@
+package book
+
+import (
+	"math"
+
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// Microprice returns the mid weighted by the quantity on the opposite side
+// of the top of the book, false when one side is empty
+func (b *Book) Microprice() (float64, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk || bid.Qty+ask.Qty <= 0 {
+		return 0, false
+	}
+	return (bid.Price*ask.Qty + ask.Price*bid.Qty) / (bid.Qty + ask.Qty), true
+}
+
+// Imbalance returns (bid qty - ask qty) / (bid qty + ask qty) over the top n
+// levels of each side, between -1 (all asks) and 1 (all bids). Every level is
+// used when n is zero or less.
+func (b *Book) Imbalance(n int) float64 {
+	bids := topQty(b.bids, n)
+	asks := topQty(b.asks, n)
+	if bids+asks <= 0 {
+		return 0
+	}
+	return (bids - asks) / (bids + asks)
+}
+
+func topQty(levels []Level, n int) float64 {
+	if n <= 0 || n > len(levels) {
+		n = len(levels)
+	}
+	var qty float64
+	for _, level := range levels[:n] {
+		qty += level.Qty
+	}
+	return qty
+}
+
+// Depth returns the quantity resting on side within bps basis points of the
+// mid, zero when the book has no mid
+func (b *Book) Depth(side model.Side, bps float64) float64 {
+	mid, ok := b.Mid()
+	if !ok {
+		return 0
+	}
+	var qty float64
+	for _, level := range b.Side(side) {
+		if math.Abs(level.Price-mid)/mid*1e4 > bps {
+			break
+		}
+		qty += level.Qty
+	}
+	return qty
+}
+
+// VWAP returns the average price a taker on side pays to fill qty from the
+// book, and the quantity the book can fill, less than qty when it is too thin
+func (b *Book) VWAP(side model.Side, qty float64) (price, filled float64) {
+	return b.sweep(side, qty, 0)
+}
+
+// sweep walks the levels a taker on side consumes for qty, up to limit when set
+func (b *Book) sweep(side model.Side, qty, limit float64) (price, filled float64) {
+	var notional float64
+	for _, level := range b.Side(side.Opposite()) {
+		if filled >= qty {
+			break
+		}
+		if limit > 0 && ((side == model.BUY && level.Price > limit) || (side == model.SELL && level.Price < limit)) {
+			break
+		}
+		take := math.Min(level.Qty, qty-filled)
+		notional += take * level.Price
+		filled += take
+	}
+	if filled <= 0 {
+		return 0, 0
+	}
+	return notional / filled, filled
+}
+
+// Estimate is the expected outcome of executing an order against the book
+type Estimate struct {
+	// Filled is the quantity the book can fill immediately
+	Filled float64
+	// AvgPrice is the average execution price of the filled quantity
+	AvgPrice float64
+	// WorstPrice is the price of the last level reached
+	WorstPrice float64
+	// Slippage is the cost of the execution against the mid, in basis points,
+	// positive when the average price is worse than the mid
+	Slippage float64
+	// Impact is the move of the mid once the filled quantity is removed from
+	// the book, in basis points, positive in the direction of the order
+	Impact float64
+}
+
+// EstimateOrder returns the expected execution of a Rest order placed now.
+// Limit orders only reach the levels within their limit price.
+func (b *Book) EstimateOrder(order rest.BaseOrder) Estimate {
+	side := order.Side.ToModel()
+	var limit float64
+	if order.OrdType == rest.LIMIT || order.OrdType == rest.STOPLIMIT {
+		limit = order.Price
+	}
+	return b.estimate(side, order.OrderQty, limit)
+}
+
+// EstimateRequest returns the expected execution of a model order placed now
+func (b *Book) EstimateRequest(request model.OrderRequest) Estimate {
+	var limit float64
+	if request.Type == model.LIMIT || request.Type == model.STOP_LIMIT {
+		limit = request.Price
+	}
+	return b.estimate(request.Side, request.Qty, limit)
+}
+
+func (b *Book) estimate(side model.Side, qty, limit float64) Estimate {
+	var e Estimate
+	e.AvgPrice, e.Filled = b.sweep(side, qty, limit)
+	mid, ok := b.Mid()
+	if e.Filled <= 0 || !ok {
+		return e
+	}
+	sign := 1.0
+	if side == model.SELL {
+		sign = -1
+	}
+	e.Slippage = sign * (e.AvgPrice - mid) / mid * 1e4
+
+	after := b.Clone()
+	remaining := e.Filled
+	opposite := side.Opposite()
+	for remaining > 0 {
+		levels := after.Side(opposite)
+		if len(levels) == 0 {
+			break
+		}
+		take := math.Min(levels[0].Qty, remaining)
+		e.WorstPrice = levels[0].Price
+		after.Take(opposite, levels[0].Price, take)
+		remaining -= take
+	}
+	if newMid, ok := after.Mid(); ok {
+		e.Impact = sign * (newMid - mid) / mid * 1e4
+	} else {
+		// the order swept a side of the book: measure from the last price reached
+		e.Impact = sign * (e.WorstPrice - mid) / mid * 1e4
+	}
+	return e
+}
+
+// Metrics are the analytics of a book after an update
+type Metrics struct {
+	Symbol     string
+	Seqnum     int
+	Mid        float64
+	Spread     float64
+	Microprice float64
+	Imbalance  float64
+	BidDepth   float64
+	AskDepth   float64
+}
+
+// Analytics maintains a book from l2 messages or Rest snapshots and computes
+// its metrics after every update
+type Analytics struct {
+	Book *Book
+	// ImbalanceLevels is the number of levels of the imbalance, every level when zero
+	ImbalanceLevels int
+	// DepthBps is the distance from the mid of the depth, in basis points
+	DepthBps float64
+	// OnUpdate, when set, receives the metrics after every update
+	OnUpdate func(m Metrics)
+}
+
+// NewAnalytics returns analytics over an empty book of symbol
+func NewAnalytics(symbol string, imbalanceLevels int, depthBps float64) *Analytics {
+	return &Analytics{Book: New(symbol), ImbalanceLevels: imbalanceLevels, DepthBps: depthBps}
+}
+
+// ApplyL2 applies an l2 snapshot or update and returns the new metrics
+func (a *Analytics) ApplyL2(msg ws.L2Msg) Metrics {
+	a.Book.ApplyL2(msg)
+	return a.update()
+}
+
+// ApplyRest replaces the book with a Rest snapshot and returns the new metrics
+func (a *Analytics) ApplyRest(orderbook rest.OrderBook) Metrics {
+	a.Book.ApplyRest(orderbook)
+	return a.update()
+}
+
+// Metrics returns the metrics of the current book
+func (a *Analytics) Metrics() Metrics {
+	m := Metrics{
+		Symbol:    a.Book.Symbol,
+		Seqnum:    a.Book.Seqnum,
+		Imbalance: a.Book.Imbalance(a.ImbalanceLevels),
+		BidDepth:  a.Book.Depth(model.BUY, a.DepthBps),
+		AskDepth:  a.Book.Depth(model.SELL, a.DepthBps),
+	}
+	m.Mid, _ = a.Book.Mid()
+	m.Spread, _ = a.Book.Spread()
+	m.Microprice, _ = a.Book.Microprice()
+	return m
+}
+
+func (a *Analytics) update() Metrics {
+	m := a.Metrics()
+	if a.OnUpdate != nil {
+		a.OnUpdate(m)
+	}
+	return m
+}
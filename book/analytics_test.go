@@ -0,0 +1,78 @@
+package book
+
+import (
+	"testing"
+
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func analyticsBook() *Book {
+	return FromRest(rest.OrderBook{
+		Symbol: "BTC-USD",
+		Bids:   []rest.OrderBookEntry{{Px: 99, Qty: 3}, {Px: 98, Qty: 2}, {Px: 90, Qty: 10}},
+		Asks:   []rest.OrderBookEntry{{Px: 101, Qty: 1}, {Px: 102, Qty: 2}, {Px: 110, Qty: 10}},
+	})
+}
+
+func TestMicroprice(t *testing.T) {
+	b := analyticsBook()
+	micro, ok := b.Microprice()
+	require.True(t, ok)
+	require.Equal(t, (99*1+101*3)/4.0, micro)
+
+	require.Equal(t, (3-1)/4.0, b.Imbalance(1))
+	require.Equal(t, (15-13)/28.0, b.Imbalance(0))
+
+	// 100 bps around a mid of 100
+	require.Equal(t, 3.0, b.Depth(model.BUY, 100))
+	require.Equal(t, 5.0, b.Depth(model.BUY, 200))
+	require.Equal(t, 3.0, b.Depth(model.SELL, 200))
+}
+
+func TestVWAP(t *testing.T) {
+	b := analyticsBook()
+	price, filled := b.VWAP(model.BUY, 2)
+	require.Equal(t, 2.0, filled)
+	require.Equal(t, 101.5, price)
+
+	price, filled = b.VWAP(model.SELL, 20)
+	require.Equal(t, 15.0, filled)
+	require.InDelta(t, (99*3+98*2+90*10)/15.0, price, 1e-9)
+}
+
+func TestEstimateOrder(t *testing.T) {
+	b := analyticsBook()
+	e := b.EstimateOrder(rest.BaseOrder{Side: rest.BUY, OrdType: rest.MARKET, OrderQty: 3})
+	require.Equal(t, 3.0, e.Filled)
+	require.InDelta(t, (101+2*102)/3.0, e.AvgPrice, 1e-9)
+	require.Equal(t, 102.0, e.WorstPrice)
+	require.InDelta(t, ((101+2*102)/3.0-100)/100*1e4, e.Slippage, 1e-9)
+	// the best ask moves to 110, the mid from 100 to 104.5
+	require.InDelta(t, 450, e.Impact, 1e-9)
+
+	e = b.EstimateOrder(rest.BaseOrder{Side: rest.SELL, OrdType: rest.LIMIT, OrderQty: 10, Price: 98})
+	require.Equal(t, 5.0, e.Filled)
+	require.True(t, e.Slippage > 0)
+	require.True(t, e.Impact > 0)
+
+	e = b.EstimateRequest(model.OrderRequest{Side: model.BUY, Type: model.LIMIT, Qty: 1, Price: 100})
+	require.Zero(t, e.Filled)
+
+	// the book is left untouched
+	require.Equal(t, 1.0, b.Qty(model.SELL, 101))
+}
+
+func TestAnalytics(t *testing.T) {
+	a := NewAnalytics("BTC-USD", 1, 100)
+	var updates []Metrics
+	a.OnUpdate = func(m Metrics) { updates = append(updates, m) }
+	a.ApplyL2(ws.L2Msg{Event: "snapshot", Seqnum: 1, Bids: []ws.Level{{Px: 99, Qty: 1}}, Asks: []ws.Level{{Px: 101, Qty: 1}}})
+	m := a.ApplyL2(ws.L2Msg{Event: "updated", Seqnum: 2, Bids: []ws.Level{{Px: 99, Qty: 3}}})
+	require.Len(t, updates, 2)
+	require.Equal(t, m, updates[1])
+	require.Equal(t, Metrics{Symbol: "BTC-USD", Seqnum: 2, Mid: 100, Spread: 2, Microprice: 100.5, Imbalance: 0.5, BidDepth: 3, AskDepth: 1}, m)
+}
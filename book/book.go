@@ -0,0 +1,245 @@
+// Package book maintains a local order book from websocket l2/l3 messages or
+// Rest order book snapshots.
+package book
+
+import (
+	"sort"
+
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// Level is an aggregated price level
+type Level struct {
+	Price float64
+	Qty   float64
+	// Number of orders on the level
+	Num int
+}
+
+type l3Order struct {
+	side  model.Side
+	price float64
+	qty   float64
+}
+
+// Book is a price-aggregated order book. It is not safe for concurrent use.
+type Book struct {
+	Symbol string
+	// Seqnum of the last message applied
+	Seqnum int
+	// bids sorted by descending price, asks by ascending price
+	bids []Level
+	asks []Level
+	// l3 orders by id, when the book is fed from the l3 channel
+	l3 map[int]l3Order
+}
+
+// New returns an empty book for symbol
+func New(symbol string) *Book {
+	return &Book{Symbol: symbol}
+}
+
+// FromRest returns a book initialised from a Rest l2 or l3 snapshot
+func FromRest(orderbook rest.OrderBook) *Book {
+	b := New(orderbook.Symbol)
+	b.ApplyRest(orderbook)
+	return b
+}
+
+// Reset empties the book
+func (b *Book) Reset() {
+	b.bids = b.bids[:0]
+	b.asks = b.asks[:0]
+	b.l3 = nil
+}
+
+// ApplyRest replaces the content of the book with a Rest l2 snapshot
+func (b *Book) ApplyRest(orderbook rest.OrderBook) {
+	b.Reset()
+	for _, entry := range orderbook.Bids {
+		b.add(model.BUY, entry.Px, entry.Qty, 1)
+	}
+	for _, entry := range orderbook.Asks {
+		b.add(model.SELL, entry.Px, entry.Qty, 1)
+	}
+}
+
+// ApplyL2 applies an l2 snapshot or update. In updates a level with a zero
+// quantity is removed from the book.
+func (b *Book) ApplyL2(msg ws.L2Msg) {
+	if msg.Event == "snapshot" {
+		b.Reset()
+	}
+	b.Seqnum = msg.Seqnum
+	for _, level := range msg.Bids {
+		b.Set(model.BUY, level.Px, level.Qty, level.Num)
+	}
+	for _, level := range msg.Asks {
+		b.Set(model.SELL, level.Px, level.Qty, level.Num)
+	}
+}
+
+// ApplyL3 applies an l3 snapshot or update, aggregating individual orders by
+// price. In updates an order with a zero quantity is removed from the book.
+func (b *Book) ApplyL3(msg ws.L3Msg) {
+	if msg.Event == "snapshot" || b.l3 == nil {
+		b.Reset()
+		b.l3 = make(map[int]l3Order)
+	}
+	b.Seqnum = msg.Seqnum
+	for _, level := range msg.Bids {
+		b.applyL3Order(model.BUY, level)
+	}
+	for _, level := range msg.Asks {
+		b.applyL3Order(model.SELL, level)
+	}
+}
+
+func (b *Book) applyL3Order(side model.Side, level ws.Level) {
+	if previous, ok := b.l3[level.Num]; ok {
+		b.add(previous.side, previous.price, -previous.qty, -1)
+		delete(b.l3, level.Num)
+	}
+	if level.Qty > 0 {
+		b.l3[level.Num] = l3Order{side, level.Px, level.Qty}
+		b.add(side, level.Px, level.Qty, 1)
+	}
+}
+
+func (b *Book) levels(side model.Side) *[]Level {
+	if side == model.BUY {
+		return &b.bids
+	}
+	return &b.asks
+}
+
+// search returns the index of price in the levels of side, and whether it exists
+func (b *Book) search(side model.Side, price float64) (int, bool) {
+	levels := *b.levels(side)
+	i := sort.Search(len(levels), func(i int) bool {
+		if side == model.BUY {
+			return levels[i].Price <= price
+		}
+		return levels[i].Price >= price
+	})
+	return i, i < len(levels) && levels[i].Price == price
+}
+
+// Set replaces the quantity of a price level, removing it when qty is zero
+func (b *Book) Set(side model.Side, price, qty float64, num int) {
+	levels := b.levels(side)
+	i, found := b.search(side, price)
+	switch {
+	case qty <= 0 && found:
+		*levels = append((*levels)[:i], (*levels)[i+1:]...)
+	case qty <= 0:
+	case found:
+		(*levels)[i].Qty = qty
+		(*levels)[i].Num = num
+	default:
+		*levels = append(*levels, Level{})
+		copy((*levels)[i+1:], (*levels)[i:])
+		(*levels)[i] = Level{price, qty, num}
+	}
+}
+
+// add changes the quantity of a price level by delta
+func (b *Book) add(side model.Side, price, delta float64, num int) {
+	i, found := b.search(side, price)
+	if found {
+		level := (*b.levels(side))[i]
+		b.Set(side, price, level.Qty+delta, level.Num+num)
+	} else {
+		b.Set(side, price, delta, num)
+	}
+}
+
+// Take removes qty from the price level, e.g. after a simulated execution
+// consumed that liquidity
+func (b *Book) Take(side model.Side, price, qty float64) {
+	i, found := b.search(side, price)
+	if !found {
+		return
+	}
+	level := (*b.levels(side))[i]
+	b.Set(side, price, level.Qty-qty, level.Num)
+}
+
+// Bids returns the bid levels, best first. The slice must not be modified.
+func (b *Book) Bids() []Level {
+	return b.bids
+}
+
+// Asks returns the ask levels, best first. The slice must not be modified.
+func (b *Book) Asks() []Level {
+	return b.asks
+}
+
+// Side returns the levels of side, best first. The slice must not be modified.
+func (b *Book) Side(side model.Side) []Level {
+	return *b.levels(side)
+}
+
+// Qty returns the quantity resting at price on side
+func (b *Book) Qty(side model.Side, price float64) float64 {
+	i, found := b.search(side, price)
+	if !found {
+		return 0
+	}
+	return (*b.levels(side))[i].Qty
+}
+
+// BestBid returns the highest bid, false when there is none
+func (b *Book) BestBid() (Level, bool) {
+	if len(b.bids) == 0 {
+		return Level{}, false
+	}
+	return b.bids[0], true
+}
+
+// BestAsk returns the lowest ask, false when there is none
+func (b *Book) BestAsk() (Level, bool) {
+	if len(b.asks) == 0 {
+		return Level{}, false
+	}
+	return b.asks[0], true
+}
+
+// Mid returns the mid price, false when one side is empty
+func (b *Book) Mid() (float64, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return 0, false
+	}
+	return (bid.Price + ask.Price) / 2, true
+}
+
+// Spread returns the difference between the best ask and the best bid, false when one side is empty
+func (b *Book) Spread() (float64, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return 0, false
+	}
+	return ask.Price - bid.Price, true
+}
+
+// Clone returns a deep copy of the book
+func (b *Book) Clone() *Book {
+	c := &Book{
+		Symbol: b.Symbol,
+		Seqnum: b.Seqnum,
+		bids:   append([]Level(nil), b.bids...),
+		asks:   append([]Level(nil), b.asks...),
+	}
+	if b.l3 != nil {
+		c.l3 = make(map[int]l3Order, len(b.l3))
+		for id, o := range b.l3 {
+			c.l3[id] = o
+		}
+	}
+	return c
+}
@@ -0,0 +1,42 @@
+package book
+
+import (
+	"testing"
+
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyL2(t *testing.T) {
+	b := New("BTC-USD")
+	b.ApplyL2(ws.L2Msg{
+		Event: "snapshot",
+		Bids:  []ws.Level{{Px: 98, Qty: 1, Num: 1}, {Px: 99, Qty: 2, Num: 1}},
+		Asks:  []ws.Level{{Px: 102, Qty: 1, Num: 1}, {Px: 101, Qty: 3, Num: 2}},
+	})
+	require.Equal(t, []Level{{99, 2, 1}, {98, 1, 1}}, b.Bids())
+	require.Equal(t, []Level{{101, 3, 2}, {102, 1, 1}}, b.Asks())
+
+	b.ApplyL2(ws.L2Msg{Event: "updated", Seqnum: 2, Bids: []ws.Level{{Px: 99, Qty: 0}, {Px: 100, Qty: 1, Num: 1}}})
+	require.Equal(t, []Level{{100, 1, 1}, {98, 1, 1}}, b.Bids())
+	mid, _ := b.Mid()
+	require.Equal(t, 100.5, mid)
+	spread, _ := b.Spread()
+	require.Equal(t, 1.0, spread)
+
+	b.Take(model.SELL, 101, 3)
+	ask, _ := b.BestAsk()
+	require.Equal(t, 102.0, ask.Price)
+}
+
+func TestApplyL3(t *testing.T) {
+	b := New("BTC-USD")
+	b.ApplyL3(ws.L3Msg{Event: "snapshot", Asks: []ws.Level{{Px: 101, Qty: 1, Num: 10}, {Px: 101, Qty: 2, Num: 11}}})
+	require.Equal(t, []Level{{101, 3, 2}}, b.Asks())
+
+	b.ApplyL3(ws.L3Msg{Event: "updated", Asks: []ws.Level{{Px: 101, Qty: 0, Num: 10}, {Px: 102, Qty: 2, Num: 11}}})
+	require.Equal(t, []Level{{102, 2, 1}}, b.Asks())
+	require.Equal(t, 2.0, b.Clone().Qty(model.SELL, 102))
+}
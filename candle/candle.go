@@ -0,0 +1,283 @@
+// Package candle aggregates the trades stream into OHLCV bars of arbitrary
+// intervals, or bars closing after a number of trades, a volume or a notional.
+package candle
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// Kind of bar a Builder produces
+type Kind int
+
+// List of Kind
+const (
+	// Time bars cover a fixed interval
+	Time Kind = iota
+	// Tick bars close after a number of trades
+	Tick
+	// Volume bars close once the quantity traded reaches a threshold
+	Volume
+	// Dollar bars close once the notional traded reaches a threshold
+	Dollar
+)
+
+// Options of a Builder
+type Options struct {
+	// OnClose receives every bar when it closes, in time order for each symbol
+	OnClose func(candle model.Candle)
+	// Lateness keeps time bars open for trades arriving up to Lateness after
+	// the bar end, measured against the latest trade time seen for the symbol
+	Lateness time.Duration
+	// OnLate receives the trades arriving after their time bar closed, which
+	// are otherwise dropped
+	OnLate func(trade ws.TradesMsg)
+	// FillGaps emits flat bars at the previous close for the intervals
+	// without trades, for time bars
+	FillGaps bool
+}
+
+// series is the state of the bars of one symbol
+type series struct {
+	// open time bars by start, or the single bar in progress for the other kinds
+	open []*model.Candle
+	// latest trade time seen
+	watermark time.Time
+	// last bar emitted
+	last *model.Candle
+}
+
+// Builder aggregates trades into bars per symbol. It is not safe for
+// concurrent use; feed it from a single goroutine, e.g. a trades handler.
+type Builder struct {
+	kind      Kind
+	interval  time.Duration
+	threshold float64
+	opts      Options
+	symbols   map[string]*series
+}
+
+func newBuilder(kind Kind, interval time.Duration, threshold float64, opts Options) *Builder {
+	return &Builder{
+		kind:      kind,
+		interval:  interval,
+		threshold: threshold,
+		opts:      opts,
+		symbols:   make(map[string]*series),
+	}
+}
+
+// NewTimeBuilder returns a builder of bars covering interval, aligned on
+// multiples of the interval since the zero time, e.g. on the minute or hour
+func NewTimeBuilder(interval time.Duration, opts Options) *Builder {
+	return newBuilder(Time, interval, 0, opts)
+}
+
+// NewTickBuilder returns a builder of bars of trades trades each
+func NewTickBuilder(trades int, opts Options) *Builder {
+	return newBuilder(Tick, 0, float64(trades), opts)
+}
+
+// NewVolumeBuilder returns a builder of bars closing once qty is traded. A
+// trade is never split, so bars may exceed the threshold.
+func NewVolumeBuilder(qty float64, opts Options) *Builder {
+	return newBuilder(Volume, 0, qty, opts)
+}
+
+// NewDollarBuilder returns a builder of bars closing once notional is traded.
+// A trade is never split, so bars may exceed the threshold.
+func NewDollarBuilder(notional float64, opts Options) *Builder {
+	return newBuilder(Dollar, 0, notional, opts)
+}
+
+// Kind returns the kind of bars the builder produces
+func (b *Builder) Kind() Kind {
+	return b.kind
+}
+
+func (b *Builder) series(symbol string) *series {
+	s, ok := b.symbols[symbol]
+	if !ok {
+		s = &series{}
+		b.symbols[symbol] = s
+	}
+	return s
+}
+
+// Add aggregates a trade, closing the bars it completes
+func (b *Builder) Add(trade ws.TradesMsg) {
+	if trade.Event != "" && trade.Event != "updated" {
+		return
+	}
+	s := b.series(trade.Symbol)
+	if b.kind == Time {
+		b.addTimed(s, trade)
+	} else {
+		b.addCounted(s, trade)
+	}
+}
+
+func (b *Builder) addTimed(s *series, trade ws.TradesMsg) {
+	start := trade.Timestamp.Truncate(b.interval)
+	if b.closedAt(start, s.watermark) {
+		if b.opts.OnLate != nil {
+			b.opts.OnLate(trade)
+		}
+		return
+	}
+	i := sort.Search(len(s.open), func(i int) bool { return !s.open[i].Start.Before(start) })
+	if i == len(s.open) || !s.open[i].Start.Equal(start) {
+		c := &model.Candle{Symbol: trade.Symbol, Start: start, End: start.Add(b.interval)}
+		s.open = append(s.open, nil)
+		copy(s.open[i+1:], s.open[i:])
+		s.open[i] = c
+	}
+	update(s.open[i], trade)
+	if trade.Timestamp.After(s.watermark) {
+		s.watermark = trade.Timestamp
+	}
+	b.closeTimed(s, s.watermark)
+}
+
+// closedAt reports whether the bar starting at start is closed when the latest trade seen is at watermark
+func (b *Builder) closedAt(start, watermark time.Time) bool {
+	return !start.Add(b.interval + b.opts.Lateness).After(watermark)
+}
+
+// closeTimed emits the open bars of s closed at watermark
+func (b *Builder) closeTimed(s *series, watermark time.Time) {
+	n := 0
+	for n < len(s.open) && b.closedAt(s.open[n].Start, watermark) {
+		b.fillGaps(s, s.open[n].Start)
+		b.emit(s, *s.open[n])
+		n++
+	}
+	s.open = s.open[n:]
+	if len(s.open) > 0 {
+		b.fillGaps(s, s.open[0].Start)
+		return
+	}
+	// the intervals without trades up to the watermark are complete
+	for b.opts.FillGaps && s.last != nil && b.closedAt(s.last.End, watermark) {
+		b.fillGaps(s, s.last.End.Add(b.interval))
+	}
+}
+
+// fillGaps emits flat bars at the previous close from the last bar emitted up to until
+func (b *Builder) fillGaps(s *series, until time.Time) {
+	if !b.opts.FillGaps || s.last == nil {
+		return
+	}
+	for next := s.last.End; next.Before(until); next = s.last.End {
+		b.emit(s, model.Candle{
+			Symbol: s.last.Symbol,
+			Start:  next,
+			End:    next.Add(b.interval),
+			Open:   s.last.Close,
+			High:   s.last.Close,
+			Low:    s.last.Close,
+			Close:  s.last.Close,
+		})
+	}
+}
+
+func (b *Builder) emit(s *series, c model.Candle) {
+	s.last = &c
+	if b.opts.OnClose != nil {
+		b.opts.OnClose(c)
+	}
+}
+
+func (b *Builder) addCounted(s *series, trade ws.TradesMsg) {
+	if len(s.open) == 0 {
+		s.open = append(s.open, &model.Candle{Symbol: trade.Symbol, Start: trade.Timestamp})
+	}
+	c := s.open[0]
+	update(c, trade)
+	if trade.Timestamp.After(c.End) {
+		c.End = trade.Timestamp
+	}
+	var reached bool
+	switch b.kind {
+	case Tick:
+		reached = float64(c.Trades) >= b.threshold
+	case Volume:
+		reached = c.Volume >= b.threshold
+	case Dollar:
+		reached = c.Notional >= b.threshold
+	}
+	if reached {
+		s.open = s.open[:0]
+		b.emit(s, *c)
+	}
+}
+
+func update(c *model.Candle, trade ws.TradesMsg) {
+	if c.Trades == 0 {
+		c.Open, c.High, c.Low = trade.Price, trade.Price, trade.Price
+	}
+	if trade.Price > c.High {
+		c.High = trade.Price
+	}
+	if trade.Price < c.Low {
+		c.Low = trade.Price
+	}
+	c.Close = trade.Price
+	c.Volume += trade.Qty
+	c.Notional += trade.Qty * trade.Price
+	c.Trades++
+}
+
+// Advance closes the time bars of every symbol that are complete at now,
+// for when the clock moves without trades. It has no effect on other kinds.
+func (b *Builder) Advance(now time.Time) {
+	if b.kind != Time {
+		return
+	}
+	for _, symbol := range b.sortedSymbols() {
+		s := b.symbols[symbol]
+		if now.After(s.watermark) {
+			s.watermark = now
+		}
+		b.closeTimed(s, s.watermark)
+	}
+}
+
+// Flush emits the bars still open, e.g. at the end of a recording
+func (b *Builder) Flush() {
+	for _, symbol := range b.sortedSymbols() {
+		s := b.symbols[symbol]
+		for _, c := range s.open {
+			if b.kind == Time {
+				b.fillGaps(s, c.Start)
+			}
+			b.emit(s, *c)
+		}
+		s.open = s.open[:0]
+	}
+}
+
+// Open returns a copy of the bars of symbol in progress
+func (b *Builder) Open(symbol string) []model.Candle {
+	s, ok := b.symbols[symbol]
+	if !ok {
+		return nil
+	}
+	candles := make([]model.Candle, len(s.open))
+	for i, c := range s.open {
+		candles[i] = *c
+	}
+	return candles
+}
+
+func (b *Builder) sortedSymbols() []string {
+	symbols := make([]string, 0, len(b.symbols))
+	for symbol := range b.symbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
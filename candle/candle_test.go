@@ -0,0 +1,122 @@
+package candle_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/candle"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+var t0 = time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func trade(seconds int, price, qty float64) ws.TradesMsg {
+	return ws.TradesMsg{
+		Event:     "updated",
+		Channel:   "trades",
+		Symbol:    "BTC-USD",
+		Timestamp: t0.Add(time.Duration(seconds) * time.Second),
+		Price:     price,
+		Qty:       qty,
+	}
+}
+
+func TestTimeBars(t *testing.T) {
+	var closed []model.Candle
+	var late []ws.TradesMsg
+	b := candle.NewTimeBuilder(10*time.Second, candle.Options{
+		OnClose:  func(c model.Candle) { closed = append(closed, c) },
+		Lateness: 2 * time.Second,
+		OnLate:   func(trade ws.TradesMsg) { late = append(late, trade) },
+	})
+	b.Add(trade(1, 100, 1))
+	b.Add(trade(4, 105, 2))
+	b.Add(trade(11, 103, 1))
+	// late but within the allowed lateness
+	b.Add(trade(9, 95, 1))
+	require.Empty(t, closed)
+
+	b.Add(trade(12, 104, 1))
+	require.Len(t, closed, 1)
+	require.Equal(t, model.Candle{
+		Symbol:   "BTC-USD",
+		Start:    t0,
+		End:      t0.Add(10 * time.Second),
+		Open:     100,
+		High:     105,
+		Low:      95,
+		Close:    95,
+		Volume:   4,
+		Notional: 100 + 210 + 95,
+		Trades:   3,
+	}, closed[0])
+
+	b.Add(trade(8, 90, 1))
+	require.Len(t, late, 1)
+
+	b.Flush()
+	require.Len(t, closed, 2)
+	require.Equal(t, 103.0, closed[1].Open)
+	require.Equal(t, 104.0, closed[1].Close)
+	require.Equal(t, 2, closed[1].Trades)
+}
+
+func TestFillGaps(t *testing.T) {
+	var closed []model.Candle
+	b := candle.NewTimeBuilder(time.Minute, candle.Options{
+		OnClose:  func(c model.Candle) { closed = append(closed, c) },
+		FillGaps: true,
+	})
+	b.Add(trade(10, 100, 1))
+	b.Add(trade(185, 101, 1))
+	require.Len(t, closed, 3)
+	require.Equal(t, 100.0, closed[1].Open)
+	require.Equal(t, 100.0, closed[2].Close)
+	require.Zero(t, closed[2].Volume)
+	require.Equal(t, t0.Add(2*time.Minute), closed[2].Start)
+
+	b.Advance(t0.Add(5 * time.Minute))
+	require.Len(t, closed, 5)
+	require.Equal(t, 101.0, closed[4].Close)
+	require.Equal(t, t0.Add(5*time.Minute), closed[4].End)
+}
+
+func TestCountedBars(t *testing.T) {
+	var ticks, volume, dollar []model.Candle
+	builders := []*candle.Builder{
+		candle.NewTickBuilder(2, candle.Options{OnClose: func(c model.Candle) { ticks = append(ticks, c) }}),
+		candle.NewVolumeBuilder(3, candle.Options{OnClose: func(c model.Candle) { volume = append(volume, c) }}),
+		candle.NewDollarBuilder(500, candle.Options{OnClose: func(c model.Candle) { dollar = append(dollar, c) }}),
+	}
+	for _, tr := range []ws.TradesMsg{trade(1, 100, 1), trade(2, 110, 2), trade(3, 90, 1), trade(4, 100, 4)} {
+		for _, b := range builders {
+			b.Add(tr)
+		}
+	}
+	require.Len(t, ticks, 2)
+	require.Equal(t, t0.Add(time.Second), ticks[0].Start)
+	require.Equal(t, t0.Add(2*time.Second), ticks[0].End)
+	require.Equal(t, 110.0, ticks[0].High)
+
+	require.Len(t, volume, 2)
+	require.Equal(t, 3.0, volume[0].Volume)
+	require.Equal(t, 5.0, volume[1].Volume)
+
+	require.Len(t, dollar, 1)
+	require.Equal(t, 810.0, dollar[0].Notional)
+	require.Empty(t, builders[2].Open("BTC-USD"))
+}
+
+func TestPricesCandle(t *testing.T) {
+	msg := ws.PricesMsg{Symbol: "BTC-USD", Price: []float64{float64(t0.UnixMilli()), 1, 3, 0.5, 2, 10}}
+	c, err := msg.Candle(ws.Granularity60)
+	require.NoError(t, err)
+	require.Equal(t, model.Candle{Symbol: "BTC-USD", Start: t0, End: t0.Add(time.Minute), Open: 1, High: 3, Low: 0.5, Close: 2, Volume: 10}, c)
+	require.Equal(t, 2.0, c.VWAP())
+
+	_, err = ws.PricesMsg{Price: []float64{1}}.Candle(ws.Granularity60)
+	require.Error(t, err)
+}
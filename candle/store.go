@@ -0,0 +1,163 @@
+package candle
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/model"
+)
+
+// Source provides historical candles, e.g. rest.Client
+type Source interface {
+	GetCandles(symbol string, granularity time.Duration, from, to time.Time) ([]model.Candle, error)
+}
+
+// Store persists candles by symbol and interval
+type Store interface {
+	// Last returns the latest candle stored, false when there is none
+	Last(symbol string, interval time.Duration) (model.Candle, bool, error)
+	// Append stores candles starting after the last one stored
+	Append(symbol string, interval time.Duration, candles []model.Candle) error
+	// Load returns the candles stored starting in [from, to)
+	Load(symbol string, interval time.Duration, from, to time.Time) ([]model.Candle, error)
+}
+
+// FileStore stores the candles of each symbol and interval as a JSON line
+// file, <dir>/<symbol>/<interval in seconds>s.jsonl
+type FileStore struct {
+	dir string
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore returns a store writing under dir
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir}
+}
+
+func (s *FileStore) path(symbol string, interval time.Duration) string {
+	return filepath.Join(s.dir, symbol, strconv.FormatInt(int64(interval/time.Second), 10)+"s.jsonl")
+}
+
+func (s *FileStore) read(symbol string, interval time.Duration, keep func(model.Candle) bool) ([]model.Candle, error) {
+	f, err := os.Open(s.path(symbol, interval))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var candles []model.Candle
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var c model.Candle
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Name(), err)
+		}
+		if keep(c) {
+			candles = append(candles, c)
+		}
+	}
+	return candles, scanner.Err()
+}
+
+// Last returns the latest candle stored, false when there is none
+func (s *FileStore) Last(symbol string, interval time.Duration) (model.Candle, bool, error) {
+	var last model.Candle
+	var found bool
+	_, err := s.read(symbol, interval, func(c model.Candle) bool {
+		last, found = c, true
+		return false
+	})
+	return last, found, err
+}
+
+// Append stores candles at the end of the file
+func (s *FileStore) Append(symbol string, interval time.Duration, candles []model.Candle) error {
+	if len(candles) == 0 {
+		return nil
+	}
+	path := s.path(symbol, interval)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	for _, c := range candles {
+		if err := encoder.Encode(c); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load returns the candles stored starting in [from, to), unbounded when zero
+func (s *FileStore) Load(symbol string, interval time.Duration, from, to time.Time) ([]model.Candle, error) {
+	return s.read(symbol, interval, func(c model.Candle) bool {
+		return !c.Start.Before(from) && (to.IsZero() || c.Start.Before(to))
+	})
+}
+
+// Backfill downloads the candles of symbol between from and to chunk by
+// chunk, appending each chunk to the store as it arrives. It resumes after
+// the last candle already stored, so an interrupted backfill can be rerun.
+// Intervals without candles between two candles are filled with flat bars;
+// those after the last candle are not, the source may not have published
+// them yet, and are downloaded again by the next run.
+func Backfill(source Source, store Store, symbol string, interval, chunk time.Duration, from, to time.Time) error {
+	if chunk < interval {
+		chunk = interval
+	}
+	chunk = chunk.Truncate(interval)
+	last, found, err := store.Last(symbol, interval)
+	if err != nil {
+		return err
+	}
+	start := from.Truncate(interval)
+	if found && last.End.After(start) {
+		start = last.End
+	}
+	for ; start.Before(to); start = start.Add(chunk) {
+		end := start.Add(chunk)
+		if end.After(to) {
+			end = to
+		}
+		candles, err := source.GetCandles(symbol, interval, start, end)
+		if err != nil {
+			return fmt.Errorf("backfilling %s from %s: %w", symbol, start, err)
+		}
+		var fresh []model.Candle
+		for _, c := range candles {
+			if !c.Start.Before(start) && c.Start.Before(end) {
+				fresh = append(fresh, c)
+			}
+		}
+		if found {
+			fresh = model.FillCandleGaps(append([]model.Candle{last}, fresh...), interval, time.Time{})[1:]
+		} else {
+			fresh = model.FillCandleGaps(fresh, interval, time.Time{})
+		}
+		if err := store.Append(symbol, interval, fresh); err != nil {
+			return err
+		}
+		if len(fresh) > 0 {
+			last, found = fresh[len(fresh)-1], true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package candle_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/candle"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest/resttest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfill(t *testing.T) {
+	store := candle.NewFileStore(t.TempDir())
+	api := resttest.NewFakeAPI()
+	failed := false
+	api.GetCandlesFunc = func(symbol string, granularity time.Duration, from, to time.Time) ([]model.Candle, error) {
+		if from.Equal(t0.Add(3*time.Minute)) && !failed {
+			failed = true
+			return nil, errors.New("rate limited")
+		}
+		// a single candle a minute into each chunk
+		start := from.Add(granularity)
+		return []model.Candle{{Symbol: symbol, Start: start, End: start.Add(granularity), Open: 1, High: 1, Low: 1, Close: float64(start.Minute())}}, nil
+	}
+
+	to := t0.Add(6 * time.Minute)
+	err := candle.Backfill(api, store, "BTC-USD", time.Minute, 3*time.Minute, t0, to)
+	require.Error(t, err)
+	candles, err := store.Load("BTC-USD", time.Minute, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	// the candle at t0+1m, without a flat bar after it
+	require.Len(t, candles, 1)
+	require.Equal(t, t0.Add(time.Minute), candles[0].Start)
+
+	// rerunning resumes after the last candle stored
+	api.Reset()
+	require.NoError(t, candle.Backfill(api, store, "BTC-USD", time.Minute, 3*time.Minute, t0, to))
+	calls := api.CallsTo("GetCandles")
+	require.Len(t, calls, 2)
+	require.Equal(t, t0.Add(2*time.Minute), calls[0].Args[2])
+
+	// the gap before the candle at t0+3m is filled, the intervals after it are not
+	candles, err = store.Load("BTC-USD", time.Minute, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, candles, 3)
+	require.Equal(t, t0.Add(2*time.Minute), candles[1].Start)
+	require.Equal(t, 1.0, candles[1].Close)
+	require.Zero(t, candles[1].Volume)
+	require.Equal(t, 3.0, candles[2].Close)
+
+	last, found, err := store.Last("BTC-USD", time.Minute)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, t0.Add(3*time.Minute), last.Start)
+}
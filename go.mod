@@ -1,8 +1,11 @@
 module github.com/hmedkouri/go-bcex
 
-go 1.18
+go 1.22
 
-require github.com/stretchr/testify v1.7.1
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/stretchr/testify v1.7.1
+)
 
 require (
 	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
@@ -0,0 +1,52 @@
+package indicator
+
+import (
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// Feed updates a set of indicators from a candle stream, e.g. as the OnClose
+// handler of a candle.Builder, or from prices and ticker messages
+type Feed struct {
+	bars []Bar
+	// OnUpdate, when set, is called after every candle once the indicators are updated
+	OnUpdate func(c model.Candle)
+}
+
+// NewFeed returns a feed updating bars
+func NewFeed(bars ...Bar) *Feed {
+	return &Feed{bars: bars}
+}
+
+// Add registers more indicators, fed from the next candle on
+func (f *Feed) Add(bars ...Bar) {
+	f.bars = append(f.bars, bars...)
+}
+
+// Candle updates every indicator with a closed candle
+func (f *Feed) Candle(c model.Candle) {
+	for _, bar := range f.bars {
+		bar.AddCandle(c)
+	}
+	if f.OnUpdate != nil {
+		f.OnUpdate(c)
+	}
+}
+
+// Prices updates every indicator with the candle of a prices message of the
+// subscribed granularity
+func (f *Feed) Prices(msg ws.PricesMsg, granularity ws.Granularity) error {
+	c, err := msg.Candle(granularity)
+	if err != nil {
+		return err
+	}
+	f.Candle(c)
+	return nil
+}
+
+// Ticker updates every indicator with a flat candle at the last trade price
+// of a ticker message, for indicators sampled at the ticker rate
+func (f *Feed) Ticker(msg ws.TickerMsg) {
+	price := msg.LastTradePrice
+	f.Candle(model.Candle{Symbol: msg.Symbol, Open: price, High: price, Low: price, Close: price})
+}
@@ -0,0 +1,420 @@
+// Package indicator provides streaming technical indicators updated in
+// constant time per value, fed from candles, prices or ticker messages.
+package indicator
+
+import (
+	"math"
+
+	"github.com/hmedkouri/go-bcex/model"
+)
+
+// Series is an indicator computed from a stream of values, e.g. closes
+type Series interface {
+	// Add updates the indicator with the next value
+	Add(v float64)
+	// Value returns the current value, meaningful once Ready
+	Value() float64
+	// Ready reports whether enough values were added for the indicator to warm up
+	Ready() bool
+}
+
+// Bar is an indicator computed from a stream of candles
+type Bar interface {
+	// AddCandle updates the indicator with the next closed candle
+	AddCandle(c model.Candle)
+	Value() float64
+	Ready() bool
+}
+
+// Field extracts the value of a candle a Series is computed from
+type Field func(c model.Candle) float64
+
+// Candle fields
+var (
+	Open  Field = func(c model.Candle) float64 { return c.Open }
+	High  Field = func(c model.Candle) float64 { return c.High }
+	Low   Field = func(c model.Candle) float64 { return c.Low }
+	Close Field = func(c model.Candle) float64 { return c.Close }
+	// Median is (high + low) / 2
+	Median Field = func(c model.Candle) float64 { return (c.High + c.Low) / 2 }
+	// Typical is (high + low + close) / 3
+	Typical Field = func(c model.Candle) float64 { return (c.High + c.Low + c.Close) / 3 }
+)
+
+type fieldBar struct {
+	Series
+	field Field
+}
+
+// OnField returns a Bar feeding series with field of each candle
+func OnField(field Field, series Series) Bar {
+	return fieldBar{series, field}
+}
+
+func (b fieldBar) AddCandle(c model.Candle) {
+	b.Add(b.field(c))
+}
+
+type chain struct {
+	first Series
+	then  Series
+}
+
+// Chain returns a Series feeding the values of first, once it is ready, into
+// then, e.g. Chain(NewRSI(14), NewSMA(5)) for a smoothed RSI. Its value is
+// the value of then.
+func Chain(first, then Series) Series {
+	return &chain{first, then}
+}
+
+func (c *chain) Add(v float64) {
+	c.first.Add(v)
+	if c.first.Ready() {
+		c.then.Add(c.first.Value())
+	}
+}
+
+func (c *chain) Value() float64 { return c.then.Value() }
+func (c *chain) Ready() bool    { return c.then.Ready() }
+
+// window is a ring buffer of the last n values
+type window struct {
+	values []float64
+	next   int
+	full   bool
+}
+
+func newWindow(n int) window {
+	if n < 1 {
+		n = 1
+	}
+	return window{values: make([]float64, n)}
+}
+
+// push adds v and returns the value it evicted, zero until the window is full
+func (w *window) push(v float64) (evicted float64) {
+	evicted = w.values[w.next]
+	w.values[w.next] = v
+	w.next++
+	if w.next == len(w.values) {
+		w.next = 0
+		w.full = true
+	}
+	return evicted
+}
+
+// SMA is the simple moving average of the last n values
+type SMA struct {
+	w   window
+	sum float64
+}
+
+// NewSMA returns the simple moving average over n values
+func NewSMA(n int) *SMA {
+	return &SMA{w: newWindow(n)}
+}
+
+func (s *SMA) Add(v float64) {
+	s.sum += v - s.w.push(v)
+}
+
+func (s *SMA) Value() float64 {
+	return s.sum / float64(len(s.w.values))
+}
+
+func (s *SMA) Ready() bool {
+	return s.w.full
+}
+
+// EMA is the exponential moving average with a smoothing factor of
+// 2 / (n + 1), seeded with the simple average of the first n values
+type EMA struct {
+	n     int
+	alpha float64
+	count int
+	value float64
+}
+
+// NewEMA returns the exponential moving average over n values
+func NewEMA(n int) *EMA {
+	if n < 1 {
+		n = 1
+	}
+	return &EMA{n: n, alpha: 2 / float64(n+1)}
+}
+
+func (e *EMA) Add(v float64) {
+	e.count++
+	if e.count <= e.n {
+		e.value += (v - e.value) / float64(e.count)
+		return
+	}
+	e.value += e.alpha * (v - e.value)
+}
+
+func (e *EMA) Value() float64 {
+	return e.value
+}
+
+func (e *EMA) Ready() bool {
+	return e.count >= e.n
+}
+
+// wilder is Wilder's smoothing, an exponential average with a factor of 1/n
+// seeded with the simple average of the first n values
+type wilder struct {
+	n     int
+	count int
+	value float64
+}
+
+func (w *wilder) add(v float64) {
+	w.count++
+	if w.count <= w.n {
+		w.value += (v - w.value) / float64(w.count)
+		return
+	}
+	w.value += (v - w.value) / float64(w.n)
+}
+
+// RSI is Wilder's relative strength index over n changes, between 0 and 100
+type RSI struct {
+	gain    wilder
+	loss    wilder
+	last    float64
+	started bool
+}
+
+// NewRSI returns the relative strength index over n values
+func NewRSI(n int) *RSI {
+	if n < 1 {
+		n = 1
+	}
+	return &RSI{gain: wilder{n: n}, loss: wilder{n: n}}
+}
+
+func (r *RSI) Add(v float64) {
+	if !r.started {
+		r.started = true
+		r.last = v
+		return
+	}
+	change := v - r.last
+	r.last = v
+	r.gain.add(math.Max(change, 0))
+	r.loss.add(math.Max(-change, 0))
+}
+
+func (r *RSI) Value() float64 {
+	if r.loss.value == 0 {
+		if r.gain.value == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+r.gain.value/r.loss.value)
+}
+
+func (r *RSI) Ready() bool {
+	return r.gain.count >= r.gain.n
+}
+
+// StdDev is the population standard deviation of the last n values
+type StdDev struct {
+	w     window
+	sum   float64
+	sumSq float64
+}
+
+// NewStdDev returns the standard deviation over n values
+func NewStdDev(n int) *StdDev {
+	return &StdDev{w: newWindow(n)}
+}
+
+func (s *StdDev) Add(v float64) {
+	evicted := s.w.push(v)
+	s.sum += v - evicted
+	s.sumSq += v*v - evicted*evicted
+}
+
+func (s *StdDev) mean() float64 {
+	return s.sum / float64(len(s.w.values))
+}
+
+func (s *StdDev) Value() float64 {
+	mean := s.mean()
+	// guard against rounding making the variance slightly negative
+	return math.Sqrt(math.Max(0, s.sumSq/float64(len(s.w.values))-mean*mean))
+}
+
+func (s *StdDev) Ready() bool {
+	return s.w.full
+}
+
+// MACD is the difference between a fast and a slow EMA, with a signal EMA of
+// that difference
+type MACD struct {
+	fast   *EMA
+	slow   *EMA
+	signal *EMA
+}
+
+// NewMACD returns the MACD of the given periods, typically 12, 26 and 9
+func NewMACD(fast, slow, signal int) *MACD {
+	return &MACD{NewEMA(fast), NewEMA(slow), NewEMA(signal)}
+}
+
+func (m *MACD) Add(v float64) {
+	m.fast.Add(v)
+	m.slow.Add(v)
+	if m.slow.Ready() {
+		m.signal.Add(m.Value())
+	}
+}
+
+// Value returns the MACD line, the fast EMA minus the slow EMA
+func (m *MACD) Value() float64 {
+	return m.fast.Value() - m.slow.Value()
+}
+
+// Signal returns the EMA of the MACD line
+func (m *MACD) Signal() float64 {
+	return m.signal.Value()
+}
+
+// Histogram returns the MACD line minus the signal line
+func (m *MACD) Histogram() float64 {
+	return m.Value() - m.Signal()
+}
+
+// Ready reports whether the signal line is warmed up
+func (m *MACD) Ready() bool {
+	return m.signal.Ready()
+}
+
+// Bollinger bands are a simple moving average plus and minus k standard deviations
+type Bollinger struct {
+	std *StdDev
+	k   float64
+}
+
+// NewBollinger returns Bollinger bands over n values, typically 20 and 2
+func NewBollinger(n int, k float64) *Bollinger {
+	return &Bollinger{NewStdDev(n), k}
+}
+
+func (b *Bollinger) Add(v float64) {
+	b.std.Add(v)
+}
+
+// Value returns the middle band, the moving average
+func (b *Bollinger) Value() float64 {
+	return b.std.mean()
+}
+
+// Upper returns the upper band
+func (b *Bollinger) Upper() float64 {
+	return b.Value() + b.k*b.std.Value()
+}
+
+// Lower returns the lower band
+func (b *Bollinger) Lower() float64 {
+	return b.Value() - b.k*b.std.Value()
+}
+
+// PercentB returns the position of v relative to the bands, 0 on the lower
+// band and 1 on the upper one
+func (b *Bollinger) PercentB(v float64) float64 {
+	width := b.Upper() - b.Lower()
+	if width == 0 {
+		return 0.5
+	}
+	return (v - b.Lower()) / width
+}
+
+func (b *Bollinger) Ready() bool {
+	return b.std.Ready()
+}
+
+// ATR is Wilder's average true range over n candles
+type ATR struct {
+	avg       wilder
+	prevClose float64
+	started   bool
+}
+
+// NewATR returns the average true range over n candles
+func NewATR(n int) *ATR {
+	if n < 1 {
+		n = 1
+	}
+	return &ATR{avg: wilder{n: n}}
+}
+
+func (a *ATR) AddCandle(c model.Candle) {
+	tr := c.High - c.Low
+	if a.started {
+		tr = math.Max(tr, math.Max(math.Abs(c.High-a.prevClose), math.Abs(c.Low-a.prevClose)))
+	}
+	a.started = true
+	a.prevClose = c.Close
+	a.avg.add(tr)
+}
+
+func (a *ATR) Value() float64 {
+	return a.avg.value
+}
+
+func (a *ATR) Ready() bool {
+	return a.avg.count >= a.avg.n
+}
+
+// VWAP is the volume weighted average price over the last n candles, or
+// since the first candle when n is zero. The notional of a candle is used
+// when known, its typical price times its volume otherwise.
+type VWAP struct {
+	notional window
+	volume   window
+	n        int
+	count    int
+	sumPV    float64
+	sumV     float64
+}
+
+// NewVWAP returns the volume weighted average price over n candles, cumulative when n <= 0
+func NewVWAP(n int) *VWAP {
+	v := &VWAP{n: n}
+	if n > 0 {
+		v.notional = newWindow(n)
+		v.volume = newWindow(n)
+	}
+	return v
+}
+
+func (v *VWAP) AddCandle(c model.Candle) {
+	notional := c.Notional
+	if notional <= 0 {
+		notional = Typical(c) * c.Volume
+	}
+	v.count++
+	v.sumPV += notional
+	v.sumV += c.Volume
+	if v.n > 0 {
+		v.sumPV -= v.notional.push(notional)
+		v.sumV -= v.volume.push(c.Volume)
+	}
+}
+
+func (v *VWAP) Value() float64 {
+	if v.sumV <= 0 {
+		return 0
+	}
+	return v.sumPV / v.sumV
+}
+
+func (v *VWAP) Ready() bool {
+	if v.n > 0 {
+		return v.count >= v.n
+	}
+	return v.count > 0
+}
@@ -0,0 +1,170 @@
+package indicator_test
+
+import (
+	"testing"
+
+	"github.com/hmedkouri/go-bcex/indicator"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+// reference prices and values from the StockCharts ChartSchool examples
+var (
+	emaCloses = []float64{22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29, 22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63}
+	ema10     = []float64{22.22, 22.21, 22.24, 22.27, 22.33, 22.52, 22.80, 22.97, 23.13, 23.28, 23.34}
+
+	rsiCloses = []float64{44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08, 45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64}
+	rsi14     = []float64{70.53, 66.32, 66.55, 69.41, 66.36, 57.97}
+
+	atrBars = candles(
+		[3]float64{48.70, 47.79, 48.16}, [3]float64{48.72, 48.14, 48.61}, [3]float64{48.90, 48.39, 48.75}, [3]float64{48.87, 48.37, 48.63},
+		[3]float64{48.82, 48.24, 48.74}, [3]float64{49.05, 48.64, 49.03}, [3]float64{49.20, 48.94, 49.07}, [3]float64{49.35, 48.86, 49.32},
+		[3]float64{49.92, 49.50, 49.91}, [3]float64{50.19, 49.87, 50.13}, [3]float64{50.12, 49.20, 49.53}, [3]float64{49.66, 48.90, 49.50},
+		[3]float64{49.88, 49.43, 49.75}, [3]float64{50.19, 49.73, 50.03}, [3]float64{50.36, 49.26, 50.31}, [3]float64{50.57, 50.09, 50.52},
+		[3]float64{50.65, 50.30, 50.41},
+	)
+	atr14 = []float64{0.55, 0.59, 0.59, 0.57}
+)
+
+// reference values computed with the ChartSchool formulas: the MACD(3, 6, 4)
+// of emaCloses, and the VWAP of the first atrBars given volumes
+var (
+	macdLine      = []float64{0.0237, 0.0200, -0.0141, 0.0271, 0.0358, 0.0831, 0.2488, 0.4203, 0.3572, 0.3008, 0.2634, 0.1438}
+	macdSignal    = []float64{0.0166, 0.0180, 0.0051, 0.0139, 0.0227, 0.0468, 0.1276, 0.2447, 0.2897, 0.2942, 0.2819, 0.2267}
+	macdHistogram = []float64{0.0070, 0.0020, -0.0193, 0.0132, 0.0131, 0.0363, 0.1212, 0.1756, 0.0675, 0.0067, -0.0185, -0.0828}
+	vwapVolumes   = []float64{1200, 1500, 900, 1100, 1300, 1600}
+	vwap3         = []float64{48.4464, 48.5808, 48.6296, 48.7291}
+	vwapSinceOpen = []float64{48.2167, 48.3685, 48.4464, 48.4878, 48.5121, 48.5952}
+)
+
+func TestSeries(t *testing.T) {
+	tests := []struct {
+		name      string
+		series    indicator.Series
+		input     []float64
+		warmup    int
+		expected  []float64
+		tolerance float64
+	}{
+		{"SMA", indicator.NewSMA(3), []float64{1, 2, 3, 4, 5, 6}, 2, []float64{2, 3, 4, 5}, 1e-9},
+		{"EMA", indicator.NewEMA(10), emaCloses, 9, ema10, 0.005},
+		{"RSI", indicator.NewRSI(14), rsiCloses, 14, rsi14, 0.1},
+		{"StdDev", indicator.NewStdDev(4), []float64{2, 4, 4, 4, 5, 5, 7, 9}, 3, []float64{0.8660254, 0.4330127, 0.5, 1.0897247, 1.6583124}, 1e-6},
+		{"Chain", indicator.Chain(indicator.NewSMA(2), indicator.NewSMA(2)), []float64{1, 3, 5, 7}, 2, []float64{3, 5}, 1e-9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var values []float64
+			for i, v := range tt.input {
+				tt.series.Add(v)
+				require.Equal(t, i >= tt.warmup, tt.series.Ready(), "ready after %d values", i+1)
+				if tt.series.Ready() {
+					values = append(values, tt.series.Value())
+				}
+			}
+			require.InDeltaSlice(t, tt.expected, values, tt.tolerance)
+		})
+	}
+}
+
+func TestMACD(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    func(*indicator.MACD) float64
+		expected []float64
+	}{
+		{"MACD", (*indicator.MACD).Value, macdLine},
+		{"Signal", (*indicator.MACD).Signal, macdSignal},
+		{"Histogram", (*indicator.MACD).Histogram, macdHistogram},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			macd := indicator.NewMACD(3, 6, 4)
+			var values []float64
+			for i, v := range emaCloses {
+				macd.Add(v)
+				require.Equal(t, i >= 8, macd.Ready(), "ready after %d values", i+1)
+				if macd.Ready() {
+					values = append(values, tt.value(macd))
+				}
+			}
+			require.InDeltaSlice(t, tt.expected, values, 1e-4)
+		})
+	}
+}
+
+func TestBollinger(t *testing.T) {
+	b := indicator.NewBollinger(5, 2)
+	for _, v := range emaCloses {
+		b.Add(v)
+	}
+	require.True(t, b.Ready())
+	require.InDelta(t, 23.842, b.Value(), 1e-9)
+	require.InDelta(t, 23.842+2*0.1472956, b.Upper(), 1e-6)
+	require.InDelta(t, 23.842-2*0.1472956, b.Lower(), 1e-6)
+	require.InDelta(t, 0.5, b.PercentB(23.842), 1e-9)
+}
+
+func candles(hlc ...[3]float64) []model.Candle {
+	var candles []model.Candle
+	for _, v := range hlc {
+		candles = append(candles, model.Candle{High: v[0], Low: v[1], Close: v[2], Open: v[2], Volume: 1})
+	}
+	return candles
+}
+
+func TestBars(t *testing.T) {
+	bars := candles([3]float64{10, 8, 9}, [3]float64{12, 9, 11}, [3]float64{11, 7, 8}, [3]float64{9, 6, 7})
+	volumeBars := append([]model.Candle(nil), atrBars[:len(vwapVolumes)]...)
+	for i := range volumeBars {
+		volumeBars[i].Volume = vwapVolumes[i]
+	}
+	tests := []struct {
+		name      string
+		bar       indicator.Bar
+		input     []model.Candle
+		warmup    int
+		expected  []float64
+		tolerance float64
+	}{
+		// true ranges 2, 3, 4, 3
+		{"ATR", indicator.NewATR(2), bars, 1, []float64{2.5, 3.25, 3.125}, 1e-9},
+		{"ATRReference", indicator.NewATR(14), atrBars, 13, atr14, 0.005},
+		// typical prices 9, 32/3, 26/3, 22/3
+		{"VWAP", indicator.NewVWAP(2), bars, 1, []float64{59.0 / 6, 58.0 / 6, 48.0 / 6}, 1e-9},
+		{"VWAPReference", indicator.NewVWAP(3), volumeBars, 2, vwap3, 1e-4},
+		{"CumulativeVWAP", indicator.NewVWAP(0), bars, 0, []float64{9, 59.0 / 6, 85.0 / 9, 107.0 / 12}, 1e-9},
+		{"CumulativeVWAPReference", indicator.NewVWAP(0), volumeBars, 0, vwapSinceOpen, 1e-4},
+		{"OnField", indicator.OnField(indicator.High, indicator.NewSMA(2)), bars, 1, []float64{11, 11.5, 10}, 1e-9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var values []float64
+			for i, c := range tt.input {
+				tt.bar.AddCandle(c)
+				require.Equal(t, i >= tt.warmup, tt.bar.Ready(), "ready after %d candles", i+1)
+				if tt.bar.Ready() {
+					values = append(values, tt.bar.Value())
+				}
+			}
+			require.InDeltaSlice(t, tt.expected, values, tt.tolerance)
+		})
+	}
+}
+
+func TestFeed(t *testing.T) {
+	sma := indicator.NewSMA(2)
+	atr := indicator.NewATR(1)
+	feed := indicator.NewFeed(indicator.OnField(indicator.Close, sma), atr)
+	updates := 0
+	feed.OnUpdate = func(model.Candle) { updates++ }
+
+	require.NoError(t, feed.Prices(ws.PricesMsg{Symbol: "BTC-USD", Price: []float64{0, 1, 4, 1, 2, 10}}, ws.Granularity60))
+	feed.Ticker(ws.TickerMsg{Symbol: "BTC-USD", LastTradePrice: 6})
+	require.Error(t, feed.Prices(ws.PricesMsg{}, ws.Granularity60))
+	require.Equal(t, 2, updates)
+	require.Equal(t, 4.0, sma.Value())
+	require.Equal(t, 4.0, atr.Value())
+}
@@ -0,0 +1,400 @@
+package bcex
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/book"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// MarketEvent is a market data update of a watched symbol. Msg is a ws.L2Msg,
+// ws.TickerMsg or ws.TradesMsg, already applied to the symbol snapshot.
+type MarketEvent struct {
+	Symbol string
+	Msg    interface{}
+}
+
+// MarketSnapshot is a consistent view of the market data of a symbol
+type MarketSnapshot struct {
+	Symbol string
+	// Book is a copy of the order book
+	Book      *book.Book
+	Ticker    ws.TickerMsg
+	LastTrade ws.TradesMsg
+	// Updated is when the last message was applied
+	Updated time.Time
+	// Bootstrapped reports whether the Rest snapshots were loaded
+	Bootstrapped bool
+	// Resyncs counts the reloads of the Rest snapshots after websocket
+	// messages were missed
+	Resyncs int
+	// DroppedEvents counts the events not delivered because the event stream was full
+	DroppedEvents int
+}
+
+// MarketDataOptions configures a MarketDataManager
+type MarketDataOptions struct {
+	// EventBuffer is the capacity of the event stream of each symbol, 256 when zero.
+	// Events are dropped when the stream is full rather than stalling the other symbols.
+	EventBuffer int
+	// MessageBuffer is the capacity of the buffer of the websocket messages,
+	// 4096 when zero. The messages are dropped when it is full, see
+	// DroppedMessages, and the symbols reloaded from the Rest snapshots.
+	MessageBuffer int
+}
+
+// resyncRetry is the delay between the attempts to reload the Rest snapshots
+// of a symbol after websocket messages were missed
+const resyncRetry = time.Second
+
+type marketState struct {
+	book         *book.Book
+	ticker       ws.TickerMsg
+	lastTrade    ws.TradesMsg
+	updated      time.Time
+	bootstrapped bool
+	// reload is set when messages are missed while the Rest snapshots are
+	// loading, so they are loaded again
+	reload  bool
+	resyncs int
+	// messages received before the Rest snapshots were loaded
+	pending []interface{}
+	events  chan MarketEvent
+	dropped int
+}
+
+// MarketDataManager tracks the l2 book, ticker and last trade of a watchlist of
+// symbols. Each symbol is bootstrapped from the Rest snapshots, then kept up
+// to date from the websocket messages, received with its own Listener of the
+// streamer. When messages are missed, because the listener dropped some, the
+// sequence numbers skipped some or the connection was reestablished, the
+// symbols are bootstrapped again.
+type MarketDataManager struct {
+	api      rest.API
+	streamer ws.Streamer
+	opts     MarketDataOptions
+
+	mu       sync.RWMutex
+	symbols  map[string]*marketState
+	listener *ws.Listener
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMarketDataManager returns a manager using api for the snapshots and streamer for the updates
+func NewMarketDataManager(api rest.API, streamer ws.Streamer, opts MarketDataOptions) *MarketDataManager {
+	if opts.EventBuffer <= 0 {
+		opts.EventBuffer = 256
+	}
+	if opts.MessageBuffer <= 0 {
+		opts.MessageBuffer = 4096
+	}
+	return &MarketDataManager{
+		api:      api,
+		streamer: streamer,
+		opts:     opts,
+		symbols:  make(map[string]*marketState),
+		done:     make(chan struct{}),
+	}
+}
+
+// MarketData returns a MarketDataManager over the Rest and websocket clients
+func (c *Client) MarketData() *MarketDataManager {
+	return NewMarketDataManager(c.Rest, c.Ws, MarketDataOptions{})
+}
+
+// Start consumes the websocket messages until Stop is called
+func (m *MarketDataManager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.listener != nil {
+		return
+	}
+	m.listener = m.streamer.Listen(ws.ListenerOptions{
+		Channels: []string{"l2", "ticker", "trades"},
+		Buffer:   m.opts.MessageBuffer,
+	})
+	go m.run(m.listener, m.streamer.Health())
+}
+
+// Stop ends the consumption of the websocket messages and closes the event streams
+func (m *MarketDataManager) Stop() {
+	m.stopOnce.Do(func() {
+		m.mu.RLock()
+		listener := m.listener
+		m.mu.RUnlock()
+		if listener != nil {
+			listener.Close()
+			<-m.done
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for symbol, state := range m.symbols {
+			close(state.events)
+			delete(m.symbols, symbol)
+		}
+	})
+}
+
+// run applies the messages of listener, health being the state of the
+// connection when it was created
+func (m *MarketDataManager) run(listener *ws.Listener, health ws.Health) {
+	defer close(m.done)
+	var dropped uint64
+	for msg := range listener.C {
+		if d := listener.Dropped(); d > dropped {
+			dropped = d
+			m.missed()
+		} else if h := m.streamer.Health(); h.SequenceGaps > health.SequenceGaps || h.Reconnects > health.Reconnects {
+			health = h
+			m.missed()
+		}
+		switch msg := msg.(type) {
+		case ws.L2Msg:
+			m.apply(msg.Symbol, msg)
+		case ws.TickerMsg:
+			m.apply(msg.Symbol, msg)
+		case ws.TradesMsg:
+			m.apply(msg.Symbol, msg)
+		}
+	}
+}
+
+// missed makes every symbol wait for new Rest snapshots, the messages
+// received in the meantime being kept as when it was first watched
+func (m *MarketDataManager) missed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for symbol, state := range m.symbols {
+		if !state.bootstrapped {
+			state.reload = true
+			continue
+		}
+		state.bootstrapped = false
+		state.resyncs++
+		go m.resync(symbol)
+	}
+}
+
+// resync reloads the Rest snapshots of symbol until it succeeds, the symbol
+// is unwatched or the manager stopped
+func (m *MarketDataManager) resync(symbol string) {
+	for m.bootstrap(symbol) != nil {
+		select {
+		case <-m.done:
+			return
+		case <-time.After(resyncRetry):
+		}
+	}
+}
+
+// DroppedMessages counts the websocket messages missed because the manager
+// could not keep up, its books may be stale
+func (m *MarketDataManager) DroppedMessages() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.listener == nil {
+		return 0
+	}
+	return m.listener.Dropped()
+}
+
+// Watch subscribes to the l2, ticker and trades channels of the symbols not
+// watched yet and loads their Rest snapshots. Messages received while the
+// snapshots are loading are applied after them, those received before the
+// snapshots were requested are discarded.
+func (m *MarketDataManager) Watch(symbols ...string) error {
+	for _, symbol := range symbols {
+		m.mu.Lock()
+		if _, ok := m.symbols[symbol]; ok {
+			m.mu.Unlock()
+			continue
+		}
+		m.symbols[symbol] = &marketState{
+			book:   book.New(symbol),
+			events: make(chan MarketEvent, m.opts.EventBuffer),
+		}
+		m.mu.Unlock()
+
+		if err := m.subscribe(symbol); err != nil {
+			m.Unwatch(symbol)
+			return err
+		}
+		if err := m.bootstrap(symbol); err != nil {
+			m.Unwatch(symbol)
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MarketDataManager) subscribe(symbol string) error {
+	if err := m.streamer.SubscribeToL2(ws.Symbol(symbol)); err != nil {
+		return fmt.Errorf("subscribing to l2 %s: %w", symbol, err)
+	}
+	if err := m.streamer.SubscribeToTicker(ws.Symbol(symbol)); err != nil {
+		return fmt.Errorf("subscribing to ticker %s: %w", symbol, err)
+	}
+	if err := m.streamer.SubscribeToTrades(ws.Symbol(symbol)); err != nil {
+		return fmt.Errorf("subscribing to trades %s: %w", symbol, err)
+	}
+	return nil
+}
+
+// bootstrap loads the Rest snapshots of symbol, then applies the messages
+// received since they were requested
+func (m *MarketDataManager) bootstrap(symbol string) error {
+	for {
+		requested := time.Now()
+		orderbook, err := m.api.GetL2Orderbook(symbol)
+		if err != nil {
+			return fmt.Errorf("loading l2 order book %s: %w", symbol, err)
+		}
+		ticker, err := m.api.GetTicker(symbol)
+		if err != nil {
+			return fmt.Errorf("loading ticker %s: %w", symbol, err)
+		}
+		if m.load(symbol, orderbook, ticker, requested) {
+			return nil
+		}
+	}
+}
+
+// load applies the Rest snapshots requested at requested, reporting false
+// when messages were missed while they were loading
+func (m *MarketDataManager) load(symbol string, orderbook rest.OrderBook, ticker rest.Ticker, requested time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.symbols[symbol]
+	if !ok {
+		return true
+	}
+	if state.reload {
+		state.reload = false
+		return false
+	}
+	state.book.ApplyRest(orderbook)
+	state.book.Symbol = symbol
+	state.ticker = ws.TickerMsg{
+		Symbol:         symbol,
+		Price24H:       ticker.Price24h,
+		Volume24H:      ticker.Volume24h,
+		LastTradePrice: ticker.LastTradePrice,
+	}
+	state.updated = time.Now()
+	state.bootstrapped = true
+	for _, msg := range state.pending {
+		// the snapshots include what was received before they were requested
+		if received := receivedAt(msg); received.IsZero() || !received.Before(requested) {
+			m.applyLocked(symbol, state, msg)
+		}
+	}
+	state.pending = nil
+	return true
+}
+
+// receivedAt returns when a market data message was received, zero when it
+// was not stamped
+func receivedAt(msg interface{}) time.Time {
+	switch msg := msg.(type) {
+	case ws.L2Msg:
+		return msg.Received
+	case ws.TickerMsg:
+		return msg.Received
+	case ws.TradesMsg:
+		return msg.Received
+	}
+	return time.Time{}
+}
+
+// Unwatch stops tracking symbol and closes its event stream. The websocket
+// subscriptions are kept, their messages are ignored.
+func (m *MarketDataManager) Unwatch(symbol string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if state, ok := m.symbols[symbol]; ok {
+		close(state.events)
+		delete(m.symbols, symbol)
+	}
+}
+
+// Watchlist returns the watched symbols, sorted
+func (m *MarketDataManager) Watchlist() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	symbols := make([]string, 0, len(m.symbols))
+	for symbol := range m.symbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Snapshot returns the current state of symbol, false when it is not watched
+func (m *MarketDataManager) Snapshot(symbol string) (MarketSnapshot, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state, ok := m.symbols[symbol]
+	if !ok {
+		return MarketSnapshot{}, false
+	}
+	return MarketSnapshot{
+		Symbol:        symbol,
+		Book:          state.book.Clone(),
+		Ticker:        state.ticker,
+		LastTrade:     state.lastTrade,
+		Updated:       state.updated,
+		Bootstrapped:  state.bootstrapped,
+		Resyncs:       state.resyncs,
+		DroppedEvents: state.dropped,
+	}, true
+}
+
+// Events returns the stream of updates of symbol, nil when it is not watched.
+// It is closed by Unwatch and Stop.
+func (m *MarketDataManager) Events(symbol string) <-chan MarketEvent {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state, ok := m.symbols[symbol]
+	if !ok {
+		return nil
+	}
+	return state.events
+}
+
+func (m *MarketDataManager) apply(symbol string, msg interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.symbols[symbol]
+	if !ok {
+		return
+	}
+	if !state.bootstrapped {
+		state.pending = append(state.pending, msg)
+		return
+	}
+	m.applyLocked(symbol, state, msg)
+}
+
+func (m *MarketDataManager) applyLocked(symbol string, state *marketState, msg interface{}) {
+	switch msg := msg.(type) {
+	case ws.L2Msg:
+		state.book.ApplyL2(msg)
+	case ws.TickerMsg:
+		state.ticker = msg
+	case ws.TradesMsg:
+		state.lastTrade = msg
+		state.ticker.LastTradePrice = msg.Price
+	}
+	state.updated = time.Now()
+	select {
+	case state.events <- MarketEvent{symbol, msg}:
+	default:
+		state.dropped++
+	}
+}
@@ -0,0 +1,145 @@
+package bcex_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	bcex "github.com/hmedkouri/go-bcex"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/rest/resttest"
+	"github.com/hmedkouri/go-bcex/ws"
+	"github.com/hmedkouri/go-bcex/ws/wstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func nextEvent(t *testing.T, events <-chan bcex.MarketEvent) bcex.MarketEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(t, "no market event received")
+		return bcex.MarketEvent{}
+	}
+}
+
+func TestMarketDataManager(t *testing.T) {
+	api := resttest.NewFakeAPI()
+	streamer := wstest.NewFakeStreamer(16)
+	api.GetL2OrderbookFunc = func(market string) (rest.OrderBook, error) {
+		// an update received while the snapshot is loading is applied on top of it
+		streamer.Publish(ws.L2Msg{Event: "updated", Symbol: market, Seqnum: 2, Bids: []ws.Level{{Px: 99, Qty: 5, Num: 2}}})
+		return rest.OrderBook{
+			Symbol: market,
+			Bids:   []rest.OrderBookEntry{{Px: 99, Qty: 1}, {Px: 98, Qty: 1}},
+			Asks:   []rest.OrderBookEntry{{Px: 101, Qty: 1}},
+		}, nil
+	}
+	api.GetTickerFunc = func(market string) (rest.Ticker, error) {
+		return rest.Ticker{Symbol: market, Price24h: 90, Volume24h: 1000, LastTradePrice: 100}, nil
+	}
+
+	m := bcex.NewMarketDataManager(api, streamer, bcex.MarketDataOptions{})
+	m.Start()
+	defer m.Stop()
+	require.NoError(t, m.Watch("BTC-USD", "ETH-USD", "BTC-USD"))
+	require.Equal(t, []string{"BTC-USD", "ETH-USD"}, m.Watchlist())
+	require.Len(t, streamer.CallsTo("SubscribeToL2"), 2)
+	require.Len(t, streamer.CallsTo("SubscribeToTrades"), 2)
+
+	events := m.Events("BTC-USD")
+	event := nextEvent(t, events)
+	require.Equal(t, 2, event.Msg.(ws.L2Msg).Seqnum)
+
+	snapshot, ok := m.Snapshot("BTC-USD")
+	require.True(t, ok)
+	require.True(t, snapshot.Bootstrapped)
+	require.Equal(t, 5.0, snapshot.Book.Qty(model.BUY, 99))
+	require.Equal(t, 1.0, snapshot.Book.Qty(model.BUY, 98))
+	require.Equal(t, 100.0, snapshot.Ticker.LastTradePrice)
+
+	streamer.Publish(ws.TradesMsg{Event: "updated", Symbol: "BTC-USD", Price: 101, Qty: 0.5})
+	streamer.Publish(ws.TradesMsg{Event: "updated", Symbol: "LTC-USD", Price: 50, Qty: 1})
+	event = nextEvent(t, events)
+	require.Equal(t, "BTC-USD", event.Symbol)
+	snapshot, _ = m.Snapshot("BTC-USD")
+	require.Equal(t, 101.0, snapshot.LastTrade.Price)
+	require.Equal(t, 101.0, snapshot.Ticker.LastTradePrice)
+
+	streamer.Publish(ws.TickerMsg{Event: "updated", Symbol: "BTC-USD", LastTradePrice: 102})
+	event = nextEvent(t, events)
+	require.Equal(t, 102.0, event.Msg.(ws.TickerMsg).LastTradePrice)
+	require.Zero(t, m.DroppedMessages())
+
+	ethEvents := m.Events("ETH-USD")
+	m.Unwatch("ETH-USD")
+	_, ok = m.Snapshot("ETH-USD")
+	require.False(t, ok)
+	require.Nil(t, m.Events("ETH-USD"))
+	require.Equal(t, "ETH-USD", nextEvent(t, ethEvents).Symbol)
+	_, open := <-ethEvents
+	require.False(t, open)
+}
+
+func TestMarketDataManagerBootstrapError(t *testing.T) {
+	api := resttest.NewFakeAPI()
+	api.GetTickerFunc = func(market string) (rest.Ticker, error) {
+		return rest.Ticker{}, errors.New("unavailable")
+	}
+	m := bcex.NewMarketDataManager(api, wstest.NewFakeStreamer(1), bcex.MarketDataOptions{})
+	require.Error(t, m.Watch("BTC-USD"))
+	require.Empty(t, m.Watchlist())
+	// stopping a manager never started returns
+	m.Stop()
+
+	streamer := wstest.NewFakeStreamer(1)
+	streamer.SubscribeToTickerFunc = func(symbol ws.Symbol) error {
+		return errors.New("rejected")
+	}
+	m = bcex.NewMarketDataManager(resttest.NewFakeAPI(), streamer, bcex.MarketDataOptions{})
+	require.EqualError(t, m.Watch("BTC-USD"), "subscribing to ticker BTC-USD: rejected")
+	require.Empty(t, m.Watchlist())
+	require.Empty(t, streamer.CallsTo("SubscribeToTrades"))
+}
+
+func TestMarketDataManagerResync(t *testing.T) {
+	api := resttest.NewFakeAPI()
+	streamer := wstest.NewFakeStreamer(16)
+	loads := 0
+	api.GetL2OrderbookFunc = func(market string) (rest.OrderBook, error) {
+		loads++
+		if loads == 1 {
+			return rest.OrderBook{Symbol: market, Bids: []rest.OrderBookEntry{{Px: 99, Qty: 1}}}, nil
+		}
+		return rest.OrderBook{Symbol: market, Bids: []rest.OrderBookEntry{{Px: 98, Qty: 2}}}, nil
+	}
+
+	m := bcex.NewMarketDataManager(api, streamer, bcex.MarketDataOptions{})
+	m.Start()
+	defer m.Stop()
+	require.NoError(t, m.Watch("BTC-USD"))
+
+	// a sequence gap reloads the snapshots, discarding the messages received before
+	streamer.SetHealth(ws.Health{SequenceGaps: 1})
+	streamer.Publish(ws.L2Msg{Event: "updated", Symbol: "BTC-USD", Bids: []ws.Level{{Px: 97, Qty: 7}}, Received: time.Now().Add(-time.Minute)})
+	streamer.Publish(ws.L2Msg{Event: "updated", Symbol: "BTC-USD", Bids: []ws.Level{{Px: 96, Qty: 3}}, Received: time.Now().Add(time.Minute)})
+
+	events := m.Events("BTC-USD")
+	event := nextEvent(t, events)
+	require.Equal(t, 96.0, event.Msg.(ws.L2Msg).Bids[0].Px)
+	snapshot, _ := m.Snapshot("BTC-USD")
+	require.True(t, snapshot.Bootstrapped)
+	require.Equal(t, 1, snapshot.Resyncs)
+	require.Equal(t, 2, loads)
+	require.Zero(t, snapshot.Book.Qty(model.BUY, 99))
+	require.Zero(t, snapshot.Book.Qty(model.BUY, 97))
+	require.Equal(t, 2.0, snapshot.Book.Qty(model.BUY, 98))
+	require.Equal(t, 3.0, snapshot.Book.Qty(model.BUY, 96))
+	select {
+	case event := <-events:
+		require.FailNow(t, "unexpected event", "%+v", event)
+	default:
+	}
+}
@@ -0,0 +1,49 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hmedkouri/go-bcex/metrics"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	r := metrics.NewRegistry()
+	requests := r.Counter("requests_total", "Requests by path.", "path")
+	requests.Inc("/b")
+	requests.Add(2, `/a"\`)
+	r.Counter("requests_total", "Requests by path.", "path").Inc("/b")
+	require.Panics(t, func() { r.Gauge("requests_total", "Requests.", "path") })
+	require.Panics(t, func() { requests.Inc() })
+
+	sessions := r.Gauge("sessions", "Open sessions.")
+	r.OnCollect(func() { sessions.Set(3) })
+	duration := r.Histogram("duration_seconds", "Duration.\nIn seconds.", []float64{1, 0.1})
+	for _, v := range []float64{0.05, 0.1, 0.5, 2} {
+		duration.Observe(v)
+	}
+	r.Gauge("unused", "No series.")
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	body, _ := io.ReadAll(rec.Body)
+	require.Equal(t, `# HELP duration_seconds Duration.\nIn seconds.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="0.1"} 2
+duration_seconds_bucket{le="1"} 3
+duration_seconds_bucket{le="+Inf"} 4
+duration_seconds_sum 2.65
+duration_seconds_count 4
+# HELP requests_total Requests by path.
+# TYPE requests_total counter
+requests_total{path="/a\"\\"} 2
+requests_total{path="/b"} 2
+# HELP sessions Open sessions.
+# TYPE sessions gauge
+sessions 3
+`, string(body))
+}
@@ -0,0 +1,320 @@
+// Package model defines the transport-neutral domain types shared by the rest
+// and ws packages, so application code does not depend on which API produced
+// the data.
+package model
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Side of an order or a trade
+type Side string
+
+// List of Side
+const (
+	BUY  Side = "buy"
+	SELL Side = "sell"
+)
+
+// OrderType of an order
+type OrderType string
+
+// List of OrderType
+const (
+	MARKET     OrderType = "market"
+	LIMIT      OrderType = "limit"
+	STOP       OrderType = "stop"
+	STOP_LIMIT OrderType = "stopLimit"
+)
+
+// OrderStatus of an order
+type OrderStatus string
+
+// List of OrderStatus
+const (
+	PENDING   OrderStatus = "pending"
+	OPEN      OrderStatus = "open"
+	PARTIAL   OrderStatus = "partial"
+	FILLED    OrderStatus = "filled"
+	CANCELLED OrderStatus = "cancelled"
+	REJECTED  OrderStatus = "rejected"
+	EXPIRED   OrderStatus = "expired"
+)
+
+// TimeInForce of an order
+type TimeInForce string
+
+// List of TimeInForce
+const (
+	GTC TimeInForce = "GTC"
+	GTD TimeInForce = "GTD"
+	IOC TimeInForce = "IOC"
+	FOK TimeInForce = "FOK"
+)
+
+// normalize lower-cases s and strips the separators the two APIs disagree on
+func normalize(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.ReplaceAll(s, "_", "")
+	s = strings.ReplaceAll(s, "-", "")
+	return s
+}
+
+// ParseSide converts a side as sent by either API ("BUY", "buy") into a Side
+func ParseSide(s string) (Side, error) {
+	switch normalize(s) {
+	case "buy":
+		return BUY, nil
+	case "sell":
+		return SELL, nil
+	}
+	return "", fmt.Errorf("unknown side %q", s)
+}
+
+// ParseOrderType converts an order type as sent by either API ("STOPLIMIT", "stopLimit") into an OrderType
+func ParseOrderType(s string) (OrderType, error) {
+	switch normalize(s) {
+	case "market":
+		return MARKET, nil
+	case "limit":
+		return LIMIT, nil
+	case "stop":
+		return STOP, nil
+	case "stoplimit":
+		return STOP_LIMIT, nil
+	}
+	return "", fmt.Errorf("unknown order type %q", s)
+}
+
+// ParseOrderStatus converts an order status as sent by either API ("PART_FILLED", "partial") into an OrderStatus
+func ParseOrderStatus(s string) (OrderStatus, error) {
+	switch normalize(s) {
+	case "pending":
+		return PENDING, nil
+	case "open", "new":
+		return OPEN, nil
+	case "partial", "partfilled", "partiallyfilled":
+		return PARTIAL, nil
+	case "filled":
+		return FILLED, nil
+	case "cancelled", "canceled":
+		return CANCELLED, nil
+	case "rejected":
+		return REJECTED, nil
+	case "expired":
+		return EXPIRED, nil
+	}
+	return "", fmt.Errorf("unknown order status %q", s)
+}
+
+// ParseTimeInForce converts a time in force as sent by either API into a TimeInForce
+func ParseTimeInForce(s string) (TimeInForce, error) {
+	switch normalize(s) {
+	case "gtc":
+		return GTC, nil
+	case "gtd":
+		return GTD, nil
+	case "ioc":
+		return IOC, nil
+	case "fok":
+		return FOK, nil
+	}
+	return "", fmt.Errorf("unknown time in force %q", s)
+}
+
+// IsTerminal reports whether no further executions can happen in this status
+func (s OrderStatus) IsTerminal() bool {
+	switch s {
+	case FILLED, CANCELLED, REJECTED, EXPIRED:
+		return true
+	}
+	return false
+}
+
+// Opposite returns the other side of the book
+func (s Side) Opposite() Side {
+	if s == BUY {
+		return SELL
+	}
+	return BUY
+}
+
+// OrderRequest describes an order to be placed, whatever the transport
+type OrderRequest struct {
+	// Reference field provided by client. Cannot exceed 20 characters, only alphanumeric characters are allowed.
+	ClOrdID     string
+	Symbol      string
+	Side        Side
+	Type        OrderType
+	TimeInForce TimeInForce
+	// The order size in the terms of the base currency
+	Qty float64
+	// The limit price for the order
+	Price float64
+	// The stop/trigger price for stop and stop-limit orders
+	StopPx float64
+	// The minimum quantity required for an IOC fill
+	MinQty float64
+	// Expiry date for GTD orders
+	ExpireDate time.Time
+	// Add Liquidity Only: the order is rejected rather than executed as taker
+	PostOnly bool
+}
+
+// Order is the state of an order as last reported by the exchange
+type Order struct {
+	// The unique order id assigned by the exchange
+	OrderID     string
+	ClOrdID     string
+	Symbol      string
+	Side        Side
+	Type        OrderType
+	TimeInForce TimeInForce
+	Status      OrderStatus
+	Price       float64
+	OrderQty    float64
+	LeavesQty   float64
+	CumQty      float64
+	AvgPx       float64
+	// The reason for rejecting the order, if applicable
+	Text string
+	Time time.Time
+}
+
+// Fill is a single execution of an order
+type Fill struct {
+	TradeID string
+	OrderID string
+	ClOrdID string
+	Symbol  string
+	Side    Side
+	Price   float64
+	Qty     float64
+	Fee     float64
+	Time    time.Time
+}
+
+// Balance of a single currency in the account
+type Balance struct {
+	Currency       string
+	Balance        float64
+	Available      float64
+	BalanceLocal   float64
+	AvailableLocal float64
+	Rate           float64
+}
+
+// Symbol reference data of a market
+type Symbol struct {
+	Name                   string
+	ID                     int64
+	BaseCurrency           string
+	BaseCurrencyScale      int
+	CounterCurrency        string
+	CounterCurrencyScale   int
+	MinPriceIncrement      int64
+	MinPriceIncrementScale int
+	MinOrderSize           int64
+	MinOrderSizeScale      int
+	MaxOrderSize           int64
+	MaxOrderSizeScale      int
+	LotSize                int64
+	LotSizeScale           int
+	// Symbol status; open, close, suspend, halt, halt-freeze.
+	Status       string
+	AuctionPrice float64
+	AuctionSize  float64
+	// Opening time in HHMM format
+	AuctionTime string
+	Imbalance   float64
+}
+
+func scaled(v int64, scale int) float64 {
+	return float64(v) * math.Pow10(-scale)
+}
+
+// TickSize returns the minimum price increment
+func (s Symbol) TickSize() float64 {
+	return scaled(s.MinPriceIncrement, s.MinPriceIncrementScale)
+}
+
+// MinQty returns the minimum order quantity
+func (s Symbol) MinQty() float64 {
+	return scaled(s.MinOrderSize, s.MinOrderSizeScale)
+}
+
+// MaxQty returns the maximum order quantity, zero meaning no limit
+func (s Symbol) MaxQty() float64 {
+	return scaled(s.MaxOrderSize, s.MaxOrderSizeScale)
+}
+
+// LotQty returns the quantity increment
+func (s Symbol) LotQty() float64 {
+	return scaled(s.LotSize, s.LotSizeScale)
+}
+
+// Candle is an OHLCV bar, built from trades or received from the exchange
+type Candle struct {
+	Symbol string
+	// Start of the bar, the time of its first trade for tick, volume and dollar bars
+	Start time.Time
+	// End of the bar, exclusive for time bars, the time of the last trade otherwise
+	End    time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+	// Notional traded, zero when the source does not provide it
+	Notional float64
+	// Trades is the number of trades in the bar, zero when the source does not provide it
+	Trades int
+}
+
+// VWAP returns the volume weighted average price of the bar, the close when
+// the notional is unknown
+func (c Candle) VWAP() float64 {
+	if c.Volume <= 0 || c.Notional <= 0 {
+		return c.Close
+	}
+	return c.Notional / c.Volume
+}
+
+// FillCandleGaps returns candles, which must be sorted by start, with flat
+// bars at the previous close inserted for the intervals without a candle
+// between the first candle and to. Nothing is added before the first candle.
+func FillCandleGaps(candles []Candle, interval time.Duration, to time.Time) []Candle {
+	if len(candles) == 0 || interval <= 0 {
+		return candles
+	}
+	filled := make([]Candle, 0, len(candles))
+	for i, c := range candles {
+		if i > 0 {
+			last := filled[len(filled)-1]
+			for next := last.Start.Add(interval); next.Before(c.Start); next = next.Add(interval) {
+				filled = append(filled, flatCandle(last, next, interval))
+			}
+		}
+		filled = append(filled, c)
+	}
+	last := filled[len(filled)-1]
+	for next := last.Start.Add(interval); !to.IsZero() && next.Before(to); next = next.Add(interval) {
+		filled = append(filled, flatCandle(last, next, interval))
+	}
+	return filled
+}
+
+func flatCandle(previous Candle, start time.Time, interval time.Duration) Candle {
+	return Candle{
+		Symbol: previous.Symbol,
+		Start:  start,
+		End:    start.Add(interval),
+		Open:   previous.Close,
+		High:   previous.Close,
+		Low:    previous.Close,
+		Close:  previous.Close,
+	}
+}
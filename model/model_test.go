@@ -0,0 +1,73 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	sides := map[string]model.Side{"BUY": model.BUY, "buy": model.BUY, "SELL": model.SELL, "sell": model.SELL}
+	for in, expected := range sides {
+		side, err := model.ParseSide(in)
+		require.NoError(t, err)
+		require.Equal(t, expected, side, in)
+	}
+
+	types := map[string]model.OrderType{"STOPLIMIT": model.STOP_LIMIT, "stopLimit": model.STOP_LIMIT, "MARKET": model.MARKET, "limit": model.LIMIT}
+	for in, expected := range types {
+		ordType, err := model.ParseOrderType(in)
+		require.NoError(t, err)
+		require.Equal(t, expected, ordType, in)
+	}
+
+	statuses := map[string]model.OrderStatus{"PART_FILLED": model.PARTIAL, "partial": model.PARTIAL, "CANCELED": model.CANCELLED, "cancelled": model.CANCELLED, "OPEN": model.OPEN}
+	for in, expected := range statuses {
+		status, err := model.ParseOrderStatus(in)
+		require.NoError(t, err)
+		require.Equal(t, expected, status, in)
+	}
+
+	_, err := model.ParseSide("hold")
+	require.Error(t, err)
+}
+
+func TestRestAndWsAgree(t *testing.T) {
+	restOrder := rest.OrderSummary{
+		ExOrdId:   42,
+		ClOrdId:   "abc",
+		OrdType:   rest.STOPLIMIT,
+		OrdStatus: rest.PART_FILLED,
+		Side:      rest.BUY,
+		Price:     100,
+		Symbol:    "BTC-USD",
+		LeavesQty: 1,
+		CumQty:    2,
+	}
+	wsOrder := ws.Order{
+		OrderID:   "42",
+		ClOrdID:   "abc",
+		Symbol:    "BTC-USD",
+		Side:      string(ws.BUY),
+		OrdType:   string(ws.STOP_LIMIT),
+		OrderQty:  3,
+		LeavesQty: 1,
+		CumQty:    2,
+		OrdStatus: string(ws.ORDER_STATUS_PARTIAL),
+		Price:     100,
+	}
+	require.Equal(t, restOrder.ToModel(), wsOrder.ToModel())
+
+	request := model.OrderRequest{ClOrdID: "abc", Symbol: "BTC-USD", Side: model.SELL, Type: model.STOP_LIMIT, Qty: 1, Price: 10}
+	require.Equal(t, rest.STOPLIMIT, rest.NewBaseOrder(request).OrdType)
+	require.Equal(t, rest.SELL, rest.NewBaseOrder(request).Side)
+	require.Empty(t, rest.NewBaseOrder(request).ExecInst)
+	request.PostOnly = true
+	require.Equal(t, rest.ALO, rest.NewBaseOrder(request).ExecInst)
+	require.Equal(t, ws.STOP_LIMIT, ws.NewOrderSingleFromModel(request).OrdType)
+	require.Equal(t, ws.SELL, ws.NewOrderSingleFromModel(request).Side)
+}
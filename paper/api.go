@@ -0,0 +1,214 @@
+package paper
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	bcex "github.com/hmedkouri/go-bcex"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+var _ bcex.Trader = (*Exchange)(nil)
+
+// CreateOrder places an order as rest.Client.CreateOrder does. Rejected orders,
+// including those with an unknown side, order type or time in force, are
+// returned with the REJECTED status rather than an error.
+func (e *Exchange) CreateOrder(requestOrder rest.BaseOrder) (rest.OrderSummary, error) {
+	o := &order{
+		clOrdID:  requestOrder.ClOrdId,
+		symbol:   requestOrder.Symbol,
+		price:    requestOrder.Price,
+		stopPx:   requestOrder.StopPx,
+		minQty:   requestOrder.MinQty,
+		qty:      requestOrder.OrderQty,
+		expire:   parseExpireDate(int(requestOrder.ExpireDate)),
+		postOnly: requestOrder.ExecInst == rest.ALO,
+	}
+	o.parse(string(requestOrder.Side), string(requestOrder.OrdType), string(requestOrder.TimeInForce))
+	e.mu.Lock()
+	e.submit(o)
+	summary := o.toSummary()
+	e.mu.Unlock()
+	e.flush()
+	return summary, nil
+}
+
+// DeleteOrderById cancels an order as rest.Client.DeleteOrderById does
+func (e *Exchange) DeleteOrderById(orderId int64) error {
+	e.mu.Lock()
+	o, ok := e.live(orderId)
+	if ok {
+		e.cancel(o, "")
+	}
+	e.mu.Unlock()
+	e.flush()
+	if !ok {
+		return &rest.APIError{Status: http.StatusNotFound, Message: ErrOrderNotFound.Error()}
+	}
+	return nil
+}
+
+// DeleteAllOrders cancels the live orders as rest.Client.DeleteAllOrders does
+func (e *Exchange) DeleteAllOrders(options *rest.DeleteAllOrdersOpts) error {
+	var symbol string
+	if options != nil {
+		symbol = options.Symbol
+	}
+	e.mu.Lock()
+	e.cancelMatching(symbol)
+	e.mu.Unlock()
+	e.flush()
+	return nil
+}
+
+// GetOrderById returns an order as rest.Client.GetOrderById does
+func (e *Exchange) GetOrderById(orderId int64) (rest.OrderSummary, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, ok := e.orders[orderId]
+	if !ok {
+		return rest.OrderSummary{}, &rest.APIError{Status: http.StatusNotFound, Message: ErrOrderNotFound.Error()}
+	}
+	return o.toSummary(), nil
+}
+
+// GetFees returns the configured fees as rest.Client.GetFees does
+func (e *Exchange) GetFees() (rest.Fees, error) {
+	return e.cfg.Fees, nil
+}
+
+// NewOrderSingleMessage places an order as WebSocketClient.NewOrderSingleMessage
+// does. The outcome is reported on Trading(), orders with an unknown side,
+// order type or time in force being rejected.
+func (e *Exchange) NewOrderSingleMessage(msg ws.NewOrderSingleMsg) error {
+	o := &order{
+		clOrdID:  msg.ClOrdID,
+		symbol:   string(msg.Symbol),
+		price:    msg.Price,
+		stopPx:   msg.StopPx,
+		minQty:   msg.MinQty,
+		qty:      msg.OrderQty,
+		postOnly: msg.ExecInst == ws.ALO,
+		expire:   parseExpireDate(msg.ExpireDate),
+	}
+	o.parse(string(msg.Side), string(msg.OrdType), string(msg.TimeInForce))
+	e.mu.Lock()
+	e.submit(o)
+	e.mu.Unlock()
+	e.flush()
+	return nil
+}
+
+// CancelOrder cancels an order as WebSocketClient.CancelOrder does. Unknown
+// orders are reported with a TradingReject on Trading().
+func (e *Exchange) CancelOrder(orderID string) error {
+	id, _ := strconv.ParseInt(orderID, 10, 64)
+	e.mu.Lock()
+	if o, ok := e.live(id); ok {
+		e.cancel(o, "")
+	} else {
+		e.reject("CancelOrderRequest", "", "Unknown order "+orderID)
+	}
+	e.mu.Unlock()
+	e.flush()
+	return nil
+}
+
+// BulkCancel cancels the live orders as WebSocketClient.BulkCancel does
+func (e *Exchange) BulkCancel(symbol *ws.Symbol) error {
+	var s string
+	if symbol != nil {
+		s = string(*symbol)
+	}
+	e.mu.Lock()
+	e.cancelMatching(s)
+	e.mu.Unlock()
+	e.flush()
+	return nil
+}
+
+// PlaceOrder places a model order request and returns the resulting order state
+func (e *Exchange) PlaceOrder(request model.OrderRequest) (model.Order, error) {
+	e.mu.Lock()
+	o := e.submit(&order{
+		clOrdID:     request.ClOrdID,
+		symbol:      request.Symbol,
+		side:        request.Side,
+		ordType:     request.Type,
+		timeInForce: request.TimeInForce,
+		price:       request.Price,
+		stopPx:      request.StopPx,
+		minQty:      request.MinQty,
+		qty:         request.Qty,
+		postOnly:    request.PostOnly,
+		expire:      endOfDay(request.ExpireDate),
+	})
+	result := o.toModel()
+	e.mu.Unlock()
+	e.flush()
+	return result, nil
+}
+
+// CancelAll cancels the live orders of symbol, of every symbol when empty
+func (e *Exchange) CancelAll(symbol string) error {
+	e.mu.Lock()
+	e.cancelMatching(symbol)
+	e.mu.Unlock()
+	e.flush()
+	return nil
+}
+
+// GetOrder returns the state of an order
+func (e *Exchange) GetOrder(orderID string) (model.Order, error) {
+	id, _ := strconv.ParseInt(orderID, 10, 64)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, ok := e.orders[id]
+	if !ok {
+		return model.Order{}, ErrOrderNotFound
+	}
+	return o.toModel(), nil
+}
+
+// OpenOrders returns the live orders of symbol, of every symbol when empty, oldest first
+func (e *Exchange) OpenOrders(symbol string) ([]model.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var orders []model.Order
+	for _, o := range e.liveOrders(symbol) {
+		orders = append(orders, o.toModel())
+	}
+	return orders, nil
+}
+
+// parse sets the side, order type and time in force of the order from the
+// fields of a request, keeping why they are invalid for validate to reject it.
+// An empty time in force is left for submit to default to GTC.
+func (o *order) parse(side, ordType, timeInForce string) {
+	var err error
+	if o.side, err = model.ParseSide(side); err != nil {
+		o.invalid = err.Error()
+		return
+	}
+	if o.ordType, err = model.ParseOrderType(ordType); err != nil {
+		o.invalid = err.Error()
+		return
+	}
+	if timeInForce == "" {
+		return
+	}
+	if o.timeInForce, err = model.ParseTimeInForce(timeInForce); err != nil {
+		o.invalid = err.Error()
+	}
+}
+
+func endOfDay(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Add(24*time.Hour - time.Nanosecond)
+}
@@ -0,0 +1,613 @@
+// Package paper is a simulated exchange for paper trading. It keeps a local
+// order book from live l2/l3 and trades messages and matches orders placed
+// through the same calls as rest.Client and ws.WebSocketClient against it.
+package paper
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/book"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// quantities below epsilon are considered zero
+const epsilon = 1e-12
+
+// ErrOrderNotFound is returned when an order id is unknown or the order is no longer live
+var ErrOrderNotFound = errors.New("order not found")
+
+// Config of an Exchange
+type Config struct {
+	// Fees applied to executions, makerRate for resting orders and takerRate for aggressing ones
+	Fees rest.Fees
+	// Now returns the current time, time.Now when nil. Backtests provide a simulated clock.
+	Now func() time.Time
+	// TradingBuffer is the capacity of the Trading() channel, 1024 when zero
+	TradingBuffer int
+	// OnReport, when set, receives the execution reports synchronously instead of the Trading() channel
+	OnReport func(msg ws.TradingMsg)
+	// QueueAhead returns the quantity assumed ahead of an order joining a price
+	// level holding levelQty. The whole level, i.e. the back of the queue, when nil.
+	QueueAhead func(levelQty float64) float64
+}
+
+type order struct {
+	id          int64
+	clOrdID     string
+	symbol      string
+	side        model.Side
+	ordType     model.OrderType
+	timeInForce model.TimeInForce
+	price       float64
+	stopPx      float64
+	minQty      float64
+	qty         float64
+	postOnly    bool
+	expire      time.Time
+	status      model.OrderStatus
+	leavesQty   float64
+	cumQty      float64
+	notional    float64
+	// quantity resting ahead of the order on its price level
+	queueAhead float64
+	text       string
+	updated    time.Time
+	// invalid is why the request could not be parsed, empty when it could
+	invalid string
+}
+
+func (o *order) avgPx() float64 {
+	if o.cumQty <= 0 {
+		return 0
+	}
+	return o.notional / o.cumQty
+}
+
+// crosses reports whether the order can trade at price
+func (o *order) crosses(price float64) bool {
+	switch {
+	case o.ordType == model.MARKET || o.ordType == model.STOP:
+		return true
+	case o.side == model.BUY:
+		return price <= o.price
+	default:
+		return price >= o.price
+	}
+}
+
+// Exchange is a simulated exchange matching orders against the market data it is fed
+type Exchange struct {
+	cfg Config
+
+	mu          sync.Mutex
+	books       map[string]*book.Book
+	lastPx      map[string]float64
+	orders      map[int64]*order
+	open        map[int64]*order
+	clOrdIDs    map[string]*order
+	queues      map[sideKey][]*order
+	stops       map[string][]*order
+	expiries    expiryHeap
+	nextOrderID int64
+	nextExecID  int64
+	seqnum      int
+	fills       []model.Fill
+	pending     []ws.TradingMsg
+	flushing    bool
+
+	chTrading chan ws.TradingMsg
+}
+
+// NewExchange returns an empty simulated exchange
+func NewExchange(cfg Config) *Exchange {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.TradingBuffer <= 0 {
+		cfg.TradingBuffer = 1024
+	}
+	return &Exchange{
+		cfg:       cfg,
+		books:     make(map[string]*book.Book),
+		lastPx:    make(map[string]float64),
+		orders:    make(map[int64]*order),
+		open:      make(map[int64]*order),
+		clOrdIDs:  make(map[string]*order),
+		queues:    make(map[sideKey][]*order),
+		stops:     make(map[string][]*order),
+		chTrading: make(chan ws.TradingMsg, cfg.TradingBuffer),
+	}
+}
+
+// Trading returns the channel receiving execution reports, as WebSocketClient.Trading does
+func (e *Exchange) Trading() chan ws.TradingMsg {
+	return e.chTrading
+}
+
+func (e *Exchange) book(symbol string) *book.Book {
+	b, ok := e.books[symbol]
+	if !ok {
+		b = book.New(symbol)
+		e.books[symbol] = b
+	}
+	return b
+}
+
+// Book returns a copy of the local book of symbol
+func (e *Exchange) Book(symbol string) *book.Book {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.book(symbol).Clone()
+}
+
+// OnL2 applies an l2 message to the local book and fills resting orders the market moved through
+func (e *Exchange) OnL2(msg ws.L2Msg) {
+	e.mu.Lock()
+	e.expire()
+	e.book(msg.Symbol).ApplyL2(msg)
+	e.matchBook(msg.Symbol)
+	e.mu.Unlock()
+	e.flush()
+}
+
+// OnL3 applies an l3 message to the local book and fills resting orders the market moved through
+func (e *Exchange) OnL3(msg ws.L3Msg) {
+	e.mu.Lock()
+	e.expire()
+	e.book(msg.Symbol).ApplyL3(msg)
+	e.matchBook(msg.Symbol)
+	e.mu.Unlock()
+	e.flush()
+}
+
+// OnRestBook replaces the local book with a Rest snapshot
+func (e *Exchange) OnRestBook(orderbook rest.OrderBook) {
+	e.mu.Lock()
+	e.expire()
+	e.book(orderbook.Symbol).ApplyRest(orderbook)
+	e.matchBook(orderbook.Symbol)
+	e.mu.Unlock()
+	e.flush()
+}
+
+// OnTrade triggers stop orders and fills resting orders the trade reached,
+// once the liquidity queued ahead of them on their price level is consumed
+func (e *Exchange) OnTrade(msg ws.TradesMsg) {
+	e.mu.Lock()
+	e.expire()
+	e.lastPx[msg.Symbol] = msg.Price
+	e.triggerStops(msg.Symbol, msg.Price)
+	e.matchTrade(msg)
+	e.mu.Unlock()
+	e.flush()
+}
+
+// Advance expires the GTD orders past their date, for use when the clock moves without market data
+func (e *Exchange) Advance() {
+	e.mu.Lock()
+	e.expire()
+	e.mu.Unlock()
+	e.flush()
+}
+
+// submit validates and processes a new order
+func (e *Exchange) submit(o *order) *order {
+	e.nextOrderID++
+	o.id = e.nextOrderID
+	o.leavesQty = o.qty
+	o.updated = e.cfg.Now()
+	if o.timeInForce == "" {
+		o.timeInForce = model.GTC
+	}
+
+	if reason := e.validate(o); reason != "" {
+		o.status = model.REJECTED
+		o.text = reason
+		e.orders[o.id] = o
+		e.report(o, ws.EXEC_TYPE_REJECTED, 0, 0, "")
+		return o
+	}
+	e.orders[o.id] = o
+	e.index(o)
+
+	if o.ordType == model.STOP || o.ordType == model.STOP_LIMIT {
+		o.status = model.PENDING
+		e.stops[o.symbol] = append(e.stops[o.symbol], o)
+		e.report(o, ws.EXEC_TYPE_PENDING, 0, 0, "")
+		return o
+	}
+	e.activate(o)
+	return o
+}
+
+// validate returns why the order is rejected, empty when it is accepted
+func (e *Exchange) validate(o *order) string {
+	switch {
+	case o.invalid != "":
+		return o.invalid
+	case o.side != model.BUY && o.side != model.SELL:
+		return "Invalid side"
+	case o.ordType != model.MARKET && o.ordType != model.LIMIT && o.ordType != model.STOP && o.ordType != model.STOP_LIMIT:
+		return "Invalid order type"
+	case o.timeInForce != model.GTC && o.timeInForce != model.GTD && o.timeInForce != model.IOC && o.timeInForce != model.FOK:
+		return "Invalid time in force"
+	case o.qty <= 0:
+		return "Invalid order quantity"
+	case (o.ordType == model.LIMIT || o.ordType == model.STOP_LIMIT) && o.price <= 0:
+		return "Invalid price"
+	case (o.ordType == model.STOP || o.ordType == model.STOP_LIMIT) && o.stopPx <= 0:
+		return "Invalid stop price"
+	case o.timeInForce == model.GTD && o.expire.IsZero():
+		return "Missing expire date"
+	case o.timeInForce == model.GTD && !o.expire.After(e.cfg.Now()):
+		return "Expire date in the past"
+	case o.postOnly && o.ordType != model.LIMIT:
+		return "ALO is only valid for limit orders"
+	}
+	if _, ok := e.clOrdIDs[o.clOrdID]; ok && o.clOrdID != "" {
+		return "Duplicate clOrdID"
+	}
+	return ""
+}
+
+// activate matches a new or triggered order and rests what is left of it
+func (e *Exchange) activate(o *order) {
+	b := e.book(o.symbol)
+	opposite := o.side.Opposite()
+
+	if o.postOnly {
+		if levels := b.Side(opposite); len(levels) > 0 && o.crosses(levels[0].Price) {
+			o.status = model.REJECTED
+			o.text = "ALO order would match"
+			e.unindex(o)
+			e.report(o, ws.EXEC_TYPE_REJECTED, 0, 0, "")
+			return
+		}
+	}
+
+	o.status = model.OPEN
+	e.report(o, ws.EXEC_TYPE_NEW, 0, 0, "")
+
+	available := e.available(o)
+	switch {
+	case o.timeInForce == model.FOK && available < o.leavesQty-epsilon:
+		e.cancel(o, "FOK order could not be filled")
+		return
+	case o.timeInForce == model.IOC && o.minQty > 0 && available < o.minQty-epsilon:
+		e.cancel(o, "IOC order could not be filled for its minimum quantity")
+		return
+	}
+
+	for o.leavesQty > epsilon {
+		levels := b.Side(opposite)
+		if len(levels) == 0 || !o.crosses(levels[0].Price) {
+			break
+		}
+		qty := math.Min(levels[0].Qty, o.leavesQty)
+		price := levels[0].Price
+		b.Take(opposite, price, qty)
+		e.fill(o, price, qty, false)
+	}
+
+	if o.leavesQty > epsilon {
+		if o.ordType == model.MARKET || o.ordType == model.STOP || o.timeInForce == model.IOC || o.timeInForce == model.FOK {
+			e.cancel(o, "")
+			return
+		}
+		o.queueAhead = b.Qty(o.side, o.price)
+		if e.cfg.QueueAhead != nil {
+			o.queueAhead = math.Max(0, math.Min(o.queueAhead, e.cfg.QueueAhead(o.queueAhead)))
+		}
+		e.enqueue(o)
+	}
+}
+
+// available returns the quantity the order could take from the book
+func (e *Exchange) available(o *order) float64 {
+	var qty float64
+	for _, level := range e.book(o.symbol).Side(o.side.Opposite()) {
+		if !o.crosses(level.Price) {
+			break
+		}
+		qty += level.Qty
+	}
+	return qty
+}
+
+func (e *Exchange) fill(o *order, price, qty float64, maker bool) {
+	rate := e.cfg.Fees.TakerRate
+	if maker {
+		rate = e.cfg.Fees.MakerRate
+	}
+	o.cumQty += qty
+	o.leavesQty -= qty
+	o.notional += price * qty
+	o.updated = e.cfg.Now()
+	if o.leavesQty <= epsilon {
+		o.leavesQty = 0
+		o.status = model.FILLED
+		e.unindex(o)
+	} else {
+		o.status = model.PARTIAL
+	}
+	e.nextExecID++
+	tradeID := strconv.FormatInt(e.nextExecID, 10)
+	e.fills = append(e.fills, model.Fill{
+		TradeID: tradeID,
+		OrderID: strconv.FormatInt(o.id, 10),
+		ClOrdID: o.clOrdID,
+		Symbol:  o.symbol,
+		Side:    o.side,
+		Price:   price,
+		Qty:     qty,
+		Fee:     price * qty * rate,
+		Time:    o.updated,
+	})
+	e.report(o, ws.EXEC_TYPE_PARTIAL_FILL, price, qty, tradeID)
+}
+
+func (e *Exchange) cancel(o *order, text string) {
+	o.status = model.CANCELLED
+	o.text = text
+	o.updated = e.cfg.Now()
+	e.unindex(o)
+	e.report(o, ws.EXEC_TYPE_CANCELLED, 0, 0, "")
+}
+
+// matchBook fills resting orders at their price when the book crosses them,
+// and shortens their queue when liquidity ahead of them is cancelled
+func (e *Exchange) matchBook(symbol string) {
+	b := e.book(symbol)
+	for _, side := range []model.Side{model.BUY, model.SELL} {
+		opposite := side.Opposite()
+		for _, o := range e.resting(symbol, side) {
+			for o.leavesQty > epsilon {
+				levels := b.Side(opposite)
+				if len(levels) == 0 || !o.crosses(levels[0].Price) {
+					break
+				}
+				qty := math.Min(levels[0].Qty, o.leavesQty)
+				b.Take(opposite, levels[0].Price, qty)
+				e.fill(o, o.price, qty, true)
+			}
+			o.queueAhead = math.Min(o.queueAhead, b.Qty(side, o.price))
+		}
+	}
+}
+
+// matchTrade fills resting orders the printed trade reached
+func (e *Exchange) matchTrade(msg ws.TradesMsg) {
+	aggressor, _ := model.ParseSide(msg.Side)
+	for _, side := range []model.Side{model.BUY, model.SELL} {
+		if aggressor == side {
+			continue
+		}
+		remaining := msg.Qty
+		for _, o := range e.resting(msg.Symbol, side) {
+			if remaining <= epsilon || !o.crosses(msg.Price) {
+				break
+			}
+			if o.price == msg.Price {
+				consumed := math.Min(o.queueAhead, remaining)
+				o.queueAhead -= consumed
+				remaining -= consumed
+			}
+			qty := math.Min(remaining, o.leavesQty)
+			if qty <= epsilon {
+				continue
+			}
+			remaining -= qty
+			e.fill(o, o.price, qty, true)
+		}
+	}
+}
+
+// triggerStops activates the pending stop orders of symbol reached by the trade price
+func (e *Exchange) triggerStops(symbol string, price float64) {
+	stops := e.stops[symbol]
+	pending := stops[:0]
+	var triggered []*order
+	for _, o := range stops {
+		switch {
+		case o.status != model.PENDING:
+		case (o.side == model.BUY && price >= o.stopPx) || (o.side == model.SELL && price <= o.stopPx):
+			triggered = append(triggered, o)
+		default:
+			pending = append(pending, o)
+		}
+	}
+	for i := len(pending); i < len(stops); i++ {
+		stops[i] = nil
+	}
+	e.stops[symbol] = pending
+	for _, o := range triggered {
+		e.activate(o)
+	}
+}
+
+// expire ends the GTD orders past their expiry
+func (e *Exchange) expire() {
+	now := e.cfg.Now()
+	var expired []*order
+	for len(e.expiries) > 0 && now.After(e.expiries[0].expire) {
+		if o := heap.Pop(&e.expiries).(*order); !o.status.IsTerminal() {
+			expired = append(expired, o)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].id < expired[j].id })
+	for _, o := range expired {
+		o.status = model.EXPIRED
+		o.updated = now
+		e.unindex(o)
+		e.report(o, ws.EXEC_TYPE_EXPIRED, 0, 0, "")
+	}
+}
+
+// report queues an execution report for delivery once the lock is released
+func (e *Exchange) report(o *order, execType ws.ExecType, lastPx, lastShares float64, tradeID string) {
+	e.seqnum++
+	e.pending = append(e.pending, &ws.TradingUpdated{
+		Seqnum:       e.seqnum,
+		Event:        "updated",
+		Channel:      "trading",
+		OrderID:      strconv.FormatInt(o.id, 10),
+		ClOrdID:      o.clOrdID,
+		Symbol:       o.symbol,
+		Side:         string(ws.SideFromModel(o.side)),
+		OrdType:      string(ws.OrderTypeFromModel(o.ordType)),
+		OrderQty:     o.qty,
+		LeavesQty:    o.leavesQty,
+		CumQty:       o.cumQty,
+		AvgPx:        o.avgPx(),
+		OrdStatus:    string(ws.OrderStatusFromModel(o.status)),
+		TimeInForce:  string(o.timeInForce),
+		Text:         o.text,
+		ExecType:     string(execType),
+		ExecID:       strconv.Itoa(e.seqnum),
+		TransactTime: o.updated,
+		MsgType:      8,
+		LastPx:       lastPx,
+		LastShares:   lastShares,
+		TradeID:      tradeID,
+		Price:        o.price,
+	})
+}
+
+// reject queues a trading reject for delivery once the lock is released
+func (e *Exchange) reject(action, clOrdID, text string) {
+	e.seqnum++
+	e.pending = append(e.pending, &ws.TradingReject{
+		Seqnum:  e.seqnum,
+		Event:   "rejected",
+		Channel: "trading",
+		Text:    text,
+		ClOrdID: clOrdID,
+		Action:  action,
+	})
+}
+
+// flush delivers the queued reports in order. Reports queued by handlers
+// calling back into the exchange are delivered by the outermost flush.
+func (e *Exchange) flush() {
+	e.mu.Lock()
+	if e.flushing {
+		e.mu.Unlock()
+		return
+	}
+	e.flushing = true
+	for len(e.pending) > 0 {
+		msg := e.pending[0]
+		e.pending = e.pending[1:]
+		e.mu.Unlock()
+		if e.cfg.OnReport != nil {
+			e.cfg.OnReport(msg)
+		} else {
+			e.chTrading <- msg
+		}
+		e.mu.Lock()
+	}
+	e.flushing = false
+	e.mu.Unlock()
+}
+
+// Fills returns every simulated execution so far
+func (e *Exchange) Fills() []model.Fill {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]model.Fill(nil), e.fills...)
+}
+
+func (o *order) toModel() model.Order {
+	return model.Order{
+		OrderID:     strconv.FormatInt(o.id, 10),
+		ClOrdID:     o.clOrdID,
+		Symbol:      o.symbol,
+		Side:        o.side,
+		Type:        o.ordType,
+		TimeInForce: o.timeInForce,
+		Status:      o.status,
+		Price:       o.price,
+		OrderQty:    o.qty,
+		LeavesQty:   o.leavesQty,
+		CumQty:      o.cumQty,
+		AvgPx:       o.avgPx(),
+		Text:        o.text,
+		Time:        o.updated,
+	}
+}
+
+func (o *order) toSummary() rest.OrderSummary {
+	return rest.OrderSummary{
+		ExOrdId:   o.id,
+		ClOrdId:   o.clOrdID,
+		OrdType:   rest.OrdTypeFromModel(o.ordType),
+		OrdStatus: rest.OrderStatusFromModel(o.status),
+		Side:      rest.SideFromModel(o.side),
+		Price:     o.price,
+		Text:      o.text,
+		Symbol:    o.symbol,
+		LeavesQty: o.leavesQty,
+		CumQty:    o.cumQty,
+		AvgPx:     o.avgPx(),
+		Timestamp: o.updated.UnixMilli(),
+	}
+}
+
+// live returns the order if it exists and is not terminal
+func (e *Exchange) live(id int64) (*order, bool) {
+	o, ok := e.orders[id]
+	if !ok || o.status.IsTerminal() {
+		return nil, false
+	}
+	return o, true
+}
+
+// cancelMatching cancels the live orders of symbol, of every symbol when empty
+func (e *Exchange) cancelMatching(symbol string) {
+	for _, o := range e.liveOrders(symbol) {
+		e.cancel(o, "")
+	}
+}
+
+// liveOrders returns the live orders of symbol, of every symbol when empty, oldest first
+func (e *Exchange) liveOrders(symbol string) []*order {
+	var orders []*order
+	for _, o := range e.open {
+		if symbol == "" || o.symbol == symbol {
+			orders = append(orders, o)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].id < orders[j].id })
+	return orders
+}
+
+// parseExpireDate converts a YYYYMMDD date into the end of that day, UTC
+func parseExpireDate(date int) time.Time {
+	if date <= 0 {
+		return time.Time{}
+	}
+	day, err := time.Parse("20060102", strconv.Itoa(date))
+	if err != nil {
+		return time.Time{}
+	}
+	return day.Add(24*time.Hour - time.Nanosecond)
+}
+
+// FillsFrom returns the simulated executions from index i on, for callers
+// following the executions incrementally
+func (e *Exchange) FillsFrom(i int) []model.Fill {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if i >= len(e.fills) {
+		return nil
+	}
+	return append([]model.Fill(nil), e.fills[i:]...)
+}
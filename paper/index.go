@@ -0,0 +1,98 @@
+package paper
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/hmedkouri/go-bcex/model"
+)
+
+// The live orders are indexed so that market data events only visit the
+// orders they can affect: the resting orders of one symbol and side, the
+// pending stops of one symbol, the GTD orders due to expire. Orders are taken
+// out of the indexes once terminal, eagerly from the maps and lazily from the
+// slices and the expiry heap, which skip them when next visited.
+
+// sideKey identifies one side of the book of a symbol
+type sideKey struct {
+	symbol string
+	side   model.Side
+}
+
+// index records a new live order
+func (e *Exchange) index(o *order) {
+	e.open[o.id] = o
+	if o.clOrdID != "" {
+		e.clOrdIDs[o.clOrdID] = o
+	}
+	if o.timeInForce == model.GTD {
+		heap.Push(&e.expiries, o)
+	}
+}
+
+// unindex forgets an order that became terminal
+func (e *Exchange) unindex(o *order) {
+	delete(e.open, o.id)
+	if o.clOrdID != "" && e.clOrdIDs[o.clOrdID] == o {
+		delete(e.clOrdIDs, o.clOrdID)
+	}
+}
+
+// enqueue adds an order to its side of the book by price-time priority
+func (e *Exchange) enqueue(o *order) {
+	key := sideKey{o.symbol, o.side}
+	orders := e.resting(o.symbol, o.side)
+	i := sort.Search(len(orders), func(i int) bool { return before(o, orders[i]) })
+	orders = append(orders, nil)
+	copy(orders[i+1:], orders[i:])
+	orders[i] = o
+	e.queues[key] = orders
+}
+
+// resting returns the live orders of symbol on side by price-time priority
+func (e *Exchange) resting(symbol string, side model.Side) []*order {
+	key := sideKey{symbol, side}
+	orders := e.queues[key]
+	live := orders[:0]
+	for _, o := range orders {
+		if !o.status.IsTerminal() {
+			live = append(live, o)
+		}
+	}
+	for i := len(live); i < len(orders); i++ {
+		orders[i] = nil
+	}
+	e.queues[key] = live
+	return live
+}
+
+// before reports whether a has priority over b on their side of the book
+func before(a, b *order) bool {
+	if a.price != b.price {
+		if a.side == model.BUY {
+			return a.price > b.price
+		}
+		return a.price < b.price
+	}
+	return a.id < b.id
+}
+
+// expiryHeap orders the live GTD orders by expiry
+type expiryHeap []*order
+
+func (h expiryHeap) Len() int { return len(h) }
+func (h expiryHeap) Less(i, j int) bool {
+	if h[i].expire.Equal(h[j].expire) {
+		return h[i].id < h[j].id
+	}
+	return h[i].expire.Before(h[j].expire)
+}
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(*order)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	o := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return o
+}
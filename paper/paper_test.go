@@ -0,0 +1,208 @@
+package paper_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/paper"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+const symbol = "BTC-USD"
+
+type harness struct {
+	now     time.Time
+	reports []ws.TradingMsg
+	ex      *paper.Exchange
+}
+
+func newHarness() *harness {
+	h := &harness{now: time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)}
+	h.ex = paper.NewExchange(paper.Config{
+		Fees:     rest.Fees{MakerRate: 0.001, TakerRate: 0.002},
+		Now:      func() time.Time { return h.now },
+		OnReport: func(msg ws.TradingMsg) { h.reports = append(h.reports, msg) },
+	})
+	h.ex.OnL2(ws.L2Msg{
+		Event:  "snapshot",
+		Symbol: symbol,
+		Bids:   []ws.Level{{Px: 99, Qty: 1, Num: 1}, {Px: 98, Qty: 3, Num: 2}},
+		Asks:   []ws.Level{{Px: 101, Qty: 1, Num: 1}, {Px: 102, Qty: 2, Num: 1}},
+	})
+	return h
+}
+
+// execTypes returns the exec types of the reports received since the last call
+func (h *harness) execTypes() []string {
+	var types []string
+	for _, msg := range h.reports {
+		if update, ok := msg.(*ws.TradingUpdated); ok {
+			types = append(types, update.ExecType)
+		} else {
+			types = append(types, "reject")
+		}
+	}
+	h.reports = nil
+	return types
+}
+
+func TestImmediateOrCancel(t *testing.T) {
+	h := newHarness()
+	order, err := h.ex.PlaceOrder(model.OrderRequest{ClOrdID: "ioc", Symbol: symbol, Side: model.BUY, Type: model.LIMIT, TimeInForce: model.IOC, Qty: 2, Price: 101.5})
+	require.NoError(t, err)
+	require.Equal(t, model.CANCELLED, order.Status)
+	require.Equal(t, 1.0, order.CumQty)
+	require.Equal(t, 101.0, order.AvgPx)
+	require.Equal(t, []string{"0", "F", "4"}, h.execTypes())
+
+	fills := h.ex.Fills()
+	require.Len(t, fills, 1)
+	require.InDelta(t, 101*0.002, fills[0].Fee, 1e-9)
+	// the liquidity taken is gone from the local book until the next update
+	_, ok := h.ex.Book(symbol).BestAsk()
+	require.True(t, ok)
+	require.Equal(t, 102.0, h.ex.Book(symbol).Asks()[0].Price)
+}
+
+func TestFillOrKill(t *testing.T) {
+	h := newHarness()
+	order, _ := h.ex.PlaceOrder(model.OrderRequest{Symbol: symbol, Side: model.BUY, Type: model.LIMIT, TimeInForce: model.FOK, Qty: 5, Price: 102})
+	require.Equal(t, model.CANCELLED, order.Status)
+	require.Zero(t, order.CumQty)
+	require.Empty(t, h.ex.Fills())
+
+	order, _ = h.ex.PlaceOrder(model.OrderRequest{Symbol: symbol, Side: model.BUY, Type: model.LIMIT, TimeInForce: model.FOK, Qty: 3, Price: 102})
+	require.Equal(t, model.FILLED, order.Status)
+	require.InDelta(t, (101+2*102)/3.0, order.AvgPx, 1e-9)
+}
+
+func TestAddLiquidityOnly(t *testing.T) {
+	h := newHarness()
+	err := h.ex.NewOrderSingleMessage(ws.NewOrderSingleMsg{ClOrdID: "alo", Symbol: symbol, OrdType: ws.LIMIT, TimeInForce: ws.GTC, Side: ws.BUY, OrderQty: 1, Price: 101, ExecInst: ws.ALO})
+	require.NoError(t, err)
+	require.Len(t, h.reports, 1)
+	report := h.reports[0].(*ws.TradingUpdated)
+	require.Equal(t, string(ws.ORDER_STATUS_REJECTED), report.OrdStatus)
+
+	h.reports = nil
+	require.NoError(t, h.ex.NewOrderSingleMessage(ws.NewOrderSingleMsg{ClOrdID: "alo", Symbol: symbol, OrdType: ws.LIMIT, TimeInForce: ws.GTC, Side: ws.BUY, OrderQty: 1, Price: 100, ExecInst: ws.ALO}))
+	require.Equal(t, []string{"0"}, h.execTypes())
+}
+
+func TestQueuePosition(t *testing.T) {
+	h := newHarness()
+	summary, err := h.ex.CreateOrder(rest.BaseOrder{ClOrdId: "maker", Symbol: symbol, Side: rest.SELL, OrdType: rest.LIMIT, OrderQty: 1, Price: 102})
+	require.NoError(t, err)
+	require.Equal(t, rest.OPEN, summary.OrdStatus)
+	h.execTypes()
+
+	// 2 are queued ahead of the order at 102
+	h.ex.OnTrade(ws.TradesMsg{Symbol: symbol, Side: "buy", Qty: 1.5, Price: 102})
+	require.Empty(t, h.execTypes())
+	h.ex.OnTrade(ws.TradesMsg{Symbol: symbol, Side: "buy", Qty: 1, Price: 102})
+	require.Equal(t, []string{"F"}, h.execTypes())
+
+	summary, err = h.ex.GetOrderById(summary.ExOrdId)
+	require.NoError(t, err)
+	require.Equal(t, rest.PART_FILLED, summary.OrdStatus)
+	require.Equal(t, 0.5, summary.CumQty)
+	require.InDelta(t, 102*0.5*0.001, h.ex.Fills()[0].Fee, 1e-9)
+
+	// a trade through the price fills the rest regardless of the queue
+	h.ex.OnTrade(ws.TradesMsg{Symbol: symbol, Side: "buy", Qty: 3, Price: 103})
+	summary, _ = h.ex.GetOrderById(summary.ExOrdId)
+	require.Equal(t, rest.FILLED, summary.OrdStatus)
+}
+
+func TestBookThroughRestingOrder(t *testing.T) {
+	h := newHarness()
+	order, _ := h.ex.PlaceOrder(model.OrderRequest{Symbol: symbol, Side: model.BUY, Type: model.LIMIT, Qty: 1, Price: 100})
+	h.ex.OnL2(ws.L2Msg{Event: "updated", Symbol: symbol, Asks: []ws.Level{{Px: 99.5, Qty: 0.4, Num: 1}}})
+	order, _ = h.ex.GetOrder(order.OrderID)
+	require.Equal(t, model.PARTIAL, order.Status)
+	require.Equal(t, 0.4, order.CumQty)
+	require.Equal(t, 100.0, order.AvgPx)
+}
+
+func TestGoodTillDate(t *testing.T) {
+	h := newHarness()
+	order, _ := h.ex.PlaceOrder(model.OrderRequest{Symbol: symbol, Side: model.BUY, Type: model.LIMIT, TimeInForce: model.GTD, Qty: 1, Price: 90, ExpireDate: h.now})
+	require.Equal(t, model.OPEN, order.Status)
+
+	h.now = h.now.Add(24 * time.Hour)
+	h.ex.Advance()
+	order, _ = h.ex.GetOrder(order.OrderID)
+	require.Equal(t, model.EXPIRED, order.Status)
+
+	order, _ = h.ex.PlaceOrder(model.OrderRequest{Symbol: symbol, Side: model.BUY, Type: model.LIMIT, TimeInForce: model.GTD, Qty: 1, Price: 90})
+	require.Equal(t, model.REJECTED, order.Status)
+}
+
+func TestStopAndCancel(t *testing.T) {
+	h := newHarness()
+	stop, _ := h.ex.PlaceOrder(model.OrderRequest{Symbol: symbol, Side: model.BUY, Type: model.STOP, Qty: 0.5, StopPx: 101})
+	require.Equal(t, model.PENDING, stop.Status)
+	h.ex.OnTrade(ws.TradesMsg{Symbol: symbol, Side: "buy", Qty: 0.1, Price: 101})
+	stop, _ = h.ex.GetOrder(stop.OrderID)
+	require.Equal(t, model.FILLED, stop.Status)
+
+	resting, _ := h.ex.PlaceOrder(model.OrderRequest{Symbol: symbol, Side: model.SELL, Type: model.LIMIT, Qty: 1, Price: 110})
+	open, _ := h.ex.OpenOrders(symbol)
+	require.Len(t, open, 1)
+	h.reports = nil
+	require.NoError(t, h.ex.CancelOrder(resting.OrderID))
+	require.NoError(t, h.ex.CancelOrder(resting.OrderID))
+	require.Equal(t, []string{"4", "reject"}, h.execTypes())
+	require.Error(t, h.ex.DeleteOrderById(42))
+}
+
+func TestInvalidOrder(t *testing.T) {
+	h := newHarness()
+	require.NoError(t, h.ex.NewOrderSingleMessage(ws.NewOrderSingleMsg{ClOrdID: "hold", Symbol: symbol, OrdType: ws.LIMIT, Side: "hold", OrderQty: 1, Price: 100}))
+	require.Len(t, h.reports, 1)
+	report := h.reports[0].(*ws.TradingUpdated)
+	require.Equal(t, string(ws.ORDER_STATUS_REJECTED), report.OrdStatus)
+	require.Equal(t, `unknown side "hold"`, report.Text)
+
+	summary, err := h.ex.CreateOrder(rest.BaseOrder{ClOrdId: "iceberg", Symbol: symbol, Side: rest.BUY, OrdType: "iceberg", OrderQty: 1, Price: 100})
+	require.NoError(t, err)
+	require.Equal(t, rest.REJECTED, summary.OrdStatus)
+	require.Equal(t, `unknown order type "iceberg"`, summary.Text)
+
+	order, err := h.ex.PlaceOrder(model.OrderRequest{Symbol: symbol, Side: "hold", Type: model.LIMIT, Qty: 1, Price: 100})
+	require.NoError(t, err)
+	require.Equal(t, model.REJECTED, order.Status)
+	require.Equal(t, "Invalid side", order.Text)
+	require.Empty(t, h.ex.Fills())
+}
+
+func TestPriceTimePriority(t *testing.T) {
+	h := newHarness()
+	first, _ := h.ex.PlaceOrder(model.OrderRequest{ClOrdID: "first", Symbol: symbol, Side: model.BUY, Type: model.LIMIT, Qty: 1, Price: 97})
+	better, _ := h.ex.PlaceOrder(model.OrderRequest{ClOrdID: "better", Symbol: symbol, Side: model.BUY, Type: model.LIMIT, Qty: 1, Price: 97.5})
+	second, _ := h.ex.PlaceOrder(model.OrderRequest{ClOrdID: "second", Symbol: symbol, Side: model.BUY, Type: model.LIMIT, Qty: 1, Price: 97})
+	cancelled, _ := h.ex.PlaceOrder(model.OrderRequest{ClOrdID: "cancelled", Symbol: symbol, Side: model.BUY, Type: model.LIMIT, Qty: 1, Price: 97})
+	require.NoError(t, h.ex.CancelOrder(cancelled.OrderID))
+
+	// a trade through 97 reaches the better price first, then the oldest order at 97
+	h.ex.OnTrade(ws.TradesMsg{Symbol: symbol, Side: "sell", Qty: 2, Price: 96})
+	fills := h.ex.Fills()
+	require.Len(t, fills, 2)
+	require.Equal(t, better.OrderID, fills[0].OrderID)
+	require.Equal(t, first.OrderID, fills[1].OrderID)
+
+	open, _ := h.ex.OpenOrders(symbol)
+	require.Len(t, open, 1)
+	require.Equal(t, second.OrderID, open[0].OrderID)
+
+	// the clOrdID of a terminal order can be reused, not the one of a live order
+	order, _ := h.ex.PlaceOrder(model.OrderRequest{ClOrdID: "first", Symbol: symbol, Side: model.BUY, Type: model.LIMIT, Qty: 1, Price: 90})
+	require.Equal(t, model.OPEN, order.Status)
+	order, _ = h.ex.PlaceOrder(model.OrderRequest{ClOrdID: "second", Symbol: symbol, Side: model.BUY, Type: model.LIMIT, Qty: 1, Price: 90})
+	require.Equal(t, model.REJECTED, order.Status)
+	require.Equal(t, "Duplicate clOrdID", order.Text)
+}
@@ -0,0 +1,94 @@
+package record
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec compresses and decompresses recording files. Gzip, Zstd and None are
+// built in, other formats are registered with RegisterCodec; the files of an
+// extension with no codec registered are not read.
+type Codec interface {
+	// Extension is appended to the file name, e.g. ".gz"
+	Extension() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	// Gzip compresses files with compress/gzip
+	Gzip Codec = gzipCodec{}
+	// Zstd compresses files with github.com/klauspost/compress/zstd
+	Zstd Codec = zstdCodec{}
+	// None writes plain JSONL files
+	None Codec = noneCodec{}
+
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		Gzip.Extension(): Gzip,
+		Zstd.Extension(): Zstd,
+		None.Extension(): None,
+	}
+)
+
+// RegisterCodec makes the codec available to read files with its extension
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Extension()] = codec
+}
+
+// codecFor returns the codec of a file from its extension
+func codecFor(ext string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[ext]
+	return codec, ok
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Extension() string { return ".gz" }
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Extension() string { return ".zst" }
+
+func (zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+type noneCodec struct{}
+
+func (noneCodec) Extension() string { return "" }
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (noneCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (noneCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
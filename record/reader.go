@@ -0,0 +1,255 @@
+package record
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// Filter selects the frames read from a recording
+type Filter struct {
+	// Symbols to read, all when empty. Frames of the global partition are always read.
+	Symbols []string
+	// From skips frames received before this time, when set
+	From time.Time
+	// To stops at frames received after this time, when set
+	To time.Time
+	// Truncated reads a file cut short, by a recorder that crashed or is still
+	// writing it, up to its last complete frame instead of failing
+	Truncated bool
+}
+
+// Reader reads the frames of a recording in receive time order, merging the
+// partitions of every selected symbol. It implements ws.FrameSource.
+type Reader struct {
+	filter  Filter
+	streams streamHeap
+	err     error
+}
+
+var _ ws.FrameSource = (*Reader)(nil)
+
+// Open returns a Reader over the recording written by a Recorder in dir
+func Open(dir string, filter Filter) (*Reader, error) {
+	partitions, err := listPartitions(dir, filter)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(partitions))
+	for name := range partitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r := &Reader{filter: filter}
+	for _, name := range names {
+		s := &stream{name: name, files: partitions[name], truncated: filter.Truncated}
+		ok, err := s.advance()
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		if ok {
+			r.streams = append(r.streams, s)
+		}
+	}
+	heap.Init(&r.streams)
+	return r, nil
+}
+
+// listPartitions returns the files of every selected partition, in write order
+func listPartitions(dir string, filter Filter) (map[string][]string, error) {
+	dates, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	selected := map[string]bool{GlobalPartition: true}
+	for _, symbol := range filter.Symbols {
+		selected[symbol] = true
+	}
+	partitions := make(map[string][]string)
+	for _, date := range dates {
+		day, err := time.Parse(DateLayout, date.Name())
+		if !date.IsDir() || err != nil {
+			continue
+		}
+		if !filter.From.IsZero() && day.Add(24*time.Hour).Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && day.After(filter.To) {
+			continue
+		}
+		symbols, err := os.ReadDir(filepath.Join(dir, date.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, symbol := range symbols {
+			if !symbol.IsDir() || (len(filter.Symbols) > 0 && !selected[symbol.Name()]) {
+				continue
+			}
+			files, err := os.ReadDir(filepath.Join(dir, date.Name(), symbol.Name()))
+			if err != nil {
+				return nil, err
+			}
+			var names []string
+			for _, f := range files {
+				if strings.HasPrefix(f.Name(), "frames-") {
+					names = append(names, filepath.Join(dir, date.Name(), symbol.Name(), f.Name()))
+				}
+			}
+			sort.Strings(names)
+			partitions[symbol.Name()] = append(partitions[symbol.Name()], names...)
+		}
+	}
+	return partitions, nil
+}
+
+// Next returns the next frame, io.EOF once the recording is exhausted
+func (r *Reader) Next() (ws.Frame, error) {
+	for {
+		if r.err != nil {
+			return ws.Frame{}, r.err
+		}
+		if len(r.streams) == 0 {
+			return ws.Frame{}, io.EOF
+		}
+		s := r.streams[0]
+		frame := s.frame
+		ok, err := s.advance()
+		if err != nil {
+			r.err = err
+			return ws.Frame{}, err
+		}
+		if ok {
+			heap.Fix(&r.streams, 0)
+		} else {
+			heap.Pop(&r.streams)
+		}
+		if !r.filter.From.IsZero() && frame.Time.Before(r.filter.From) {
+			continue
+		}
+		if !r.filter.To.IsZero() && frame.Time.After(r.filter.To) {
+			continue
+		}
+		return frame, nil
+	}
+}
+
+// Close releases the files still open
+func (r *Reader) Close() error {
+	for _, s := range r.streams {
+		s.close()
+	}
+	r.streams = nil
+	return nil
+}
+
+// stream reads the files of one partition in sequence
+type stream struct {
+	name      string
+	files     []string
+	truncated bool
+	file      string
+	f         *os.File
+	zr        io.ReadCloser
+	scanner   *bufio.Scanner
+	frame     ws.Frame
+}
+
+// advance loads the next frame of the partition, reporting false when exhausted
+func (s *stream) advance() (bool, error) {
+	for {
+		if s.scanner == nil {
+			if len(s.files) == 0 {
+				return false, nil
+			}
+			if err := s.open(s.files[0]); err != nil {
+				return false, err
+			}
+			s.files = s.files[1:]
+		}
+		if s.scanner.Scan() {
+			var frame ws.Frame
+			err := json.Unmarshal(s.scanner.Bytes(), &frame)
+			if err == nil {
+				s.frame = frame
+				return true, nil
+			}
+			// the last line of a truncated file is cut short, the read error follows it
+			if s.scanner.Scan() || s.scanner.Err() == nil {
+				return false, fmt.Errorf("reading %s: %w", s.file, err)
+			}
+		}
+		err := s.scanner.Err()
+		file := s.file
+		s.close()
+		if err == io.ErrUnexpectedEOF && s.truncated {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("reading %s: %w", file, err)
+		}
+	}
+}
+
+func (s *stream) open(name string) error {
+	codec, ok := codecFor(extension(name))
+	if !ok {
+		return fmt.Errorf("reading %s: no codec registered for %q, see RegisterCodec", name, extension(name))
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	zr, err := codec.NewReader(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.f, s.zr = name, f, zr
+	s.scanner = bufio.NewScanner(zr)
+	s.scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return nil
+}
+
+func (s *stream) close() {
+	if s.zr != nil {
+		s.zr.Close()
+		s.f.Close()
+	}
+	s.file, s.f, s.zr, s.scanner = "", nil, nil, nil
+}
+
+// extension returns what follows ".jsonl" in a file name
+func extension(name string) string {
+	if i := strings.LastIndex(name, ".jsonl"); i >= 0 {
+		return name[i+len(".jsonl"):]
+	}
+	return filepath.Ext(name)
+}
+
+type streamHeap []*stream
+
+func (h streamHeap) Len() int { return len(h) }
+func (h streamHeap) Less(i, j int) bool {
+	if h[i].frame.Time.Equal(h[j].frame.Time) {
+		return h[i].name < h[j].name
+	}
+	return h[i].frame.Time.Before(h[j].frame.Time)
+}
+func (h streamHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *streamHeap) Push(x interface{}) { *h = append(*h, x.(*stream)) }
+func (h *streamHeap) Pop() interface{} {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
@@ -0,0 +1,205 @@
+package record_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/record"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readFrames(t *testing.T, name string) []ws.Frame {
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	var frames []ws.Frame
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var frame ws.Frame
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &frame))
+		frames = append(frames, frame)
+	}
+	require.NoError(t, scanner.Err())
+	return frames
+}
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := record.NewRecorder(record.Options{Dir: dir, MaxFileSize: 200})
+	require.NoError(t, err)
+
+	day := time.Date(2022, 5, 1, 23, 59, 0, 0, time.UTC)
+	l2 := []byte(`{"seqnum":2,"event":"updated","channel":"l2","symbol":"BTC-USD","bids":[{"px":100,"qty":1,"num":1}],"asks":[]}`)
+	require.NoError(t, recorder.Record(ws.NewFrame(l2, day)))
+	require.NoError(t, recorder.Record(ws.NewFrame(l2, day.Add(time.Second))))
+	require.NoError(t, recorder.Record(ws.NewFrame([]byte("ping"), day)))
+	require.NoError(t, recorder.Record(ws.NewFrame([]byte(`{"seqnum":3,"event":"upd`), day)))
+	require.NoError(t, recorder.Record(ws.NewFrame(l2, day.Add(time.Minute))))
+	require.NoError(t, recorder.Close())
+
+	// the size limit rotated the first file, the date change opened a new directory
+	frames := readFrames(t, filepath.Join(dir, "2022-05-01", "BTC-USD", "frames-00000.jsonl.gz"))
+	require.Len(t, frames, 1)
+	require.Equal(t, "l2", frames[0].Channel)
+	require.JSONEq(t, string(l2), string(frames[0].Bytes()))
+	require.Len(t, readFrames(t, filepath.Join(dir, "2022-05-01", "BTC-USD", "frames-00001.jsonl.gz")), 1)
+	require.Len(t, readFrames(t, filepath.Join(dir, "2022-05-02", "BTC-USD", "frames-00000.jsonl.gz")), 1)
+
+	// frames that are not JSON, or fail to decode, are kept verbatim
+	global := readFrames(t, filepath.Join(dir, "2022-05-01", record.GlobalPartition, "frames-00000.jsonl.gz"))
+	require.Len(t, global, 2)
+	require.Equal(t, "ping", string(global[0].Bytes()))
+	require.Equal(t, `{"seqnum":3,"event":"upd`, string(global[1].Bytes()))
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := record.NewRecorder(record.Options{Dir: dir})
+	require.NoError(t, err)
+
+	start := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	frames := []string{
+		`{"seqnum":0,"event":"subscribed","channel":"l2","symbol":"BTC-USD"}`,
+		`{"seqnum":1,"event":"snapshot","channel":"l2","symbol":"BTC-USD","bids":[{"px":100,"qty":1,"num":1}],"asks":[{"px":101,"qty":2,"num":1}]}`,
+		`{"seqnum":2,"event":"updated","channel":"trades","symbol":"ETH-USD","side":"buy","qty":1,"price":10,"trade_id":"1"}`,
+		`{"seqnum":3,"event":"updated","channel":"heartbeat"}`,
+		`{"seqnum":4,"event":"updated","channel":"trades","symbol":"BTC-USD","side":"sell","qty":0.5,"price":100,"trade_id":"2"}`,
+	}
+	for i, frame := range frames {
+		require.NoError(t, recorder.Record(ws.NewFrame([]byte(frame), start.Add(time.Duration(i)*time.Second))))
+	}
+	require.NoError(t, recorder.Close())
+
+	reader, err := record.Open(dir, record.Filter{Symbols: []string{"BTC-USD"}})
+	require.NoError(t, err)
+	defer reader.Close()
+
+	client := ws.NewWebSocketClient(ws.Configuration{})
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Replay(reader, ws.ReplayOptions{})
+	}()
+
+	l2 := <-client.L2Quotes()
+	require.Equal(t, "snapshot", l2.Event)
+	require.Equal(t, 101.0, l2.Asks[0].Px)
+	heartbeat := <-client.Heartbeats()
+	require.Equal(t, "heartbeat", heartbeat.Channel.String())
+	trade := <-client.Trades()
+	require.Equal(t, "2", trade.TradeID)
+	require.NoError(t, <-done)
+}
+
+func TestReplaySpeed(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := record.NewRecorder(record.Options{Dir: dir, Codec: record.None})
+	require.NoError(t, err)
+	start := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, recorder.Record(ws.NewFrame([]byte(`{"event":"updated","channel":"heartbeat"}`), start.Add(time.Duration(i)*time.Second))))
+	}
+	require.NoError(t, recorder.Close())
+
+	reader, err := record.Open(dir, record.Filter{})
+	require.NoError(t, err)
+	defer reader.Close()
+
+	client := ws.NewWebSocketClient(ws.Configuration{})
+	go func() {
+		for range client.Heartbeats() {
+		}
+	}()
+	// the first second is fast-forwarded, the remaining one is played 20 times faster
+	begin := time.Now()
+	require.NoError(t, client.Replay(reader, ws.ReplayOptions{Speed: 20, Start: start.Add(time.Second)}))
+	elapsed := time.Since(begin)
+	require.GreaterOrEqual(t, elapsed, 45*time.Millisecond)
+	require.Less(t, elapsed, 500*time.Millisecond)
+}
+
+func TestUnknownCodec(t *testing.T) {
+	dir := t.TempDir()
+	partition := filepath.Join(dir, "2022-05-01", record.GlobalPartition)
+	require.NoError(t, os.MkdirAll(partition, 0o755))
+	name := filepath.Join(partition, "frames-00000.jsonl.lz4")
+	require.NoError(t, os.WriteFile(name, []byte{0x04, 0x22, 0x4d, 0x18}, 0o644))
+
+	_, err := record.Open(dir, record.Filter{})
+	require.EqualError(t, err, "reading "+name+`: no codec registered for ".lz4", see RegisterCodec`)
+}
+
+// readAll opens the recording in dir and returns its frames, and the error ending the read
+func readAll(t *testing.T, dir string, filter record.Filter) ([]ws.Frame, error) {
+	reader, err := record.Open(dir, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var frames []ws.Frame
+	for {
+		frame, err := reader.Next()
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, frame)
+	}
+}
+
+// recordHeartbeats records count heartbeats one second apart in a new directory
+func recordHeartbeats(t *testing.T, codec record.Codec, count int) string {
+	dir := t.TempDir()
+	recorder, err := record.NewRecorder(record.Options{Dir: dir, Codec: codec})
+	require.NoError(t, err)
+	start := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < count; i++ {
+		frame := fmt.Sprintf(`{"seqnum":%d,"event":"updated","channel":"heartbeat"}`, i)
+		require.NoError(t, recorder.Record(ws.NewFrame([]byte(frame), start.Add(time.Duration(i)*time.Second))))
+	}
+	require.NoError(t, recorder.Close())
+	return dir
+}
+
+func TestZstd(t *testing.T) {
+	dir := recordHeartbeats(t, record.Zstd, 3)
+	_, err := os.Stat(filepath.Join(dir, "2022-05-01", record.GlobalPartition, "frames-00000.jsonl.zst"))
+	require.NoError(t, err)
+
+	frames, err := readAll(t, dir, record.Filter{})
+	require.NoError(t, err)
+	require.Len(t, frames, 3)
+	require.JSONEq(t, `{"seqnum":2,"event":"updated","channel":"heartbeat"}`, string(frames[2].Bytes()))
+}
+
+func TestTruncated(t *testing.T) {
+	dir := recordHeartbeats(t, record.Gzip, 1000)
+	name := filepath.Join(dir, "2022-05-01", record.GlobalPartition, "frames-00000.jsonl.gz")
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(name, info.Size()/2))
+
+	// a truncated file is an error by default
+	frames, err := readAll(t, dir, record.Filter{})
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Contains(t, err.Error(), name)
+	require.Less(t, len(frames), 1000)
+
+	// and read up to its last complete frame on demand
+	frames, err = readAll(t, dir, record.Filter{Truncated: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, frames)
+	require.Less(t, len(frames), 1000)
+}
@@ -0,0 +1,186 @@
+// Package record captures websocket frames into rotating, compressed JSONL
+// files partitioned by date and symbol, and reads them back for replay. The
+// files are compressed with gzip by default, or with zstd, see Codec.
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// GlobalPartition is the partition of frames not scoped to a symbol (heartbeat, trading, balances...)
+const GlobalPartition = "_global"
+
+// DateLayout is the layout of the date directories
+const DateLayout = "2006-01-02"
+
+// Options of a Recorder
+type Options struct {
+	// Dir is the root directory of the recording
+	Dir string
+	// Codec compresses the files, Gzip when nil
+	Codec Codec
+	// MaxFileSize rotates a file once this many uncompressed bytes were written to it, zero meaning never
+	MaxFileSize int64
+}
+
+// Recorder is a ws.FrameRecorder writing frames to <Dir>/<date>/<symbol>/frames-<n>.jsonl<ext>.
+// Files are rotated when the date changes or MaxFileSize is reached.
+type Recorder struct {
+	opts  Options
+	mu    sync.Mutex
+	files map[string]*file
+}
+
+var _ ws.FrameRecorder = (*Recorder)(nil)
+
+type file struct {
+	date    string
+	index   int
+	written int64
+	f       *os.File
+	zw      io.WriteCloser
+	bw      *bufio.Writer
+}
+
+// NewRecorder returns a Recorder writing under opts.Dir
+func NewRecorder(opts Options) (*Recorder, error) {
+	if opts.Codec == nil {
+		opts.Codec = Gzip
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Recorder{opts: opts, files: make(map[string]*file)}, nil
+}
+
+// Record appends the frame to the file of its date and symbol
+func (r *Recorder) Record(frame ws.Frame) error {
+	line, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	partition := frame.Symbol
+	if partition == "" {
+		partition = GlobalPartition
+	}
+	date := frame.Time.UTC().Format(DateLayout)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f := r.files[partition]
+	if f == nil || f.date != date || (r.opts.MaxFileSize > 0 && f.written+int64(len(line)) > r.opts.MaxFileSize && f.written > 0) {
+		if f, err = r.rotate(partition, date, f); err != nil {
+			return err
+		}
+	}
+	n, err := f.bw.Write(line)
+	f.written += int64(n)
+	return err
+}
+
+// rotate closes the current file of the partition and opens the next one
+func (r *Recorder) rotate(partition, date string, current *file) (*file, error) {
+	if current != nil {
+		if err := current.close(); err != nil {
+			return nil, err
+		}
+		delete(r.files, partition)
+	}
+	dir := filepath.Join(r.opts.Dir, date, partition)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	index, err := nextIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("frames-%05d.jsonl%s", index, r.opts.Codec.Extension()))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	zw, err := r.opts.Codec.NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	next := &file{date: date, index: index, f: f, zw: zw, bw: bufio.NewWriter(zw)}
+	r.files[partition] = next
+	return next, nil
+}
+
+// nextIndex returns the index following the last frames file of dir, so a
+// restarted recorder never overwrites an earlier file
+func nextIndex(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "frames-") {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return 0, nil
+	}
+	sort.Strings(names)
+	var last int
+	if _, err := fmt.Sscanf(names[len(names)-1], "frames-%05d", &last); err != nil {
+		return 0, err
+	}
+	return last + 1, nil
+}
+
+// Flush pushes buffered frames to the compressor of every open file
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.files {
+		if err := f.bw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes every open file
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var firstErr error
+	for partition, f := range r.files {
+		if err := f.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.files, partition)
+	}
+	return firstErr
+}
+
+func (f *file) close() error {
+	if err := f.bw.Flush(); err != nil {
+		f.zw.Close()
+		f.f.Close()
+		return err
+	}
+	if err := f.zw.Close(); err != nil {
+		f.f.Close()
+		return err
+	}
+	return f.f.Close()
+}
@@ -0,0 +1,76 @@
+package bcex
+
+import (
+	"log"
+	"sync"
+
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// ReferenceData returns a cache of the symbols and fees of the Rest client,
+// refreshed when the symbols channel of the websocket client reports a status
+// change. The stop function ends the refresh.
+func (c *Client) ReferenceData(opts rest.CacheOptions) (cache *rest.Cache, stop func()) {
+	cache = rest.NewCache(c.Rest, opts)
+	return cache, RefreshOnStatusChange(cache, c.Ws)
+}
+
+// RefreshOnStatusChange reloads a symbol in cache when the symbols channel of
+// streamer reports a status different from the cached one, e.g. a market
+// halted or reopened, until the returned function is called. The symbols
+// channel must be subscribed separately.
+func RefreshOnStatusChange(cache *rest.Cache, streamer ws.Streamer) (stop func()) {
+	// large enough for the snapshot of all the symbols
+	listener := streamer.Listen(ws.ListenerOptions{Channels: []string{"symbols"}, Buffer: 4096})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		statuses := make(map[string]string)
+		for msg := range listener.C {
+			symbol, ok := msg.(ws.SymbolMsg)
+			if !ok || symbol.Status == "" {
+				continue
+			}
+			name := string(symbol.Name)
+			previous, seen := statuses[name]
+			if !seen {
+				// the cached symbols may predate the first message
+				previous, seen = cachedStatus(cache, name, statuses)
+			}
+			statuses[name] = symbol.Status
+			if !seen || previous == symbol.Status {
+				continue
+			}
+			if _, err := cache.Refresh(name); err != nil {
+				log.Printf("refreshing symbol %s: %s", name, err)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			listener.Close()
+			<-done
+		})
+	}
+}
+
+// cachedStatus returns the status of the symbol name in cache, cached alone
+// or with the other symbols, whose statuses are added to statuses
+func cachedStatus(cache *rest.Cache, name string, statuses map[string]string) (string, bool) {
+	if symbol, ok := cache.Cached(name); ok {
+		return symbol.Status, true
+	}
+	symbols, ok := cache.CachedSymbols()
+	if !ok {
+		return "", false
+	}
+	for _, symbol := range symbols {
+		if _, ok := statuses[symbol.Name()]; !ok {
+			statuses[symbol.Name()] = symbol.Status
+		}
+	}
+	status, ok := statuses[name]
+	return status, ok
+}
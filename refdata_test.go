@@ -0,0 +1,79 @@
+package bcex_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bcex "github.com/hmedkouri/go-bcex"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/rest/resttest"
+	"github.com/hmedkouri/go-bcex/ws"
+	"github.com/hmedkouri/go-bcex/ws/wstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshOnStatusChange(t *testing.T) {
+	api := resttest.NewFakeAPI()
+	var status atomic.Value
+	status.Store("open")
+	api.GetSymbolFunc = func(market string) (rest.Symbol, error) {
+		return rest.Symbol{Status: status.Load().(string)}, nil
+	}
+	streamer := wstest.NewFakeStreamer(16)
+	cache := rest.NewCache(api, rest.CacheOptions{})
+	stop := bcex.RefreshOnStatusChange(cache, streamer)
+	defer stop()
+
+	_, err := cache.GetSymbol("BTC-USD")
+	require.NoError(t, err)
+
+	// the status of the cached symbol is unchanged
+	streamer.Publish(ws.SymbolMsg{Name: "BTC-USD", Status: "open"})
+	// the symbol is halted
+	status.Store("halt")
+	streamer.Publish(ws.SymbolMsg{Name: "BTC-USD", Status: "halt"})
+	require.Eventually(t, func() bool {
+		symbol, ok := cache.Cached("BTC-USD")
+		return ok && symbol.Status == "halt"
+	}, time.Second, time.Millisecond)
+	require.Len(t, api.CallsTo("GetSymbol"), 2)
+
+	// a symbol first seen is loaded on its next status change
+	streamer.Publish(ws.SymbolMsg{Name: "ETH-USD", Status: "halt"})
+	streamer.Publish(ws.SymbolMsg{Name: "ETH-USD", Status: "open"})
+	stop()
+	require.Len(t, api.CallsTo("GetSymbol"), 3)
+	_, ok := cache.Cached("ETH-USD")
+	require.True(t, ok)
+}
+
+func TestRefreshOnStatusChangeFrames(t *testing.T) {
+	api := resttest.NewFakeAPI()
+	api.GetSymbolsFunc = func() ([]rest.Symbol, error) {
+		return []rest.Symbol{{BaseCurrency: "BTC", CounterCurrency: "USD", Status: "open"}}, nil
+	}
+	api.GetSymbolFunc = func(market string) (rest.Symbol, error) {
+		return rest.Symbol{BaseCurrency: "BTC", CounterCurrency: "USD", Status: "halt"}, nil
+	}
+	client := ws.NewWebSocketClient(ws.Configuration{})
+	cache := rest.NewCache(api, rest.CacheOptions{})
+	stop := bcex.RefreshOnStatusChange(cache, replayStreamer{client})
+	defer stop()
+
+	// the symbol is only cached with the other symbols
+	_, err := cache.GetSymbols()
+	require.NoError(t, err)
+	replay(t, client,
+		`{"seqnum":1,"event":"snapshot","channel":"symbols","symbols":{"BTC-USD":{"base_currency":"BTC","counter_currency":"USD","status":"open"}}}`,
+		`{"seqnum":2,"event":"updated","channel":"symbols","symbol":"BTC-USD","base_currency":"BTC","counter_currency":"USD","status":"halt"}`,
+	)
+	require.Eventually(t, func() bool {
+		symbol, ok := cache.Cached("BTC-USD")
+		return ok && symbol.Status == "halt"
+	}, time.Second, time.Millisecond)
+	require.Len(t, api.CallsTo("GetSymbol"), 1)
+	_, ok := cache.CachedSymbols()
+	require.False(t, ok)
+}
@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"context"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/metrics"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/tracing"
+)
+
+// API is the set of methods offered by Client, the Rest calls and the
+// settings, so consumers can depend on an interface and substitute a fake in
+// their tests
+type API interface {
+	GetSymbols() ([]Symbol, error)
+	GetSymbol(market string) (Symbol, error)
+	GetAllTicker() (Tickers, error)
+	GetTicker(market string) (Ticker, error)
+	GetL2Orderbook(market string) (OrderBook, error)
+	GetL3Orderbook(market string) (OrderBook, error)
+	GetCandles(symbol string, granularity time.Duration, from, to time.Time) ([]model.Candle, error)
+
+	CreateOrder(requestOrder BaseOrder) (OrderSummary, error)
+	DeleteAllOrders(options *DeleteAllOrdersOpts) error
+	GetFees() (Fees, error)
+	GetBalances() (BalanceMap, error)
+	GetTrades(options *GetTradesOpts) ([]Trade, error)
+	GetOrders(options *GetOrdersOpts) ([]OrderSummary, error)
+	GetFills(options *GetFillsOpts) ([]OrderSummary, error)
+	GetOrderById(orderId int64) (OrderSummary, error)
+	DeleteOrderById(orderId int64) error
+
+	SetBaseURL(baseURL string)
+	SetCandlesURL(candlesURL string)
+	SetRateLimit(requestsPerSecond float64, burst int)
+	SetMetrics(registry *metrics.Registry)
+	SetTracerProvider(provider tracing.TracerProvider)
+	Use(middlewares ...Middleware)
+	WithContext(ctx context.Context) API
+}
+
+var _ API = (*Client)(nil)
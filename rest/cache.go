@@ -0,0 +1,198 @@
+package rest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheOptions configures a Cache
+type CacheOptions struct {
+	// TTL is how long the reference data is served from memory, 5 minutes
+	// when zero
+	TTL time.Duration
+}
+
+// Cache is an API serving the reference data, the symbols and the fees, from
+// memory until their TTL expires or they are invalidated. Concurrent calls
+// for the same data share a single request. The other calls go to the
+// wrapped API.
+type Cache struct {
+	API
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// generation is incremented by the invalidations, so the responses of
+	// the requests in flight meanwhile are neither cached nor shared
+	generation uint64
+	flight     flightGroup
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+var _ API = (*Cache)(nil)
+
+// NewCache returns a cache of the reference data of api
+func NewCache(api API, opts CacheOptions) *Cache {
+	if opts.TTL <= 0 {
+		opts.TTL = 5 * time.Minute
+	}
+	return &Cache{API: api, ttl: opts.TTL, entries: make(map[string]cacheEntry)}
+}
+
+const (
+	symbolsKey = "symbols"
+	feesKey    = "fees"
+)
+
+func symbolKey(market string) string {
+	return "symbols/" + strings.ToUpper(market)
+}
+
+// get returns the value of key, loaded with load unless cached
+func (c *Cache) get(key string, load func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.value, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	// the flights are keyed by generation: a call made after an invalidation
+	// does not join a request that may return the invalidated data
+	return c.flight.do(fmt.Sprintf("%s@%d", key, generation), func() (interface{}, error) {
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.generation == generation {
+			c.entries[key] = cacheEntry{value: value, expires: time.Now().Add(c.ttl)}
+		}
+		c.mu.Unlock()
+		return value, nil
+	})
+}
+
+// GetSymbols returns the symbols, cached
+func (c *Cache) GetSymbols() ([]Symbol, error) {
+	value, err := c.get(symbolsKey, func() (interface{}, error) {
+		return c.API.GetSymbols()
+	})
+	if err != nil {
+		return nil, err
+	}
+	// a copy, the cached slice must not be altered by the caller
+	return append([]Symbol(nil), value.([]Symbol)...), nil
+}
+
+// GetSymbol returns the symbol market, cached
+func (c *Cache) GetSymbol(market string) (Symbol, error) {
+	value, err := c.get(symbolKey(market), func() (interface{}, error) {
+		return c.API.GetSymbol(market)
+	})
+	if err != nil {
+		return Symbol{}, err
+	}
+	return value.(Symbol), nil
+}
+
+// GetFees returns the fees, cached
+func (c *Cache) GetFees() (Fees, error) {
+	value, err := c.get(feesKey, func() (interface{}, error) {
+		return c.API.GetFees()
+	})
+	if err != nil {
+		return Fees{}, err
+	}
+	return value.(Fees), nil
+}
+
+// Cached returns the symbol market if it is cached and not expired, without
+// requesting it
+func (c *Cache) Cached(market string) (Symbol, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[symbolKey(market)]
+	if !ok || !time.Now().Before(entry.expires) {
+		return Symbol{}, false
+	}
+	return entry.value.(Symbol), true
+}
+
+// CachedSymbols returns the symbols if they are cached and not expired,
+// without requesting them
+func (c *Cache) CachedSymbols() ([]Symbol, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[symbolsKey]
+	if !ok || !time.Now().Before(entry.expires) {
+		return nil, false
+	}
+	return append([]Symbol(nil), entry.value.([]Symbol)...), true
+}
+
+// Invalidate empties the cache
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = make(map[string]cacheEntry)
+}
+
+// InvalidateSymbol removes the symbol market, and the symbols it is part of,
+// from the cache
+func (c *Cache) InvalidateSymbol(market string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	delete(c.entries, symbolKey(market))
+	delete(c.entries, symbolsKey)
+}
+
+// Refresh invalidates the symbol market and loads it again
+func (c *Cache) Refresh(market string) (Symbol, error) {
+	c.InvalidateSymbol(market)
+	return c.GetSymbol(market)
+}
+
+// flightGroup runs a single call at a time by key, the callers arriving while
+// it runs sharing its result
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func (g *flightGroup) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.value, call.err = fn()
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(call.done)
+	return call.value, call.err
+}
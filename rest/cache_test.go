@@ -0,0 +1,148 @@
+package rest_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/rest/resttest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	api := resttest.NewFakeAPI()
+	release := make(chan struct{})
+	api.GetSymbolsFunc = func() ([]rest.Symbol, error) {
+		<-release
+		return []rest.Symbol{{Id: 1, Status: "open"}}, nil
+	}
+	status := "open"
+	api.GetSymbolFunc = func(market string) (rest.Symbol, error) {
+		return rest.Symbol{Id: 1, Status: status}, nil
+	}
+	api.GetFeesFunc = func() (rest.Fees, error) {
+		return rest.Fees{}, errors.New("unavailable")
+	}
+	cache := rest.NewCache(api, rest.CacheOptions{TTL: 50 * time.Millisecond})
+
+	// concurrent calls share a single request
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			symbols, err := cache.GetSymbols()
+			require.NoError(t, err)
+			require.Len(t, symbols, 1)
+		}()
+	}
+	require.Eventually(t, func() bool { return len(api.CallsTo("GetSymbols")) == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	symbols, err := cache.GetSymbols()
+	require.NoError(t, err)
+	symbols[0].Status = "halt"
+	symbols, err = cache.GetSymbols()
+	require.NoError(t, err)
+	require.Equal(t, "open", symbols[0].Status)
+	require.Len(t, api.CallsTo("GetSymbols"), 1)
+	cachedSymbols, ok := cache.CachedSymbols()
+	require.True(t, ok)
+	require.Equal(t, symbols, cachedSymbols)
+
+	// the markets are case insensitive, served from memory until expired
+	symbol, err := cache.GetSymbol("btc-usd")
+	require.NoError(t, err)
+	require.Equal(t, "open", symbol.Status)
+	_, err = cache.GetSymbol("BTC-USD")
+	require.NoError(t, err)
+	require.Len(t, api.CallsTo("GetSymbol"), 1)
+	cached, ok := cache.Cached("BTC-USD")
+	require.True(t, ok)
+	require.Equal(t, symbol, cached)
+	time.Sleep(60 * time.Millisecond)
+	_, ok = cache.Cached("BTC-USD")
+	require.False(t, ok)
+	_, err = cache.GetSymbol("BTC-USD")
+	require.NoError(t, err)
+	require.Len(t, api.CallsTo("GetSymbol"), 2)
+
+	// a refresh reloads the symbol and invalidates the symbols
+	status = "halt"
+	symbol, err = cache.Refresh("BTC-USD")
+	require.NoError(t, err)
+	require.Equal(t, "halt", symbol.Status)
+	require.Len(t, api.CallsTo("GetSymbol"), 3)
+	_, err = cache.GetSymbols()
+	require.NoError(t, err)
+	require.Len(t, api.CallsTo("GetSymbols"), 2)
+
+	cache.Invalidate()
+	_, ok = cache.Cached("BTC-USD")
+	require.False(t, ok)
+
+	// errors are not cached
+	_, err = cache.GetFees()
+	require.EqualError(t, err, "unavailable")
+	_, err = cache.GetFees()
+	require.Error(t, err)
+	require.Len(t, api.CallsTo("GetFees"), 2)
+}
+
+func TestCacheRefreshInFlight(t *testing.T) {
+	api := resttest.NewFakeAPI()
+	release := make(chan struct{})
+	var calls sync.WaitGroup
+	calls.Add(1)
+	status := "open"
+	var mu sync.Mutex
+	api.GetSymbolFunc = func(market string) (rest.Symbol, error) {
+		mu.Lock()
+		current := status
+		mu.Unlock()
+		if current == "open" {
+			calls.Done()
+			<-release
+		}
+		return rest.Symbol{Id: 1, Status: current}, nil
+	}
+	cache := rest.NewCache(api, rest.CacheOptions{})
+
+	stale := make(chan rest.Symbol)
+	go func() {
+		symbol, err := cache.GetSymbol("BTC-USD")
+		require.NoError(t, err)
+		stale <- symbol
+	}()
+	calls.Wait()
+
+	// the refresh does not join the request in flight before it
+	mu.Lock()
+	status = "halt"
+	mu.Unlock()
+	refreshed := make(chan rest.Symbol)
+	go func() {
+		symbol, err := cache.Refresh("BTC-USD")
+		require.NoError(t, err)
+		refreshed <- symbol
+	}()
+	select {
+	case symbol := <-refreshed:
+		require.Equal(t, "halt", symbol.Status)
+	case <-time.After(time.Second):
+		close(release)
+		require.FailNow(t, "the refresh joined the request in flight")
+	}
+	require.Len(t, api.CallsTo("GetSymbol"), 2)
+
+	// nor is the stale response cached once it completes
+	close(release)
+	require.Equal(t, "open", (<-stale).Status)
+	symbol, err := cache.GetSymbol("BTC-USD")
+	require.NoError(t, err)
+	require.Equal(t, "halt", symbol.Status)
+	require.Len(t, api.CallsTo("GetSymbol"), 2)
+}
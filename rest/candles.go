@@ -0,0 +1,171 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/model"
+)
+
+// maxCandlesPerRequest is the number of candles requested at once, larger ranges are chunked
+const maxCandlesPerRequest = 1000
+
+// tradesPageSize is the number of trades requested per page when candles are synthesised
+const tradesPageSize = 100
+
+// candlesResponse is the body of the historical prices endpoint, each price being
+// [timestamp in ms, open, high, low, close, volume]
+type candlesResponse struct {
+	Prices [][]float64 `json:"prices"`
+}
+
+/* GetCandles returns the candles of symbol between from (inclusive) and to (exclusive),
+ * sorted by start time, with flat bars filling the intervals without trades between
+ * two candles. Nothing is added after the last candle, whose following intervals may
+ * not be published yet.
+ * Ranges larger than 1000 candles are downloaded in chunks, each chunk going through
+ * the rate limit set with SetRateLimit.
+ * When the historical prices endpoint is unavailable from the first chunk the candles
+ * are synthesised from GetTrades, which only covers the trades of the account. A later
+ * chunk failing returns the error, the market candles are never mixed with them.
+ * @param symbol (string) - e.g. BTC-USD
+ * @param granularity (time.Duration) - 1m, 5m, 15m, 1h, 6h or 24h for the prices endpoint
+ * @param from, to (time.Time) - range of candle start times
+ */
+func (client *Client) GetCandles(symbol string, granularity time.Duration, from, to time.Time) (candles []model.Candle, err error) {
+	if granularity < time.Second {
+		return nil, fmt.Errorf("invalid candle granularity %s", granularity)
+	}
+	from = from.Truncate(granularity)
+	chunk := granularity * maxCandlesPerRequest
+	for start := from; start.Before(to); start = start.Add(chunk) {
+		end := start.Add(chunk)
+		if end.After(to) {
+			end = to
+		}
+		var page []model.Candle
+		page, err = client.getCandlesChunk(symbol, granularity, start, end)
+		if apiErr, ok := err.(*APIError); ok && candlesUnavailable(apiErr) && start.Equal(from) {
+			candles, err = client.candlesFromTrades(symbol, granularity, from, to)
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, page...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Start.Before(candles[j].Start) })
+	return model.FillCandleGaps(candles, granularity, time.Time{}), nil
+}
+
+// candlesUnavailable reports whether the error means the historical prices endpoint cannot be used
+func candlesUnavailable(err *APIError) bool {
+	switch err.Status {
+	case http.StatusNotFound, http.StatusForbidden, http.StatusUnauthorized, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+func (client *Client) getCandlesChunk(symbol string, granularity time.Duration, start, end time.Time) (candles []model.Candle, err error) {
+	url := CANDLES_API
+	if client.candlesURL != "" {
+		url = client.candlesURL
+	}
+	params := map[string]string{
+		"symbol":      strings.ToUpper(symbol),
+		"start":       strconv.FormatInt(start.UnixMilli(), 10),
+		"end":         strconv.FormatInt(end.UnixMilli(), 10),
+		"granularity": strconv.FormatInt(int64(granularity/time.Second), 10),
+	}
+	r, err := client.do("GET", url, params, nil, false)
+	if err != nil {
+		return
+	}
+	var response candlesResponse
+	if err = json.Unmarshal(r, &response); err != nil {
+		return
+	}
+	for _, price := range response.Prices {
+		if len(price) < 6 {
+			return nil, fmt.Errorf("price for %s has %d values, expected 6", symbol, len(price))
+		}
+		t := time.UnixMilli(int64(price[0])).UTC()
+		if t.Before(start) || !t.Before(end) {
+			continue
+		}
+		candles = append(candles, model.Candle{
+			Symbol: symbol,
+			Start:  t,
+			End:    t.Add(granularity),
+			Open:   price[1],
+			High:   price[2],
+			Low:    price[3],
+			Close:  price[4],
+			Volume: price[5],
+		})
+	}
+	return
+}
+
+// candlesFromTrades aggregates the trade history of the account into candles
+func (client *Client) candlesFromTrades(symbol string, granularity time.Duration, from, to time.Time) ([]model.Candle, error) {
+	var trades []Trade
+	for next := from; next.Before(to); {
+		page, err := client.GetTrades(&GetTradesOpts{
+			Symbol: symbol,
+			From:   next.UnixMilli(),
+			To:     to.UnixMilli(),
+			Limit:  tradesPageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(page, func(i, j int) bool { return page[i].Timestamp.Before(page[j].Timestamp) })
+		trades = append(trades, page...)
+		if len(page) < tradesPageSize {
+			break
+		}
+		next = page[len(page)-1].Timestamp.Add(time.Millisecond)
+	}
+
+	var candles []model.Candle
+	seen := make(map[uint64]bool, len(trades))
+	for _, trade := range trades {
+		if seen[trade.Id] || trade.Timestamp.Before(from) || !trade.Timestamp.Before(to) {
+			continue
+		}
+		seen[trade.Id] = true
+		start := trade.Timestamp.Truncate(granularity).UTC()
+		if n := len(candles); n == 0 || !candles[n-1].Start.Equal(start) {
+			candles = append(candles, model.Candle{
+				Symbol: symbol,
+				Start:  start,
+				End:    start.Add(granularity),
+				Open:   trade.Price,
+				High:   trade.Price,
+				Low:    trade.Price,
+			})
+		}
+		c := &candles[len(candles)-1]
+		if trade.Price > c.High {
+			c.High = trade.Price
+		}
+		if trade.Price < c.Low {
+			c.Low = trade.Price
+		}
+		c.Close = trade.Price
+		c.Volume += trade.Quantity
+		c.Notional += trade.Quantity * trade.Price
+		c.Trades++
+	}
+	return candles, nil
+}
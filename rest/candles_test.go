@@ -0,0 +1,114 @@
+package rest_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/rest"
+
+	"github.com/stretchr/testify/require"
+)
+
+var candlesStart = time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+
+func TestGetCandles(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		start, _ := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		require.Equal(t, "60", r.URL.Query().Get("granularity"))
+		// a candle at the start of each chunk and another 2 minutes later
+		fmt.Fprintf(w, `{"prices":[[%d,1,2,0.5,1.5,10],[%d,1.5,3,1,2,5]]}`, start, start+120000)
+	}))
+	defer server.Close()
+
+	client := rest.NewClient("", "")
+	client.SetCandlesURL(server.URL)
+	to := candlesStart.Add(1500 * time.Minute)
+	candles, err := client.GetCandles("BTC-USD", time.Minute, candlesStart, to)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, requests)
+	// the gaps are filled up to the last candle, not up to to
+	require.Len(t, candles, 1003)
+	require.Equal(t, candlesStart, candles[0].Start)
+	require.Equal(t, 1.5, candles[1].Open)
+	require.Zero(t, candles[1].Volume)
+	require.Equal(t, 5.0, candles[2].Volume)
+	require.Equal(t, 10.0, candles[1000].Volume)
+	require.Equal(t, candlesStart.Add(1002*time.Minute), candles[1002].Start)
+	require.Equal(t, 5.0, candles[1002].Volume)
+}
+
+func TestGetCandlesChunkUnavailable(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prices", func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		if start != candlesStart.UnixMilli() {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"prices":[[%d,1,2,0.5,1.5,10]]}`, start)
+	})
+	mux.HandleFunc("/trades", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("market candles mixed with the trades of the account")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := rest.NewClient("key", "secret")
+	client.SetBaseURL(server.URL)
+	client.SetCandlesURL(server.URL + "/prices")
+	_, err := client.GetCandles("BTC-USD", time.Minute, candlesStart, candlesStart.Add(1500*time.Minute))
+	var apiErr *rest.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.Status)
+}
+
+func TestGetCandlesFromTrades(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prices", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/trades", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"id":2,"symbol":"BTC-USD","side":"buy","price":"110","quantity":"2","timestamp":"2022-05-01T00:00:30Z"},
+			{"id":1,"symbol":"BTC-USD","side":"sell","price":"100","quantity":"1","timestamp":"2022-05-01T00:00:10Z"},
+			{"id":3,"symbol":"BTC-USD","side":"sell","price":"90","quantity":"1","timestamp":"2022-05-01T00:02:10Z"}
+		]`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := rest.NewClient("key", "secret")
+	client.SetBaseURL(server.URL)
+	client.SetCandlesURL(server.URL + "/prices")
+	candles, err := client.GetCandles("BTC-USD", time.Minute, candlesStart, candlesStart.Add(3*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, candles, 3)
+	require.Equal(t, 100.0, candles[0].Open)
+	require.Equal(t, 110.0, candles[0].Close)
+	require.Equal(t, 2, candles[0].Trades)
+	require.Equal(t, 320.0, candles[0].Notional)
+	require.Equal(t, 110.0, candles[1].Close)
+	require.Equal(t, 90.0, candles[2].Close)
+}
+
+func TestRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"prices":[]}`)
+	}))
+	defer server.Close()
+
+	client := rest.NewClient("", "")
+	client.SetCandlesURL(server.URL)
+	client.SetRateLimit(50, 1)
+	begin := time.Now()
+	_, err := client.GetCandles("BTC-USD", time.Minute, candlesStart, candlesStart.Add(3000*time.Minute))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(begin), 40*time.Millisecond)
+}
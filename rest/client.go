@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -8,12 +9,17 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/hmedkouri/go-bcex/tracing"
 )
 
 const (
-	API_BASE = "https://api.blockchain.com/v3/exchange" // BCEX API endpoint
+	API_BASE    = "https://api.blockchain.com/v3/exchange"                          // BCEX API endpoint
+	CANDLES_API = "https://api.blockchain.com/nabu-gateway/markets/exchange/prices" // BCEX historical prices endpoint
 )
 
 type Client struct {
@@ -22,11 +28,17 @@ type Client struct {
 	httpClient  *http.Client
 	httpTimeout time.Duration
 	debug       bool
+	baseURL     string
+	candlesURL  string
+	observers   *observers
+	chain       *chain
+	// ctx is the parent context of the requests, see WithContext
+	ctx context.Context
 }
 
 // NewClient return a new HTTP client
 func NewClient(apiKey, apiSecret string) (c *Client) {
-	return &Client{apiKey, apiSecret, &http.Client{}, 30 * time.Second, false}
+	return &Client{apiKey: apiKey, apiSecret: apiSecret, httpClient: &http.Client{}, httpTimeout: 30 * time.Second, observers: &observers{}, chain: &chain{}}
 }
 
 // NewClientWithCustomHttpConfig returns a new HTTP client using the predefined http client
@@ -35,12 +47,49 @@ func NewClientWithCustomHttpConfig(apiKey, apiSecret string, httpClient *http.Cl
 	if timeout <= 0 {
 		timeout = 30 * time.Second
 	}
-	return &Client{apiKey, apiSecret, httpClient, timeout, false}
+	return &Client{apiKey: apiKey, apiSecret: apiSecret, httpClient: httpClient, httpTimeout: timeout, observers: &observers{}, chain: &chain{}}
 }
 
 // NewClient returns a new HTTP client with custom timeout
 func NewClientWithCustomTimeout(apiKey, apiSecret string, timeout time.Duration) (c *Client) {
-	return &Client{apiKey, apiSecret, &http.Client{}, timeout, false}
+	return &Client{apiKey: apiKey, apiSecret: apiSecret, httpClient: &http.Client{}, httpTimeout: timeout, observers: &observers{}, chain: &chain{}}
+}
+
+// SetBaseURL replaces the API endpoint, API_BASE by default, e.g. to target a sandbox
+func (c *Client) SetBaseURL(baseURL string) {
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// SetCandlesURL replaces the historical prices endpoint, CANDLES_API by default
+func (c *Client) SetCandlesURL(candlesURL string) {
+	c.candlesURL = candlesURL
+}
+
+// SetRateLimit limits the HTTP exchanges sent, retries included, to
+// requestsPerSecond on average, with bursts of up to burst exchanges, with the
+// RateLimit middleware placed first in the chain. It replaces the limit set
+// before. Exchanges over the limit wait for their turn, within the timeout of
+// their request. A rate of zero or less removes the limit.
+func (c *Client) SetRateLimit(requestsPerSecond float64, burst int) {
+	var limit Middleware
+	if requestsPerSecond > 0 {
+		limit = RateLimit(requestsPerSecond, burst)
+	}
+	c.chain.mu.Lock()
+	defer c.chain.mu.Unlock()
+	c.chain.rateLimit = limit
+}
+
+// WithContext returns a copy of the client whose requests are made with ctx:
+// they are canceled with it and their spans are children of its span. The
+// copy shares the configuration of c, its metrics and tracer included.
+func (c *Client) WithContext(ctx context.Context) API {
+	if ctx == nil {
+		panic("nil context")
+	}
+	clone := *c
+	clone.ctx = ctx
+	return &clone
 }
 
 func (c Client) dumpRequest(r *http.Request) {
@@ -78,13 +127,7 @@ func (c *Client) doTimeoutRequest(timer *time.Timer, req *http.Request) (*http.R
 	}
 	done := make(chan result, 1)
 	go func() {
-		if c.debug {
-			c.dumpRequest(req)
-		}
-		resp, err := c.httpClient.Do(req)
-		if c.debug {
-			c.dumpResponse(resp)
-		}
+		resp, err := c.doer().Do(req)
 		done <- result{resp, err}
 	}()
 	// Wait for the read or the timeout
@@ -98,13 +141,35 @@ func (c *Client) doTimeoutRequest(timer *time.Timer, req *http.Request) (*http.R
 
 // do prepare and process HTTP request to Rest API
 func (c *Client) do(method string, resource string, params map[string]string, payload []byte, authNeeded bool) (response []byte, err error) {
+	start, status := time.Now(), "error"
+	metrics, tracer := c.observers.get()
+	ctx, span := startSpan(c.context(), tracer, method, resource)
+	ctx, attempts := withAttempts(ctx)
+	ctx, cancel := context.WithCancel(withEndpoint(ctx, resource))
+	defer cancel()
+	defer func() {
+		metrics.request(resource, method, status, time.Since(start))
+		retries := int(atomic.LoadInt32(attempts)) - 1
+		if retries < 0 {
+			retries = 0
+		}
+		span.SetAttributes(tracing.String("http.status", status), tracing.Int("bcex.retries", retries))
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
 	connectTimer := time.NewTimer(c.httpTimeout)
 
 	var rawurl string
 	if strings.HasPrefix(resource, "http") {
 		rawurl = resource
 	} else {
-		rawurl = fmt.Sprintf("%s/%s", API_BASE, resource)
+		base := API_BASE
+		if c.baseURL != "" {
+			base = c.baseURL
+		}
+		rawurl = fmt.Sprintf("%s/%s", base, resource)
 	}
 
 	var req *http.Request
@@ -121,13 +186,13 @@ func (c *Client) do(method string, resource string, params map[string]string, pa
 		formData := q.Encode()
 		URL.RawQuery = formData
 		rawurl = URL.String()
-		req, err = http.NewRequest(method, rawurl, nil)
+		req, err = http.NewRequestWithContext(ctx, method, rawurl, nil)
 		if err != nil {
 			return
 		}
 	} else {
 		body := strings.NewReader(string(payload))
-		req, err = http.NewRequest(method, rawurl, body)
+		req, err = http.NewRequestWithContext(ctx, method, rawurl, body)
 		if err != nil {
 			return
 		}
@@ -152,6 +217,7 @@ func (c *Client) do(method string, resource string, params map[string]string, pa
 	}
 
 	defer resp.Body.Close()
+	status = strconv.Itoa(resp.StatusCode)
 	response, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return response, err
@@ -0,0 +1,74 @@
+package rest
+
+import (
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/metrics"
+	"github.com/hmedkouri/go-bcex/tracing"
+)
+
+// restMetrics records the requests of a Client, see SetMetrics
+type restMetrics struct {
+	requests *metrics.Counter
+	duration *metrics.Histogram
+}
+
+// SetMetrics records the requests of the client in registry: their number by
+// endpoint, method and status, "error" when no response was received, and
+// their duration. Nil stops the recording. It may be called while requests
+// are in flight, they are recorded as configured when they started.
+func (c *Client) SetMetrics(registry *metrics.Registry) {
+	var m *restMetrics
+	if registry != nil {
+		m = &restMetrics{
+			requests: registry.Counter("bcex_rest_requests_total", "Rest requests by endpoint, method and status.", "endpoint", "method", "status"),
+			duration: registry.Histogram("bcex_rest_request_duration_seconds", "Rest request duration.", nil, "endpoint", "method"),
+		}
+	}
+	c.observers.mu.Lock()
+	defer c.observers.mu.Unlock()
+	c.observers.metrics = m
+}
+
+// observers are the metrics and the tracer of a Client, set while it may be
+// in use and shared with its copies, see WithContext
+type observers struct {
+	mu      sync.RWMutex
+	metrics *restMetrics
+	tracer  tracing.Tracer
+}
+
+func (o *observers) get() (*restMetrics, tracing.Tracer) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.metrics, o.tracer
+}
+
+func (m *restMetrics) request(resource, method, status string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	e := endpoint(resource)
+	m.requests.Inc(e, method, status)
+	m.duration.Observe(d.Seconds(), e, method)
+}
+
+// endpoint names the endpoint of resource, an absolute URL by the last
+// element of its path, and the ids of the resources, e.g. orders/123, by
+// ":id" to bound the number of series
+func endpoint(resource string) string {
+	if strings.HasPrefix(resource, "http") {
+		if u, err := url.Parse(resource); err == nil {
+			return path.Base(u.Path)
+		}
+		return resource
+	}
+	if i := strings.Index(resource, "/"); i >= 0 {
+		return resource[:i] + "/:id"
+	}
+	return resource
+}
@@ -0,0 +1,82 @@
+package rest_test
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hmedkouri/go-bcex/metrics"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/tracing/tracetest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/symbols" {
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	registry := metrics.NewRegistry()
+	client := rest.NewClient("key", "secret")
+	client.SetBaseURL(server.URL)
+	client.SetMetrics(registry)
+	_, err := client.GetSymbols()
+	require.NoError(t, err)
+	_, err = client.GetOrderById(123)
+	require.Error(t, err)
+	client.SetBaseURL("http://127.0.0.1:1")
+	_, err = client.GetSymbols()
+	require.Error(t, err)
+
+	var out strings.Builder
+	_, err = registry.WriteTo(&out)
+	require.NoError(t, err)
+	require.Contains(t, out.String(), `
+bcex_rest_requests_total{endpoint="orders/:id",method="GET",status="404"} 1
+bcex_rest_requests_total{endpoint="symbols",method="GET",status="200"} 1
+bcex_rest_requests_total{endpoint="symbols",method="GET",status="error"} 1
+`)
+	require.Contains(t, out.String(), `bcex_rest_request_duration_seconds_count{endpoint="symbols",method="GET"} 2`)
+}
+
+func TestSetObserversConcurrently(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	client := rest.NewClient("", "")
+	client.SetBaseURL(server.URL)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := client.GetSymbols()
+				require.NoError(t, err)
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		client.SetMetrics(metrics.NewRegistry())
+		client.SetTracerProvider(tracetest.NewRecorder())
+		client.SetRateLimit(1000, 10)
+		client.Use(rest.Logging(log.New(io.Discard, "", 0)))
+		client.SetMetrics(nil)
+		client.SetTracerProvider(nil)
+		client.SetRateLimit(0, 0)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,221 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/metrics"
+)
+
+// Doer sends an HTTP request and returns its response, as *http.Client does
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DoerFunc adapts a function to a Doer
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps the Doer sending the requests of a Client, to alter the
+// requests, their responses or how they are sent
+type Middleware func(next Doer) Doer
+
+// Use appends middlewares to the chain the requests of the client go through,
+// the first one receiving the request first. The requests carry the endpoint
+// they call, see Endpoint, and a context cancelled when the client gives up
+// on them.
+func (c *Client) Use(middlewares ...Middleware) {
+	c.chain.mu.Lock()
+	defer c.chain.mu.Unlock()
+	c.chain.middlewares = append(c.chain.middlewares, middlewares...)
+}
+
+// chain is the middlewares of a Client, set while it may be in use and
+// shared with its copies, see WithContext
+type chain struct {
+	mu sync.RWMutex
+	// rateLimit is the RateLimit middleware set by SetRateLimit, first in
+	// the chain
+	rateLimit   Middleware
+	middlewares []Middleware
+}
+
+// doer returns the middlewares chained around the HTTP exchange
+func (c *Client) doer() Doer {
+	c.chain.mu.RLock()
+	defer c.chain.mu.RUnlock()
+	var d Doer = DoerFunc(c.exchange)
+	for i := len(c.chain.middlewares) - 1; i >= 0; i-- {
+		d = c.chain.middlewares[i](d)
+	}
+	if c.chain.rateLimit != nil {
+		d = c.chain.rateLimit(d)
+	}
+	return d
+}
+
+// exchange sends req with the HTTP client, the end of the middleware chain
+func (c *Client) exchange(req *http.Request) (*http.Response, error) {
+	if c.debug {
+		c.dumpRequest(req)
+	}
+	countAttempt(req.Context())
+	resp, err := c.httpClient.Do(req)
+	if c.debug {
+		c.dumpResponse(resp)
+	}
+	return resp, err
+}
+
+type endpointKey struct{}
+
+func withEndpoint(ctx context.Context, resource string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint(resource))
+}
+
+// Endpoint returns the endpoint called by a request of a Client, e.g.
+// "symbols" or "orders/:id", the ids being replaced to bound the number of
+// values
+func Endpoint(req *http.Request) string {
+	e, _ := req.Context().Value(endpointKey{}).(string)
+	return e
+}
+
+// Logging logs each HTTP exchange, with its duration and status, to logger,
+// the standard logger when nil
+func Logging(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+			if err != nil {
+				logger.Printf("%s %s failed after %s: %s", req.Method, req.URL.Path, time.Since(start), err)
+				return resp, err
+			}
+			logger.Printf("%s %s %d in %s", req.Method, req.URL.Path, resp.StatusCode, time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// Metrics records each HTTP exchange, retries included, in registry: their
+// number by endpoint, method and status and their duration. SetMetrics
+// records the requests of the client instead.
+func Metrics(registry *metrics.Registry) Middleware {
+	exchanges := registry.Counter("bcex_rest_exchanges_total", "Rest HTTP exchanges by endpoint, method and status.", "endpoint", "method", "status")
+	duration := registry.Histogram("bcex_rest_exchange_duration_seconds", "Rest HTTP exchange duration.", nil, "endpoint", "method")
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+			status := "error"
+			if err == nil {
+				status = strconv.Itoa(resp.StatusCode)
+			}
+			exchanges.Inc(Endpoint(req), req.Method, status)
+			duration.Observe(time.Since(start).Seconds(), Endpoint(req), req.Method)
+			return resp, err
+		})
+	}
+}
+
+// RateLimit delays the HTTP exchanges, retries included, to requestsPerSecond
+// on average with bursts of up to burst exchanges, see SetRateLimit. A rate of
+// zero or less does not limit them.
+func RateLimit(requestsPerSecond float64, burst int) Middleware {
+	if requestsPerSecond <= 0 {
+		return func(next Doer) Doer { return next }
+	}
+	limiter := newRateLimiter(requestsPerSecond, burst)
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if err := limiter.wait(req.Context()); err != nil {
+				return nil, err
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+// RetryOptions configures the Retry middleware
+type RetryOptions struct {
+	// MaxAttempts is the number of exchanges of a request, 3 when zero
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each
+	// following one, 100ms when zero
+	Backoff time.Duration
+	// Methods are the methods retried, GET and DELETE when nil. Creating an
+	// order is not idempotent, retrying it may place it twice.
+	Methods []string
+}
+
+// Retry sends a request again when the exchange fails or the API answers
+// 429 Too Many Requests or a 5xx status, until it succeeds or MaxAttempts
+// is reached. The retries are counted in the span of the request.
+func Retry(opts RetryOptions) Middleware {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 100 * time.Millisecond
+	}
+	if opts.Methods == nil {
+		opts.Methods = []string{http.MethodGet, http.MethodDelete}
+	}
+	retried := make(map[string]bool, len(opts.Methods))
+	for _, method := range opts.Methods {
+		retried[method] = true
+	}
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if !retried[req.Method] {
+				return next.Do(req)
+			}
+			backoff := opts.Backoff
+			for attempt := 1; ; attempt++ {
+				// each attempt gets its own copy, the next middlewares may alter it
+				attemptReq := req.Clone(req.Context())
+				if req.GetBody != nil {
+					body, err := req.GetBody()
+					if err != nil {
+						return nil, err
+					}
+					attemptReq.Body = body
+				}
+				resp, err := next.Do(attemptReq)
+				if attempt == opts.MaxAttempts || !retryable(resp, err) {
+					return resp, err
+				}
+				if resp != nil {
+					io.Copy(ioutil.Discard, resp.Body)
+					resp.Body.Close()
+				}
+				select {
+				case <-time.After(backoff):
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				}
+				backoff *= 2
+			}
+		})
+	}
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
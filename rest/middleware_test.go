@@ -0,0 +1,126 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/metrics"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/tracing/tracetest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var failures int32 = 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "outer,inner", r.Header.Get("X-Chain"))
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	chain := func(name string) rest.Middleware {
+		return func(next rest.Doer) rest.Doer {
+			return rest.DoerFunc(func(req *http.Request) (*http.Response, error) {
+				if chain := req.Header.Get("X-Chain"); chain != "" {
+					req.Header.Set("X-Chain", chain+","+name)
+				} else {
+					req.Header.Set("X-Chain", name)
+				}
+				return next.Do(req)
+			})
+		}
+	}
+	var logs bytes.Buffer
+	registry := metrics.NewRegistry()
+	recorder := tracetest.NewRecorder()
+	client := rest.NewClient("key", "secret")
+	client.SetBaseURL(server.URL)
+	client.SetTracerProvider(recorder)
+	client.Use(
+		chain("outer"),
+		rest.Retry(rest.RetryOptions{Backoff: time.Millisecond}),
+		rest.Logging(log.New(&logs, "", 0)),
+		rest.Metrics(registry),
+		chain("inner"),
+	)
+
+	_, err := client.GetSymbols()
+	require.NoError(t, err)
+	require.Equal(t, 2, recorder.Spans()[0].Attributes["bcex.retries"])
+	require.Equal(t, "GET /symbols 503 in", strings.Join(strings.Fields(strings.Split(logs.String(), "\n")[0])[:4], " "))
+	require.Len(t, strings.Split(strings.TrimSpace(logs.String()), "\n"), 3)
+	var out strings.Builder
+	registry.WriteTo(&out)
+	require.Contains(t, out.String(), `
+bcex_rest_exchanges_total{endpoint="symbols",method="GET",status="200"} 1
+bcex_rest_exchanges_total{endpoint="symbols",method="GET",status="503"} 2
+`)
+
+	// orders are not created twice
+	atomic.StoreInt32(&failures, 1)
+	_, err = client.CreateOrder(rest.BaseOrder{ClOrdId: "c1", Symbol: "BTC-USD"})
+	require.Error(t, err)
+	require.Equal(t, 0, recorder.Spans()[1].Attributes["bcex.retries"])
+
+	// the attempts are bounded
+	atomic.StoreInt32(&failures, 5)
+	_, err = client.GetSymbols()
+	require.Error(t, err)
+	require.Equal(t, 2, recorder.Spans()[2].Attributes["bcex.retries"])
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	client := rest.NewClient("", "")
+	client.SetBaseURL(server.URL)
+	client.Use(rest.RateLimit(50, 1))
+	begin := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := client.GetSymbols()
+		require.NoError(t, err)
+	}
+	require.GreaterOrEqual(t, time.Since(begin), 40*time.Millisecond)
+
+	// a request waiting for its turn gives up with its context
+	client = rest.NewClient("", "")
+	client.SetBaseURL(server.URL)
+	client.SetRateLimit(0.1, 1)
+	_, err := client.GetSymbols()
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begin = time.Now()
+	_, err = client.WithContext(ctx).GetSymbols()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(begin), time.Second)
+
+	// no limit without a rate
+	for _, rate := range []float64{0, -1} {
+		client := rest.NewClient("", "")
+		client.SetBaseURL(server.URL)
+		client.Use(rest.RateLimit(rate, 1))
+		begin := time.Now()
+		for i := 0; i < 3; i++ {
+			_, err := client.GetSymbols()
+			require.NoError(t, err)
+		}
+		require.Less(t, time.Since(begin), time.Second)
+	}
+}
@@ -0,0 +1,194 @@
+package rest
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/model"
+)
+
+// ToModel converts the side into its transport-neutral representation
+func (s Side) ToModel() model.Side {
+	side, _ := model.ParseSide(string(s))
+	return side
+}
+
+// ToModel converts the order type into its transport-neutral representation
+func (t OrdType) ToModel() model.OrderType {
+	ordType, _ := model.ParseOrderType(string(t))
+	return ordType
+}
+
+// ToModel converts the order status into its transport-neutral representation
+func (s OrderStatus) ToModel() model.OrderStatus {
+	status, _ := model.ParseOrderStatus(string(s))
+	return status
+}
+
+// ToModel converts the time in force into its transport-neutral representation
+func (t TimeInForce) ToModel() model.TimeInForce {
+	tif, _ := model.ParseTimeInForce(string(t))
+	return tif
+}
+
+// SideFromModel returns the Rest API side for a model side
+func SideFromModel(s model.Side) Side {
+	if s == model.SELL {
+		return SELL
+	}
+	return BUY
+}
+
+// OrdTypeFromModel returns the Rest API order type for a model order type
+func OrdTypeFromModel(t model.OrderType) OrdType {
+	switch t {
+	case model.MARKET:
+		return MARKET
+	case model.STOP:
+		return STOP
+	case model.STOP_LIMIT:
+		return STOPLIMIT
+	}
+	return LIMIT
+}
+
+// OrderStatusFromModel returns the Rest API order status for a model order status
+func OrderStatusFromModel(s model.OrderStatus) OrderStatus {
+	switch s {
+	case model.PARTIAL:
+		return PART_FILLED
+	case model.FILLED:
+		return FILLED
+	case model.CANCELLED:
+		return CANCELED
+	case model.REJECTED:
+		return REJECTED
+	case model.EXPIRED:
+		return EXPIRED
+	}
+	return OPEN
+}
+
+// NewBaseOrder builds the Rest API order payload for a model order request
+func NewBaseOrder(r model.OrderRequest) BaseOrder {
+	order := BaseOrder{
+		ClOrdId:     r.ClOrdID,
+		OrdType:     OrdTypeFromModel(r.Type),
+		Symbol:      r.Symbol,
+		Side:        SideFromModel(r.Side),
+		OrderQty:    r.Qty,
+		TimeInForce: TimeInForce(r.TimeInForce),
+		Price:       r.Price,
+		MinQty:      r.MinQty,
+		StopPx:      r.StopPx,
+	}
+	if r.PostOnly {
+		order.ExecInst = ALO
+	}
+	if !r.ExpireDate.IsZero() {
+		date, _ := strconv.Atoi(r.ExpireDate.Format("20060102"))
+		order.ExpireDate = int32(date)
+	}
+	return order
+}
+
+// ToModel converts the order summary into a model order
+func (o OrderSummary) ToModel() model.Order {
+	order := model.Order{
+		ClOrdID:   o.ClOrdId,
+		Symbol:    o.Symbol,
+		Side:      o.Side.ToModel(),
+		Type:      o.OrdType.ToModel(),
+		Status:    o.OrdStatus.ToModel(),
+		Price:     o.Price,
+		OrderQty:  o.LeavesQty + o.CumQty,
+		LeavesQty: o.LeavesQty,
+		CumQty:    o.CumQty,
+		AvgPx:     o.AvgPx,
+		Text:      o.Text,
+	}
+	if o.ExOrdId != 0 {
+		order.OrderID = strconv.FormatInt(o.ExOrdId, 10)
+	}
+	if o.Timestamp != 0 {
+		order.Time = time.UnixMilli(o.Timestamp)
+	}
+	return order
+}
+
+// ToFill converts an order summary returned by GetFills into a model fill
+func (o OrderSummary) ToFill() model.Fill {
+	fill := model.Fill{
+		ClOrdID: o.ClOrdId,
+		Symbol:  o.Symbol,
+		Side:    o.Side.ToModel(),
+		Price:   o.LastPx,
+		Qty:     o.LastShares,
+	}
+	if o.ExOrdId != 0 {
+		fill.OrderID = strconv.FormatInt(o.ExOrdId, 10)
+	}
+	if o.Timestamp != 0 {
+		fill.Time = time.UnixMilli(o.Timestamp)
+	}
+	return fill
+}
+
+// ToModel converts the trade into a model fill
+func (t Trade) ToModel() model.Fill {
+	side, _ := model.ParseSide(t.Type)
+	return model.Fill{
+		TradeID: strconv.FormatUint(t.Id, 10),
+		OrderID: strconv.FormatUint(t.OrderId, 10),
+		ClOrdID: t.ClientOrderId,
+		Symbol:  t.Symbol,
+		Side:    side,
+		Price:   t.Price,
+		Qty:     t.Quantity,
+		Fee:     t.Fee,
+		Time:    t.Timestamp,
+	}
+}
+
+// ToModel converts the balance into a model balance
+func (b Balance) ToModel() model.Balance {
+	return model.Balance{
+		Currency:       b.Currency,
+		Balance:        b.Balance,
+		Available:      b.Available,
+		BalanceLocal:   b.BalanceLocal,
+		AvailableLocal: b.AvailableLocal,
+		Rate:           b.Rate,
+	}
+}
+
+// Name returns the market identifier of the symbol, e.g. BTC-USD
+func (s Symbol) Name() string {
+	return strings.ToUpper(s.BaseCurrency + "-" + s.CounterCurrency)
+}
+
+// ToModel converts the symbol into model reference data
+func (s Symbol) ToModel() model.Symbol {
+	return model.Symbol{
+		Name:                   s.Name(),
+		ID:                     s.Id,
+		BaseCurrency:           s.BaseCurrency,
+		BaseCurrencyScale:      int(s.BaseCurrencyScale),
+		CounterCurrency:        s.CounterCurrency,
+		CounterCurrencyScale:   int(s.CounterCurrencyScale),
+		MinPriceIncrement:      s.MinPriceIncrement,
+		MinPriceIncrementScale: int(s.MinPriceIncrementScale),
+		MinOrderSize:           s.MinOrderSize,
+		MinOrderSizeScale:      int(s.MinOrderSizeScale),
+		MaxOrderSize:           s.MaxOrderSize,
+		MaxOrderSizeScale:      int(s.MaxOrderSizeScale),
+		LotSize:                s.LotSize,
+		LotSizeScale:           int(s.LotSizeScale),
+		Status:                 s.Status,
+		AuctionPrice:           s.AuctionPrice,
+		AuctionSize:            s.AuctionSize,
+		AuctionTime:            s.AuctionTime,
+		Imbalance:              s.Imbalance,
+	}
+}
@@ -0,0 +1,250 @@
+// Package resttest provides an in-memory implementation of rest.API for use in tests.
+package resttest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/metrics"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/tracing"
+)
+
+// Call records a single invocation of a fake method
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Recorder keeps the calls made on a fake
+type Recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (r *Recorder) record(method string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{method, args})
+}
+
+// Calls returns the calls made so far, in order
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := make([]Call, len(r.calls))
+	copy(calls, r.calls)
+	return calls
+}
+
+// CallsTo returns the calls made so far to method, in order
+func (r *Recorder) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range r.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the calls made so far
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// FakeAPI is a rest.API recording every call. Each method returns the result of
+// the matching Func field when set, and zero values otherwise; WithContext
+// returns the fake itself. The settings are only recorded.
+type FakeAPI struct {
+	Recorder
+
+	GetSymbolsFunc      func() ([]rest.Symbol, error)
+	GetSymbolFunc       func(market string) (rest.Symbol, error)
+	GetAllTickerFunc    func() (rest.Tickers, error)
+	GetTickerFunc       func(market string) (rest.Ticker, error)
+	GetL2OrderbookFunc  func(market string) (rest.OrderBook, error)
+	GetL3OrderbookFunc  func(market string) (rest.OrderBook, error)
+	GetCandlesFunc      func(symbol string, granularity time.Duration, from, to time.Time) ([]model.Candle, error)
+	CreateOrderFunc     func(requestOrder rest.BaseOrder) (rest.OrderSummary, error)
+	DeleteAllOrdersFunc func(options *rest.DeleteAllOrdersOpts) error
+	GetFeesFunc         func() (rest.Fees, error)
+	GetBalancesFunc     func() (rest.BalanceMap, error)
+	GetTradesFunc       func(options *rest.GetTradesOpts) ([]rest.Trade, error)
+	GetOrdersFunc       func(options *rest.GetOrdersOpts) ([]rest.OrderSummary, error)
+	GetFillsFunc        func(options *rest.GetFillsOpts) ([]rest.OrderSummary, error)
+	GetOrderByIdFunc    func(orderId int64) (rest.OrderSummary, error)
+	DeleteOrderByIdFunc func(orderId int64) error
+	WithContextFunc     func(ctx context.Context) rest.API
+}
+
+var _ rest.API = (*FakeAPI)(nil)
+
+// NewFakeAPI returns a FakeAPI with no canned responses
+func NewFakeAPI() *FakeAPI {
+	return &FakeAPI{}
+}
+
+func (f *FakeAPI) GetSymbols() ([]rest.Symbol, error) {
+	f.record("GetSymbols")
+	if f.GetSymbolsFunc != nil {
+		return f.GetSymbolsFunc()
+	}
+	return nil, nil
+}
+
+func (f *FakeAPI) GetSymbol(market string) (rest.Symbol, error) {
+	f.record("GetSymbol", market)
+	if f.GetSymbolFunc != nil {
+		return f.GetSymbolFunc(market)
+	}
+	return rest.Symbol{}, nil
+}
+
+func (f *FakeAPI) GetAllTicker() (rest.Tickers, error) {
+	f.record("GetAllTicker")
+	if f.GetAllTickerFunc != nil {
+		return f.GetAllTickerFunc()
+	}
+	return nil, nil
+}
+
+func (f *FakeAPI) GetTicker(market string) (rest.Ticker, error) {
+	f.record("GetTicker", market)
+	if f.GetTickerFunc != nil {
+		return f.GetTickerFunc(market)
+	}
+	return rest.Ticker{}, nil
+}
+
+func (f *FakeAPI) GetL2Orderbook(market string) (rest.OrderBook, error) {
+	f.record("GetL2Orderbook", market)
+	if f.GetL2OrderbookFunc != nil {
+		return f.GetL2OrderbookFunc(market)
+	}
+	return rest.OrderBook{}, nil
+}
+
+func (f *FakeAPI) GetL3Orderbook(market string) (rest.OrderBook, error) {
+	f.record("GetL3Orderbook", market)
+	if f.GetL3OrderbookFunc != nil {
+		return f.GetL3OrderbookFunc(market)
+	}
+	return rest.OrderBook{}, nil
+}
+
+func (f *FakeAPI) GetCandles(symbol string, granularity time.Duration, from, to time.Time) ([]model.Candle, error) {
+	f.record("GetCandles", symbol, granularity, from, to)
+	if f.GetCandlesFunc != nil {
+		return f.GetCandlesFunc(symbol, granularity, from, to)
+	}
+	return nil, nil
+}
+
+func (f *FakeAPI) CreateOrder(requestOrder rest.BaseOrder) (rest.OrderSummary, error) {
+	f.record("CreateOrder", requestOrder)
+	if f.CreateOrderFunc != nil {
+		return f.CreateOrderFunc(requestOrder)
+	}
+	return rest.OrderSummary{}, nil
+}
+
+func (f *FakeAPI) DeleteAllOrders(options *rest.DeleteAllOrdersOpts) error {
+	f.record("DeleteAllOrders", options)
+	if f.DeleteAllOrdersFunc != nil {
+		return f.DeleteAllOrdersFunc(options)
+	}
+	return nil
+}
+
+func (f *FakeAPI) GetFees() (rest.Fees, error) {
+	f.record("GetFees")
+	if f.GetFeesFunc != nil {
+		return f.GetFeesFunc()
+	}
+	return rest.Fees{}, nil
+}
+
+func (f *FakeAPI) GetBalances() (rest.BalanceMap, error) {
+	f.record("GetBalances")
+	if f.GetBalancesFunc != nil {
+		return f.GetBalancesFunc()
+	}
+	return rest.BalanceMap{}, nil
+}
+
+func (f *FakeAPI) GetTrades(options *rest.GetTradesOpts) ([]rest.Trade, error) {
+	f.record("GetTrades", options)
+	if f.GetTradesFunc != nil {
+		return f.GetTradesFunc(options)
+	}
+	return nil, nil
+}
+
+func (f *FakeAPI) GetOrders(options *rest.GetOrdersOpts) ([]rest.OrderSummary, error) {
+	f.record("GetOrders", options)
+	if f.GetOrdersFunc != nil {
+		return f.GetOrdersFunc(options)
+	}
+	return nil, nil
+}
+
+func (f *FakeAPI) GetFills(options *rest.GetFillsOpts) ([]rest.OrderSummary, error) {
+	f.record("GetFills", options)
+	if f.GetFillsFunc != nil {
+		return f.GetFillsFunc(options)
+	}
+	return nil, nil
+}
+
+func (f *FakeAPI) GetOrderById(orderId int64) (rest.OrderSummary, error) {
+	f.record("GetOrderById", orderId)
+	if f.GetOrderByIdFunc != nil {
+		return f.GetOrderByIdFunc(orderId)
+	}
+	return rest.OrderSummary{}, nil
+}
+
+func (f *FakeAPI) DeleteOrderById(orderId int64) error {
+	f.record("DeleteOrderById", orderId)
+	if f.DeleteOrderByIdFunc != nil {
+		return f.DeleteOrderByIdFunc(orderId)
+	}
+	return nil
+}
+
+func (f *FakeAPI) SetBaseURL(baseURL string) {
+	f.record("SetBaseURL", baseURL)
+}
+
+func (f *FakeAPI) SetCandlesURL(candlesURL string) {
+	f.record("SetCandlesURL", candlesURL)
+}
+
+func (f *FakeAPI) SetRateLimit(requestsPerSecond float64, burst int) {
+	f.record("SetRateLimit", requestsPerSecond, burst)
+}
+
+func (f *FakeAPI) SetMetrics(registry *metrics.Registry) {
+	f.record("SetMetrics", registry)
+}
+
+func (f *FakeAPI) SetTracerProvider(provider tracing.TracerProvider) {
+	f.record("SetTracerProvider", provider)
+}
+
+func (f *FakeAPI) Use(middlewares ...rest.Middleware) {
+	f.record("Use", middlewares)
+}
+
+func (f *FakeAPI) WithContext(ctx context.Context) rest.API {
+	f.record("WithContext", ctx)
+	if f.WithContextFunc != nil {
+		return f.WithContextFunc(ctx)
+	}
+	return f
+}
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/hmedkouri/go-bcex/tracing"
+)
+
+// TracerName is the name of the tracer of the rest spans
+const TracerName = "github.com/hmedkouri/go-bcex/rest"
+
+// SetTracerProvider reports a span for each request of the client to
+// provider, named after its method and endpoint and carrying its status and
+// retries. The spans are children of the span of the context given to
+// WithContext, if any. Nil disables the tracing, the default. It may be
+// called while requests are in flight, they are traced as configured when
+// they started.
+func (c *Client) SetTracerProvider(provider tracing.TracerProvider) {
+	var tracer tracing.Tracer
+	if provider != nil {
+		tracer = provider.Tracer(TracerName)
+	}
+	c.observers.mu.Lock()
+	defer c.observers.mu.Unlock()
+	c.observers.tracer = tracer
+}
+
+// context returns the parent context of the requests
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// startSpan starts the span of a request with tracer, a child of the span of
+// ctx if any
+func startSpan(ctx context.Context, tracer tracing.Tracer, method, resource string) (context.Context, tracing.Span) {
+	if tracer == nil {
+		tracer = tracing.NoopProvider().Tracer(TracerName)
+	}
+	e := endpoint(resource)
+	return tracer.Start(ctx, method+" "+e,
+		tracing.String("http.method", method),
+		tracing.String("bcex.endpoint", e),
+	)
+}
+
+type attemptsKey struct{}
+
+// withAttempts returns a context counting the HTTP exchanges of a request
+func withAttempts(ctx context.Context) (context.Context, *int32) {
+	attempts := new(int32)
+	return context.WithValue(ctx, attemptsKey{}, attempts), attempts
+}
+
+// countAttempt counts an HTTP exchange of the request of ctx
+func countAttempt(ctx context.Context) {
+	if attempts, ok := ctx.Value(attemptsKey{}).(*int32); ok {
+		atomic.AddInt32(attempts, 1)
+	}
+}
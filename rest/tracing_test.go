@@ -0,0 +1,69 @@
+package rest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/tracing/tracetest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/symbols/BTC-USD" {
+			fmt.Fprint(w, `{"base_currency":"BTC"}`)
+			return
+		}
+		http.Error(w, "invalid", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	recorder := tracetest.NewRecorder()
+	client := rest.NewClient("key", "secret")
+	client.SetBaseURL(server.URL)
+	client.SetTracerProvider(recorder)
+	_, err := client.GetSymbol("btc-usd")
+	require.NoError(t, err)
+	require.Error(t, client.DeleteOrderById(1))
+
+	spans := recorder.Spans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "GET symbols/:id", spans[0].Name)
+	require.Equal(t, rest.TracerName, spans[0].Tracer)
+	require.True(t, spans[0].Ended)
+	require.NoError(t, spans[0].Err)
+	require.Equal(t, map[string]interface{}{
+		"http.method":   "GET",
+		"bcex.endpoint": "symbols/:id",
+		"http.status":   "200",
+		"bcex.retries":  0,
+	}, spans[0].Attributes)
+	require.Equal(t, "DELETE orders/:id", spans[1].Name)
+	require.Equal(t, "400", spans[1].Attributes["http.status"])
+	require.Error(t, spans[1].Err)
+
+	// the requests made with a context are children of its span
+	ctx, parent := recorder.Tracer("app").Start(context.Background(), "parent")
+	_, err = client.WithContext(ctx).GetSymbol("BTC-USD")
+	require.NoError(t, err)
+	parent.End()
+	spans = recorder.Spans()
+	require.Len(t, spans, 4)
+	require.Equal(t, spans[2].ID, spans[3].ParentID)
+	require.Zero(t, spans[0].ParentID)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = client.WithContext(canceled).GetSymbol("BTC-USD")
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, recorder.Spans(), 5)
+
+	client.SetTracerProvider(nil)
+	_, err = client.GetSymbol("BTC-USD")
+	require.NoError(t, err)
+	require.Len(t, recorder.Spans(), 5)
+}
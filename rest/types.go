@@ -263,6 +263,14 @@ const (
 	GTD TimeInForce = "GTD"
 )
 
+// ExecInst \"ALO\" for Add Liquidity Only (post only): the order is rejected rather than matching on arrival
+type ExecInst string
+
+// List of ExecInst
+const (
+	ALO ExecInst = "ALO"
+)
+
 // BaseOrder struct for BaseOrder
 type BaseOrder struct {
 	// Reference field provided by client. Cannot exceed 20 characters, only alphanumeric characters are allowed.
@@ -282,6 +290,8 @@ type BaseOrder struct {
 	MinQty float64 `json:"minQty,omitempty"`
 	// The limit price for the order
 	StopPx float64 `json:"stopPx,omitempty"`
+	// ALO to only add liquidity
+	ExecInst ExecInst `json:"execInst,omitempty"`
 }
 
 // parameterToString convert interface{} parameters to string, using a delimiter if format is provided.
@@ -0,0 +1,328 @@
+package bcex
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// List of the trading statuses of a symbol
+const (
+	StatusOpen       = "open"
+	StatusClose      = "close"
+	StatusSuspend    = "suspend"
+	StatusHalt       = "halt"
+	StatusHaltFreeze = "halt-freeze"
+)
+
+// ErrMarketNotOpen is returned by a gated Trader placing an order on a symbol
+// whose status is not open
+var ErrMarketNotOpen = errors.New("market not open")
+
+// Halted reports whether status is one of the halt statuses, during which the
+// symbol may reopen on an auction
+func Halted(status string) bool {
+	return status == StatusHalt || status == StatusHaltFreeze
+}
+
+// AuctionState is the opening auction of a halted symbol
+type AuctionState struct {
+	Symbol string
+	Status string
+	// Price and Size are the expected opening price and size
+	Price float64
+	Size  float64
+	// Time is the opening time in HHMM format
+	Time string
+	// Imbalance is the quantity left over at the auction price, buy orders
+	// when positive and sell orders when negative
+	Imbalance float64
+	Updated   time.Time
+}
+
+// SymbolEvent is a change of the trading status or of the auction of a symbol
+type SymbolEvent struct {
+	Symbol string
+	// Previous is the status before the change, empty for a symbol not known
+	// before
+	Previous string
+	Status   string
+	// StatusChanged is false for the auction updates of a halted symbol
+	StatusChanged bool
+	// Auction is the auction state when the symbol is halted
+	Auction *AuctionState
+	// Received is when the symbols message was received
+	Received time.Time
+}
+
+// SymbolRegistryOptions configures a SymbolRegistry
+type SymbolRegistryOptions struct {
+	// EventBuffer is the capacity of the event stream, 256 when zero. Events
+	// are dropped when the stream is full.
+	EventBuffer int
+	// MessageBuffer is the capacity of the buffer of the symbols messages,
+	// 4096 when zero, enough for the snapshot of all the symbols received
+	// while the Rest symbols load. The messages beyond it wait, none is
+	// dropped.
+	MessageBuffer int
+}
+
+type symbolState struct {
+	symbol model.Symbol
+	// updated is when the state was received, or requested for the Rest
+	// symbols
+	updated time.Time
+}
+
+// SymbolRegistry tracks the reference data and the trading status of the
+// symbols. It is bootstrapped from the Rest symbols, then kept up to date from
+// the symbols channel of the websocket, reporting the status changes and the
+// auctions of the halted symbols as events.
+type SymbolRegistry struct {
+	api      rest.API
+	streamer ws.Streamer
+	opts     SymbolRegistryOptions
+
+	mu      sync.RWMutex
+	symbols map[string]*symbolState
+	dropped int
+
+	events   chan SymbolEvent
+	listener *ws.Listener
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSymbolRegistry returns a registry using api for the bootstrap and streamer for the updates
+func NewSymbolRegistry(api rest.API, streamer ws.Streamer, opts SymbolRegistryOptions) *SymbolRegistry {
+	if opts.EventBuffer <= 0 {
+		opts.EventBuffer = 256
+	}
+	if opts.MessageBuffer <= 0 {
+		opts.MessageBuffer = 4096
+	}
+	return &SymbolRegistry{
+		api:      api,
+		streamer: streamer,
+		opts:     opts,
+		symbols:  make(map[string]*symbolState),
+		events:   make(chan SymbolEvent, opts.EventBuffer),
+		done:     make(chan struct{}),
+	}
+}
+
+// Symbols returns a SymbolRegistry over the Rest and websocket clients
+func (c *Client) Symbols() *SymbolRegistry {
+	return NewSymbolRegistry(c.Rest, c.Ws, SymbolRegistryOptions{})
+}
+
+// Start subscribes to the symbols channel, loads the Rest symbols and then
+// applies the websocket messages until Stop is called. Messages received
+// while the Rest symbols are loading are applied after them, those received
+// before they were requested are ignored. No message is missed: the symbols
+// are received with a lossless Listener.
+func (r *SymbolRegistry) Start() error {
+	listener := r.streamer.Listen(ws.ListenerOptions{Channels: []string{"symbols"}, Buffer: r.opts.MessageBuffer, Lossless: true})
+	if err := r.streamer.SubscribeToSymbols(); err != nil {
+		listener.Close()
+		return fmt.Errorf("subscribing to symbols: %w", err)
+	}
+	requested := time.Now()
+	symbols, err := r.api.GetSymbols()
+	if err != nil {
+		listener.Close()
+		return fmt.Errorf("loading symbols: %w", err)
+	}
+	r.mu.Lock()
+	for _, symbol := range symbols {
+		r.symbols[symbol.Name()] = &symbolState{symbol: symbol.ToModel(), updated: requested}
+	}
+	r.listener = listener
+	r.mu.Unlock()
+	go r.run(listener)
+	return nil
+}
+
+// Stop ends the consumption of the websocket messages and closes the event stream
+func (r *SymbolRegistry) Stop() {
+	r.stopOnce.Do(func() {
+		r.mu.RLock()
+		listener := r.listener
+		r.mu.RUnlock()
+		if listener != nil {
+			listener.Close()
+			<-r.done
+		}
+		close(r.events)
+	})
+}
+
+func (r *SymbolRegistry) run(listener *ws.Listener) {
+	defer close(r.done)
+	for msg := range listener.C {
+		if symbol, ok := msg.(ws.SymbolMsg); ok {
+			r.apply(symbol)
+		}
+	}
+}
+
+func (r *SymbolRegistry) apply(msg ws.SymbolMsg) {
+	received := msg.Received
+	if received.IsZero() {
+		received = time.Now()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name := string(msg.Name)
+	state, known := r.symbols[name]
+	if known && received.Before(state.updated) {
+		// older than the state, e.g. a snapshot the Rest symbols include
+		return
+	}
+	if !known {
+		state = &symbolState{}
+		r.symbols[name] = state
+	}
+	previous := state.symbol
+	state.symbol = msg.ToModel()
+	state.updated = received
+
+	event := SymbolEvent{
+		Symbol:        name,
+		Previous:      previous.Status,
+		Status:        msg.Status,
+		StatusChanged: !known || previous.Status != msg.Status,
+		Received:      received,
+	}
+	if Halted(msg.Status) {
+		auction := auctionOf(state)
+		event.Auction = &auction
+	}
+	auctionChanged := Halted(msg.Status) && (previous.AuctionPrice != msg.AuctionPrice ||
+		previous.AuctionSize != msg.AuctionSize ||
+		previous.AuctionTime != msg.AuctionTime ||
+		previous.Imbalance != msg.Imbalance)
+	if !event.StatusChanged && !auctionChanged {
+		return
+	}
+	select {
+	case r.events <- event:
+	default:
+		r.dropped++
+	}
+}
+
+func auctionOf(state *symbolState) AuctionState {
+	return AuctionState{
+		Symbol:    state.symbol.Name,
+		Status:    state.symbol.Status,
+		Price:     state.symbol.AuctionPrice,
+		Size:      state.symbol.AuctionSize,
+		Time:      state.symbol.AuctionTime,
+		Imbalance: state.symbol.Imbalance,
+		Updated:   state.updated,
+	}
+}
+
+// Events returns the stream of the status changes and auction updates. It is
+// closed by Stop.
+func (r *SymbolRegistry) Events() <-chan SymbolEvent {
+	return r.events
+}
+
+// DroppedEvents counts the events not delivered because the event stream was full
+func (r *SymbolRegistry) DroppedEvents() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.dropped
+}
+
+// Symbol returns the reference data of symbol
+func (r *SymbolRegistry) Symbol(symbol string) (model.Symbol, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	state, ok := r.symbols[symbol]
+	if !ok {
+		return model.Symbol{}, false
+	}
+	return state.symbol, true
+}
+
+// Status returns the trading status of symbol, empty when it is not known
+func (r *SymbolRegistry) Status(symbol string) string {
+	s, _ := r.Symbol(symbol)
+	return s.Status
+}
+
+// Names returns the known symbols, sorted
+func (r *SymbolRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.symbols))
+	for name := range r.symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Auction returns the auction state of symbol when it is halted
+func (r *SymbolRegistry) Auction(symbol string) (AuctionState, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	state, ok := r.symbols[symbol]
+	if !ok || !Halted(state.symbol.Status) {
+		return AuctionState{}, false
+	}
+	return auctionOf(state), true
+}
+
+// Auctions returns the auction states of the halted symbols, sorted by symbol
+func (r *SymbolRegistry) Auctions() []AuctionState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var auctions []AuctionState
+	for _, state := range r.symbols {
+		if Halted(state.symbol.Status) {
+			auctions = append(auctions, auctionOf(state))
+		}
+	}
+	sort.Slice(auctions, func(i, j int) bool { return auctions[i].Symbol < auctions[j].Symbol })
+	return auctions
+}
+
+// CanTrade returns an error wrapping ErrMarketNotOpen when symbol is known and
+// its status is not open. The symbols not known are left to the exchange.
+func (r *SymbolRegistry) CanTrade(symbol string) error {
+	s, ok := r.Symbol(symbol)
+	if !ok || s.Status == StatusOpen {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is %s", ErrMarketNotOpen, symbol, s.Status)
+}
+
+// Gate returns a Trader refusing, with CanTrade, the orders placed on the
+// symbols whose market is not open. The other requests, cancellations
+// included, go to trader.
+func (r *SymbolRegistry) Gate(trader Trader) Trader {
+	return &gatedTrader{trader, r}
+}
+
+type gatedTrader struct {
+	Trader
+	registry *SymbolRegistry
+}
+
+// PlaceOrder submits the order when its market is open
+func (t *gatedTrader) PlaceOrder(order model.OrderRequest) (model.Order, error) {
+	if err := t.registry.CanTrade(order.Symbol); err != nil {
+		return model.Order{}, err
+	}
+	return t.Trader.PlaceOrder(order)
+}
@@ -0,0 +1,209 @@
+package bcex_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	bcex "github.com/hmedkouri/go-bcex"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/rest/resttest"
+	"github.com/hmedkouri/go-bcex/ws"
+	"github.com/hmedkouri/go-bcex/ws/wstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func nextSymbolEvent(t *testing.T, events <-chan bcex.SymbolEvent) bcex.SymbolEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(t, "no symbol event received")
+		return bcex.SymbolEvent{}
+	}
+}
+
+func TestSymbolRegistry(t *testing.T) {
+	api := resttest.NewFakeAPI()
+	api.GetSymbolsFunc = func() ([]rest.Symbol, error) {
+		return []rest.Symbol{
+			{BaseCurrency: "BTC", CounterCurrency: "USD", Status: "open"},
+			{BaseCurrency: "ETH", CounterCurrency: "USD", Status: "open"},
+		}, nil
+	}
+	streamer := wstest.NewFakeStreamer(16)
+	registry := bcex.NewSymbolRegistry(api, streamer, bcex.SymbolRegistryOptions{})
+	require.NoError(t, registry.Start())
+	defer registry.Stop()
+	require.Len(t, streamer.CallsTo("SubscribeToSymbols"), 1)
+	require.Equal(t, []string{"BTC-USD", "ETH-USD"}, registry.Names())
+	require.Equal(t, bcex.StatusOpen, registry.Status("BTC-USD"))
+
+	trader := &stubTrader{}
+	gated := registry.Gate(trader)
+	_, err := gated.PlaceOrder(model.OrderRequest{Symbol: "BTC-USD"})
+	require.NoError(t, err)
+
+	// an unchanged status is not reported
+	streamer.Publish(ws.SymbolMsg{Name: "ETH-USD", BaseCurrency: "ETH", CounterCurrency: "USD", Status: "open"})
+	// the halt is reported with its auction
+	streamer.Publish(ws.SymbolMsg{Name: "BTC-USD", Status: "halt", AuctionPrice: 100, AuctionSize: 2, AuctionTime: "1430", Imbalance: -1})
+	event := nextSymbolEvent(t, registry.Events())
+	require.Equal(t, "BTC-USD", event.Symbol)
+	require.Equal(t, "open", event.Previous)
+	require.Equal(t, "halt", event.Status)
+	require.True(t, event.StatusChanged)
+	require.NotNil(t, event.Auction)
+	require.Equal(t, 100.0, event.Auction.Price)
+
+	auction, ok := registry.Auction("BTC-USD")
+	require.True(t, ok)
+	require.Equal(t, "1430", auction.Time)
+	require.Equal(t, -1.0, auction.Imbalance)
+	_, ok = registry.Auction("ETH-USD")
+	require.False(t, ok)
+
+	// no orders on a halted market, cancellations still go through
+	_, err = gated.PlaceOrder(model.OrderRequest{Symbol: "BTC-USD"})
+	require.True(t, errors.Is(err, bcex.ErrMarketNotOpen))
+	require.EqualError(t, err, "market not open: BTC-USD is halt")
+	require.NoError(t, gated.CancelAll("BTC-USD"))
+	require.Equal(t, []string{"PlaceOrder", "CancelAll"}, trader.calls)
+
+	// the auction updates of a halted symbol are reported
+	streamer.Publish(ws.SymbolMsg{Name: "BTC-USD", Status: "halt", AuctionPrice: 101, AuctionSize: 2, AuctionTime: "1430", Imbalance: 0})
+	event = nextSymbolEvent(t, registry.Events())
+	require.False(t, event.StatusChanged)
+	require.Equal(t, 101.0, event.Auction.Price)
+	require.Len(t, registry.Auctions(), 1)
+
+	// the market reopens
+	streamer.Publish(ws.SymbolMsg{Name: "BTC-USD", Status: "open"})
+	event = nextSymbolEvent(t, registry.Events())
+	require.Equal(t, "halt", event.Previous)
+	require.Nil(t, event.Auction)
+	require.Empty(t, registry.Auctions())
+	_, err = gated.PlaceOrder(model.OrderRequest{Symbol: "BTC-USD"})
+	require.NoError(t, err)
+
+	// a new symbol is reported, the symbols not known are not gated
+	streamer.Publish(ws.SymbolMsg{Name: "LTC-USD", Status: "suspend"})
+	event = nextSymbolEvent(t, registry.Events())
+	require.Equal(t, "", event.Previous)
+	require.Equal(t, "suspend", event.Status)
+	require.Error(t, registry.CanTrade("LTC-USD"))
+	require.NoError(t, registry.CanTrade("XRP-USD"))
+
+	registry.Stop()
+	_, open := <-registry.Events()
+	require.False(t, open)
+	require.Zero(t, registry.DroppedEvents())
+}
+
+func TestSymbolRegistryBootstrapError(t *testing.T) {
+	api := resttest.NewFakeAPI()
+	api.GetSymbolsFunc = func() ([]rest.Symbol, error) {
+		return nil, errors.New("unavailable")
+	}
+	registry := bcex.NewSymbolRegistry(api, wstest.NewFakeStreamer(16), bcex.SymbolRegistryOptions{})
+	require.EqualError(t, registry.Start(), "loading symbols: unavailable")
+	registry.Stop()
+}
+
+func TestSymbolRegistryMessages(t *testing.T) {
+	api := resttest.NewFakeAPI()
+	streamer := wstest.NewFakeStreamer(16)
+	api.GetSymbolsFunc = func() ([]rest.Symbol, error) {
+		// a halt received before the Rest symbols were requested is outdated by them
+		streamer.Publish(ws.SymbolMsg{Name: "BTC-USD", Status: "halt", Received: time.Now().Add(-time.Minute)})
+		return []rest.Symbol{{BaseCurrency: "BTC", CounterCurrency: "USD", Status: "open"}}, nil
+	}
+	registry := bcex.NewSymbolRegistry(api, streamer, bcex.SymbolRegistryOptions{MessageBuffer: 1})
+	require.NoError(t, registry.Start())
+	defer registry.Stop()
+
+	// no message is dropped when the registry falls behind
+	statuses := []string{bcex.StatusHalt, bcex.StatusOpen}
+	for i := 0; i < 100; i++ {
+		streamer.Publish(ws.SymbolMsg{Name: "BTC-USD", Status: statuses[i%2]})
+	}
+	for i := 0; i < 100; i++ {
+		event := nextSymbolEvent(t, registry.Events())
+		require.Equal(t, statuses[i%2], event.Status)
+		require.Equal(t, statuses[(i+1)%2], event.Previous)
+	}
+	require.Equal(t, bcex.StatusOpen, registry.Status("BTC-USD"))
+	require.Zero(t, registry.DroppedEvents())
+}
+
+// replayStreamer is a client fed with raw frames by Replay, whose subscription
+// to the symbols needs no connection
+type replayStreamer struct {
+	*ws.WebSocketClient
+}
+
+func (replayStreamer) SubscribeToSymbols() error { return nil }
+
+type frames []ws.Frame
+
+func (f *frames) Next() (ws.Frame, error) {
+	if len(*f) == 0 {
+		return ws.Frame{}, io.EOF
+	}
+	frame := (*f)[0]
+	*f = (*f)[1:]
+	return frame, nil
+}
+
+func replay(t *testing.T, client *ws.WebSocketClient, msgs ...string) {
+	f := frames{}
+	for _, msg := range msgs {
+		f = append(f, ws.NewFrame([]byte(msg), time.Now()))
+	}
+	require.NoError(t, client.Replay(&f, ws.ReplayOptions{}))
+}
+
+func TestSymbolRegistryFrames(t *testing.T) {
+	client := ws.NewWebSocketClient(ws.Configuration{})
+	api := resttest.NewFakeAPI()
+	var (
+		symbols  []rest.Symbol
+		snapshot []string
+	)
+	for i := 0; i < 1000; i++ {
+		symbols = append(symbols, rest.Symbol{BaseCurrency: fmt.Sprintf("C%d", i), CounterCurrency: "USD", Status: "open"})
+		snapshot = append(snapshot, fmt.Sprintf(`"C%d-USD":{"base_currency":"C%d","counter_currency":"USD","status":"open"}`, i, i))
+	}
+	api.GetSymbolsFunc = func() ([]rest.Symbol, error) {
+		// the snapshot and a halt are received while the Rest symbols load
+		replay(t, client,
+			`{"seqnum":1,"event":"snapshot","channel":"symbols","symbols":{`+strings.Join(snapshot, ",")+`}}`,
+			`{"seqnum":2,"event":"updated","channel":"symbols","symbol":"C1-USD","base_currency":"C1","counter_currency":"USD","status":"halt","auction_price":100,"auction_size":2,"auction_time":"1430"}`,
+		)
+		return symbols, nil
+	}
+	registry := bcex.NewSymbolRegistry(api, replayStreamer{client}, bcex.SymbolRegistryOptions{})
+	require.NoError(t, registry.Start())
+	defer registry.Stop()
+
+	event := nextSymbolEvent(t, registry.Events())
+	require.Equal(t, "C1-USD", event.Symbol)
+	require.Equal(t, "open", event.Previous)
+	require.Equal(t, "halt", event.Status)
+	require.Equal(t, 100.0, event.Auction.Price)
+	require.Len(t, registry.Names(), 1000)
+	_, err := registry.Gate(&stubTrader{}).PlaceOrder(model.OrderRequest{Symbol: "C1-USD"})
+	require.ErrorIs(t, err, bcex.ErrMarketNotOpen)
+
+	// the market reopens
+	replay(t, client, `{"seqnum":3,"event":"updated","channel":"symbols","symbol":"C1-USD","base_currency":"C1","counter_currency":"USD","status":"open"}`)
+	event = nextSymbolEvent(t, registry.Events())
+	require.Equal(t, "open", event.Status)
+	require.NoError(t, registry.CanTrade("C1-USD"))
+	require.Zero(t, registry.DroppedEvents())
+}
@@ -0,0 +1,142 @@
+// Package tracetest provides an in-memory tracing.TracerProvider recording
+// the spans for use in tests.
+package tracetest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/tracing"
+)
+
+// Event is an event recorded on a span
+type Event struct {
+	Name       string
+	Attributes map[string]interface{}
+}
+
+// Span is a recorded span
+type Span struct {
+	Name string
+	// Tracer is the name of the tracer that started the span
+	Tracer string
+	// ID identifies the span, ParentID its parent, zero for a root span
+	ID         int
+	ParentID   int
+	Attributes map[string]interface{}
+	Events     []Event
+	Err        error
+	Start      time.Time
+	End        time.Time
+	Ended      bool
+}
+
+// Recorder is a tracing.TracerProvider keeping the spans in memory
+type Recorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+var _ tracing.TracerProvider = (*Recorder)(nil)
+
+// NewRecorder returns an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Tracer(name string) tracing.Tracer {
+	return tracer{r: r, name: name}
+}
+
+// Spans returns a copy of the spans started so far, in order
+func (r *Recorder) Spans() []Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]Span, len(r.spans))
+	for i, s := range r.spans {
+		spans[i] = *s
+		spans[i].Attributes = make(map[string]interface{}, len(s.Attributes))
+		for k, v := range s.Attributes {
+			spans[i].Attributes[k] = v
+		}
+		spans[i].Events = append([]Event(nil), s.Events...)
+	}
+	return spans
+}
+
+// Named returns the spans started so far with name, in order
+func (r *Recorder) Named(name string) []Span {
+	var named []Span
+	for _, s := range r.Spans() {
+		if s.Name == name {
+			named = append(named, s)
+		}
+	}
+	return named
+}
+
+type spanKey struct{}
+
+type tracer struct {
+	r    *Recorder
+	name string
+}
+
+func (t tracer) Start(ctx context.Context, name string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+	t.r.mu.Lock()
+	defer t.r.mu.Unlock()
+	s := &Span{
+		Name:       name,
+		Tracer:     t.name,
+		ID:         len(t.r.spans) + 1,
+		Attributes: make(map[string]interface{}),
+		Start:      time.Now(),
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.ParentID = parent.s.ID
+	}
+	setAttributes(s.Attributes, attrs)
+	t.r.spans = append(t.r.spans, s)
+	sp := &span{r: t.r, s: s}
+	return context.WithValue(ctx, spanKey{}, sp), sp
+}
+
+// span updates its record under the lock of the recorder
+type span struct {
+	r *Recorder
+	s *Span
+}
+
+func (s *span) SetAttributes(attrs ...tracing.Attribute) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	setAttributes(s.s.Attributes, attrs)
+}
+
+func (s *span) AddEvent(name string, attrs ...tracing.Attribute) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	event := Event{Name: name, Attributes: make(map[string]interface{})}
+	setAttributes(event.Attributes, attrs)
+	s.s.Events = append(s.s.Events, event)
+}
+
+func (s *span) RecordError(err error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.s.Err = err
+}
+
+func (s *span) End() {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.s.End = time.Now()
+	s.s.Ended = true
+}
+
+func setAttributes(m map[string]interface{}, attrs []tracing.Attribute) {
+	for _, attr := range attrs {
+		m[attr.Key] = attr.Value
+	}
+}
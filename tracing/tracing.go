@@ -0,0 +1,74 @@
+// Package tracing defines the tracer the rest and ws clients report their
+// spans to. Its interfaces follow the shape of the OpenTelemetry tracing API,
+// so an OpenTelemetry TracerProvider is plugged in with a thin adapter, see
+// the README, while the library itself does not depend on it. Tracing is
+// disabled by default.
+package tracing
+
+import "context"
+
+// Attribute is a key value pair describing a span or an event
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Float64 returns a float attribute
+func Float64(key string, value float64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// TracerProvider returns the tracers of the instrumented packages
+type TracerProvider interface {
+	// Tracer returns the tracer of the package name
+	Tracer(name string) Tracer
+}
+
+// Tracer starts spans
+type Tracer interface {
+	// Start starts the span name, a child of the span of ctx if any, and
+	// returns it with a context carrying it
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation being traced
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// AddEvent records something that happened during the span
+	AddEvent(name string, attrs ...Attribute)
+	// RecordError marks the span failed with err
+	RecordError(err error)
+	// End completes the span, it must be called once
+	End()
+}
+
+// NoopProvider returns a provider whose spans record nothing, the default of
+// the clients
+func NoopProvider() TracerProvider {
+	return noopProvider{}
+}
+
+type noopProvider struct{}
+type noopTracer struct{}
+type noopSpan struct{}
+
+func (noopProvider) Tracer(string) Tracer { return noopTracer{} }
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopSpan) SetAttributes(...Attribute)    {}
+func (noopSpan) AddEvent(string, ...Attribute) {}
+func (noopSpan) RecordError(error)             {}
+func (noopSpan) End()                          {}
@@ -0,0 +1,224 @@
+package bcex
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// ErrNotSupported is returned by a Trader when the transport cannot serve the request
+var ErrNotSupported = errors.New("operation not supported by this transport")
+
+// Trader is the transport-agnostic order entry interface
+type Trader interface {
+	// PlaceOrder submits a new order
+	PlaceOrder(order model.OrderRequest) (model.Order, error)
+	// CancelOrder cancels a single order by its exchange order id
+	CancelOrder(orderID string) error
+	// CancelAll cancels all open orders, of a symbol if specified
+	CancelAll(symbol string) error
+	// GetOrder returns the current state of an order
+	GetOrder(orderID string) (model.Order, error)
+	// OpenOrders returns the live orders, of a symbol if specified
+	OpenOrders(symbol string) ([]model.Order, error)
+}
+
+// RestTrader is a Trader backed by the Rest API
+type RestTrader struct {
+	client rest.API
+}
+
+// NewRestTrader returns a Trader sending orders over the Rest API
+func NewRestTrader(client rest.API) *RestTrader {
+	return &RestTrader{client}
+}
+
+// PlaceOrder submits the order with CreateOrder
+func (t *RestTrader) PlaceOrder(order model.OrderRequest) (model.Order, error) {
+	summary, err := t.client.CreateOrder(rest.NewBaseOrder(order))
+	if err != nil {
+		return model.Order{}, err
+	}
+	return summary.ToModel(), nil
+}
+
+// CancelOrder cancels the order with DeleteOrderById
+func (t *RestTrader) CancelOrder(orderID string) error {
+	id, err := strconv.ParseInt(orderID, 10, 64)
+	if err != nil {
+		return err
+	}
+	return t.client.DeleteOrderById(id)
+}
+
+// CancelAll cancels the orders with DeleteAllOrders
+func (t *RestTrader) CancelAll(symbol string) error {
+	return t.client.DeleteAllOrders(&rest.DeleteAllOrdersOpts{Symbol: symbol})
+}
+
+// GetOrder returns the order with GetOrderById
+func (t *RestTrader) GetOrder(orderID string) (model.Order, error) {
+	id, err := strconv.ParseInt(orderID, 10, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+	summary, err := t.client.GetOrderById(id)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return summary.ToModel(), nil
+}
+
+// OpenOrders returns the live orders with GetOrders
+func (t *RestTrader) OpenOrders(symbol string) ([]model.Order, error) {
+	summaries, err := t.client.GetOrders(&rest.GetOrdersOpts{Symbol: symbol})
+	if err != nil {
+		return nil, err
+	}
+	orders := make([]model.Order, 0, len(summaries))
+	for _, summary := range summaries {
+		order := summary.ToModel()
+		if !order.Status.IsTerminal() {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// WsTrader is a Trader backed by the websocket trading channel.
+// Order entry is asynchronous: execution reports are delivered on Trading().
+type WsTrader struct {
+	client ws.Streamer
+}
+
+// NewWsTrader returns a Trader sending orders over the websocket connection
+func NewWsTrader(client ws.Streamer) *WsTrader {
+	return &WsTrader{client}
+}
+
+// PlaceOrder sends a NewOrderSingle message and returns the order as pending
+func (t *WsTrader) PlaceOrder(order model.OrderRequest) (model.Order, error) {
+	if err := t.client.NewOrderSingleMessage(ws.NewOrderSingleFromModel(order)); err != nil {
+		return model.Order{}, err
+	}
+	return model.Order{
+		ClOrdID:     order.ClOrdID,
+		Symbol:      order.Symbol,
+		Side:        order.Side,
+		Type:        order.Type,
+		TimeInForce: order.TimeInForce,
+		Status:      model.PENDING,
+		Price:       order.Price,
+		OrderQty:    order.Qty,
+		LeavesQty:   order.Qty,
+	}, nil
+}
+
+// CancelOrder sends a CancelOrderRequest message
+func (t *WsTrader) CancelOrder(orderID string) error {
+	return t.client.CancelOrder(orderID)
+}
+
+// CancelAll sends a BulkCancelOrderRequest message
+func (t *WsTrader) CancelAll(symbol string) error {
+	if symbol == "" {
+		return t.client.BulkCancel(nil)
+	}
+	s := ws.Symbol(symbol)
+	return t.client.BulkCancel(&s)
+}
+
+// GetOrder is not available over the websocket API
+func (t *WsTrader) GetOrder(orderID string) (model.Order, error) {
+	return model.Order{}, ErrNotSupported
+}
+
+// OpenOrders is not available over the websocket API
+func (t *WsTrader) OpenOrders(symbol string) ([]model.Order, error) {
+	return nil, ErrNotSupported
+}
+
+// Router is a Trader using the websocket session when it is available and
+// falling back to the Rest API otherwise
+type Router struct {
+	ws          Trader
+	rest        Trader
+	wsAvailable func() bool
+}
+
+// NewRouter returns a Trader routing to wsTrader while wsAvailable reports true, and to restTrader otherwise
+func NewRouter(wsTrader, restTrader Trader, wsAvailable func() bool) *Router {
+	return &Router{wsTrader, restTrader, wsAvailable}
+}
+
+// useWs reports whether the request should be attempted on the websocket session
+func (r *Router) useWs() bool {
+	return r.ws != nil && r.wsAvailable != nil && r.wsAvailable()
+}
+
+// fallback reports whether a failed websocket request should be retried over Rest,
+// i.e. the transport cannot serve it or the session dropped while sending it
+func (r *Router) fallback(err error) bool {
+	return errors.Is(err, ErrNotSupported) || !r.useWs()
+}
+
+// PlaceOrder submits the order. Unlike the other requests, an order whose
+// websocket send failed is not retried over Rest: it may have reached the
+// exchange before the session dropped, and sending it again could place it
+// twice. Only an order the websocket transport refused to send falls back.
+func (r *Router) PlaceOrder(order model.OrderRequest) (model.Order, error) {
+	if r.useWs() {
+		o, err := r.ws.PlaceOrder(order)
+		if err == nil || !errors.Is(err, ErrNotSupported) {
+			return o, err
+		}
+	}
+	return r.rest.PlaceOrder(order)
+}
+
+// CancelOrder cancels a single order
+func (r *Router) CancelOrder(orderID string) error {
+	if r.useWs() {
+		err := r.ws.CancelOrder(orderID)
+		if err == nil || !r.fallback(err) {
+			return err
+		}
+	}
+	return r.rest.CancelOrder(orderID)
+}
+
+// CancelAll cancels all open orders, of a symbol if specified
+func (r *Router) CancelAll(symbol string) error {
+	if r.useWs() {
+		err := r.ws.CancelAll(symbol)
+		if err == nil || !r.fallback(err) {
+			return err
+		}
+	}
+	return r.rest.CancelAll(symbol)
+}
+
+// GetOrder returns the current state of an order
+func (r *Router) GetOrder(orderID string) (model.Order, error) {
+	if r.useWs() {
+		o, err := r.ws.GetOrder(orderID)
+		if err == nil || !r.fallback(err) {
+			return o, err
+		}
+	}
+	return r.rest.GetOrder(orderID)
+}
+
+// OpenOrders returns the live orders, of a symbol if specified
+func (r *Router) OpenOrders(symbol string) ([]model.Order, error) {
+	if r.useWs() {
+		orders, err := r.ws.OpenOrders(symbol)
+		if err == nil || !r.fallback(err) {
+			return orders, err
+		}
+	}
+	return r.rest.OpenOrders(symbol)
+}
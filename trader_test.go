@@ -0,0 +1,134 @@
+package bcex_test
+
+import (
+	"errors"
+	"testing"
+
+	bcex "github.com/hmedkouri/go-bcex"
+	"github.com/hmedkouri/go-bcex/model"
+	"github.com/hmedkouri/go-bcex/rest"
+	"github.com/hmedkouri/go-bcex/rest/resttest"
+	"github.com/hmedkouri/go-bcex/ws"
+	"github.com/hmedkouri/go-bcex/ws/wstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubTrader struct {
+	name  string
+	err   error
+	calls []string
+}
+
+func (s *stubTrader) PlaceOrder(order model.OrderRequest) (model.Order, error) {
+	s.calls = append(s.calls, "PlaceOrder")
+	return model.Order{ClOrdID: order.ClOrdID, Text: s.name}, s.err
+}
+
+func (s *stubTrader) CancelOrder(orderID string) error {
+	s.calls = append(s.calls, "CancelOrder")
+	return s.err
+}
+
+func (s *stubTrader) CancelAll(symbol string) error {
+	s.calls = append(s.calls, "CancelAll")
+	return s.err
+}
+
+func (s *stubTrader) GetOrder(orderID string) (model.Order, error) {
+	s.calls = append(s.calls, "GetOrder")
+	return model.Order{OrderID: orderID, Text: s.name}, s.err
+}
+
+func (s *stubTrader) OpenOrders(symbol string) ([]model.Order, error) {
+	s.calls = append(s.calls, "OpenOrders")
+	return nil, s.err
+}
+
+func TestRouter(t *testing.T) {
+	wsTrader := &stubTrader{name: "ws"}
+	restTrader := &stubTrader{name: "rest"}
+	connected := true
+	router := bcex.NewRouter(wsTrader, restTrader, func() bool { return connected })
+
+	order, err := router.PlaceOrder(model.OrderRequest{ClOrdID: "a"})
+	require.NoError(t, err)
+	require.Equal(t, "ws", order.Text)
+
+	connected = false
+	order, err = router.PlaceOrder(model.OrderRequest{ClOrdID: "b"})
+	require.NoError(t, err)
+	require.Equal(t, "rest", order.Text)
+	require.NoError(t, router.CancelAll("BTC-USD"))
+	require.Equal(t, []string{"PlaceOrder", "CancelAll"}, restTrader.calls)
+
+	// queries are not supported over the websocket API and fall back to Rest
+	connected = true
+	wsTrader.err = bcex.ErrNotSupported
+	order, err = router.GetOrder("1")
+	require.NoError(t, err)
+	require.Equal(t, "rest", order.Text)
+
+	// other websocket errors are returned while the session is still up
+	wsTrader.err = errors.New("rejected")
+	require.Error(t, router.CancelOrder("1"))
+	require.Equal(t, []string{"PlaceOrder", "CancelAll", "GetOrder"}, restTrader.calls)
+
+	// an order whose send failed as the session dropped is not sent again
+	router = bcex.NewRouter(&droppingTrader{stubTrader: wsTrader, connected: &connected}, restTrader, func() bool { return connected })
+	_, err = router.PlaceOrder(model.OrderRequest{ClOrdID: "c"})
+	require.EqualError(t, err, "rejected")
+	require.False(t, connected)
+	require.Equal(t, []string{"PlaceOrder", "CancelAll", "GetOrder"}, restTrader.calls)
+}
+
+// droppingTrader loses the session while sending an order
+type droppingTrader struct {
+	*stubTrader
+	connected *bool
+}
+
+func (d *droppingTrader) PlaceOrder(order model.OrderRequest) (model.Order, error) {
+	*d.connected = false
+	return d.stubTrader.PlaceOrder(order)
+}
+
+func TestWsTraderUnsupported(t *testing.T) {
+	trader := bcex.NewWsTrader(nil)
+	_, err := trader.GetOrder("1")
+	require.ErrorIs(t, err, bcex.ErrNotSupported)
+	_, err = trader.OpenOrders("")
+	require.ErrorIs(t, err, bcex.ErrNotSupported)
+}
+
+func TestRestTrader(t *testing.T) {
+	api := resttest.NewFakeAPI()
+	api.CreateOrderFunc = func(order rest.BaseOrder) (rest.OrderSummary, error) {
+		return rest.OrderSummary{ExOrdId: 7, ClOrdId: order.ClOrdId, OrdStatus: rest.OPEN, Side: order.Side, OrdType: order.OrdType, LeavesQty: order.OrderQty}, nil
+	}
+	trader := bcex.NewRestTrader(api)
+
+	order, err := trader.PlaceOrder(model.OrderRequest{ClOrdID: "a", Symbol: "BTC-USD", Side: model.SELL, Type: model.LIMIT, Qty: 2, Price: 10})
+	require.NoError(t, err)
+	require.Equal(t, "7", order.OrderID)
+	require.Equal(t, model.OPEN, order.Status)
+	require.Equal(t, 2.0, order.OrderQty)
+
+	require.NoError(t, trader.CancelOrder("7"))
+	require.Equal(t, []interface{}{int64(7)}, api.CallsTo("DeleteOrderById")[0].Args)
+	require.Error(t, trader.CancelOrder("not-a-number"))
+}
+
+func TestWsTrader(t *testing.T) {
+	streamer := wstest.NewFakeStreamer(1)
+	trader := bcex.NewWsTrader(streamer)
+
+	order, err := trader.PlaceOrder(model.OrderRequest{ClOrdID: "a", Symbol: "BTC-USD", Side: model.BUY, Type: model.LIMIT, Qty: 1, Price: 10, PostOnly: true})
+	require.NoError(t, err)
+	require.Equal(t, model.PENDING, order.Status)
+	sent := streamer.CallsTo("NewOrderSingleMessage")[0].Args[0].(ws.NewOrderSingleMsg)
+	require.Equal(t, ws.ALO, sent.ExecInst)
+
+	require.NoError(t, trader.CancelAll(""))
+	require.Nil(t, streamer.CallsTo("BulkCancel")[0].Args[0])
+}
@@ -0,0 +1,319 @@
+package ws
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what happens to a message dispatched to a full stream
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for the consumer, stalling the connection
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest buffered message
+	OverflowDropOldest
+	// OverflowDropNewest discards the dispatched message
+	OverflowDropNewest
+	// OverflowCoalesce keeps the latest message of each symbol on a full
+	// stream: l2 and l3 updates are merged level by level into the buffered
+	// message of their symbol, other messages replace it. A message of a
+	// symbol not buffered discards the oldest buffered message.
+	OverflowCoalesce
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowCoalesce:
+		return "coalesce"
+	}
+	return "unknown"
+}
+
+// StreamOptions configures the buffering of a stream returned by an accessor
+// of WebSocketClient (L2Quotes(), Ticker()...). A stream without options is
+// not buffered: its consumer stalls the connection until it reads.
+type StreamOptions struct {
+	// Buffer is the number of messages held for a slow consumer, 64 when zero
+	Buffer int
+	// Policy applies when the buffer is full
+	Policy OverflowPolicy
+}
+
+// outbox buffers the messages of a stream between the connection and its
+// consumer, which a goroutine feeds in order until stop is called
+type outbox struct {
+	size    int
+	policy  OverflowPolicy
+	deliver deliverFunc
+
+	mu    sync.Mutex
+	cond  *sync.Cond
+	queue []interface{}
+	// quit stops the running pump, nil when none runs; done is closed when
+	// the last pump started has returned
+	quit    chan struct{}
+	done    chan struct{}
+	dropped uint64
+}
+
+// deliverFunc hands msg to the consumer of an outbox. It returns false,
+// without delivering msg, when quit is closed first.
+type deliverFunc func(msg interface{}, quit <-chan struct{}) bool
+
+// newOutbox returns an outbox of size messages, unbounded when size is zero
+// or less
+func newOutbox(size int, policy OverflowPolicy, deliver deliverFunc) *outbox {
+	o := &outbox{size: size, policy: policy, deliver: deliver}
+	o.cond = sync.NewCond(&o.mu)
+	return o
+}
+
+// sender returns a deliverFunc sending the messages on ch, a channel of the
+// client
+func sender(ch interface{}) deliverFunc {
+	v := reflect.ValueOf(ch)
+	return func(msg interface{}, quit <-chan struct{}) bool {
+		chosen, _, _ := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: v, Send: reflect.ValueOf(msg)},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(quit)},
+		})
+		return chosen == 0
+	}
+}
+
+func (o *outbox) push(msg interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.quit == nil {
+		// the new pump starts once the previous one has put back the
+		// message it could not deliver
+		previous := o.done
+		o.quit, o.done = make(chan struct{}), make(chan struct{})
+		go o.pump(o.quit, o.done, previous)
+	}
+	if o.size > 0 && len(o.queue) >= o.size {
+		switch o.policy {
+		case OverflowBlock:
+			// stop releases the blocked producers, the message is queued
+			// for the next pump
+			running := o.quit
+			for len(o.queue) >= o.size && o.quit == running {
+				o.cond.Wait()
+			}
+		case OverflowDropNewest:
+			atomic.AddUint64(&o.dropped, 1)
+			return
+		case OverflowCoalesce:
+			_, symbol, _ := describe(msg)
+			for i, queued := range o.queue {
+				if _, queuedSymbol, _ := describe(queued); queuedSymbol == symbol {
+					o.queue[i] = coalesce(queued, msg)
+					atomic.AddUint64(&o.dropped, 1)
+					return
+				}
+			}
+			fallthrough
+		default:
+			o.queue[0] = nil
+			o.queue = o.queue[1:]
+			atomic.AddUint64(&o.dropped, 1)
+		}
+	}
+	o.queue = append(o.queue, msg)
+	o.cond.Broadcast()
+}
+
+func (o *outbox) pump(quit, done, previous chan struct{}) {
+	defer close(done)
+	if previous != nil {
+		<-previous
+	}
+	for {
+		o.mu.Lock()
+		for len(o.queue) == 0 && !closed(quit) {
+			o.cond.Wait()
+		}
+		if closed(quit) {
+			o.mu.Unlock()
+			return
+		}
+		msg := o.queue[0]
+		o.queue[0] = nil
+		o.queue = o.queue[1:]
+		o.cond.Broadcast()
+		o.mu.Unlock()
+		if !o.deliver(msg, quit) {
+			o.mu.Lock()
+			o.queue = append([]interface{}{msg}, o.queue...)
+			o.mu.Unlock()
+			return
+		}
+	}
+}
+
+// stop ends the pump, keeping the messages not delivered for the next one,
+// started by the next push. It does not wait for a consumer being called.
+func (o *outbox) stop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.quit == nil {
+		return
+	}
+	close(o.quit)
+	o.quit = nil
+	o.cond.Broadcast()
+}
+
+func closed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// Dropped returns the number of messages discarded or coalesced
+func (o *outbox) Dropped() uint64 {
+	return atomic.LoadUint64(&o.dropped)
+}
+
+// coalesce returns the message replacing queued once next is dispatched
+func coalesce(queued, next interface{}) interface{} {
+	switch q := queued.(type) {
+	case L2Msg:
+		n := next.(L2Msg)
+		if n.Event == eventSnapshot.String() {
+			return n
+		}
+		snapshot := q.Event == eventSnapshot.String()
+		q.Seqnum = n.Seqnum
+		q.Received = n.Received
+		q.Bids = mergeLevels(q.Bids, n.Bids, byPrice, snapshot)
+		q.Asks = mergeLevels(q.Asks, n.Asks, byPrice, snapshot)
+		return q
+	case L3Msg:
+		n := next.(L3Msg)
+		if n.Event == eventSnapshot.String() {
+			return n
+		}
+		snapshot := q.Event == eventSnapshot.String()
+		q.Seqnum = n.Seqnum
+		q.Received = n.Received
+		q.Bids = mergeLevels(q.Bids, n.Bids, byOrder, snapshot)
+		q.Asks = mergeLevels(q.Asks, n.Asks, byOrder, snapshot)
+		return q
+	}
+	return next
+}
+
+// l2 levels are identified by their price, l3 levels by their order id
+func byPrice(a, b Level) bool { return a.Px == b.Px }
+func byOrder(a, b Level) bool { return a.Num == b.Num }
+
+// mergeLevels applies the update levels to levels. Levels emptied by the
+// update are removed from a snapshot and kept in an update, which forwards
+// their removal.
+func mergeLevels(levels, update []Level, same func(a, b Level) bool, snapshot bool) []Level {
+	merged := make([]Level, len(levels), len(levels)+len(update))
+	copy(merged, levels)
+	for _, level := range update {
+		found := false
+		for i := range merged {
+			if same(merged[i], level) {
+				merged[i] = level
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, level)
+		}
+	}
+	if !snapshot {
+		return merged
+	}
+	kept := merged[:0]
+	for _, level := range merged {
+		if level.Qty != 0 {
+			kept = append(kept, level)
+		}
+	}
+	return kept
+}
+
+// defaultTradingBuffer is the number of trading messages held for a slow
+// consumer of Trading() when the trading stream has no Buffer configured
+const defaultTradingBuffer = 1024
+
+func (ws *WebSocketClient) newOutboxes(streams map[string]StreamOptions) map[channel]*outbox {
+	deliver := map[channel]deliverFunc{
+		heartbeatChannel: sender(ws.chHeartbeat),
+		symbolsChannel:   sender(ws.chSymbols),
+		l3Channel:        sender(ws.chL3),
+		l2Channel:        sender(ws.chL2),
+		pricesChannel:    sender(ws.chPrices),
+		tickerChannel:    sender(ws.chTicker),
+		tradesChannel:    sender(ws.chTrades),
+		balancesChannel:  sender(ws.chBalances),
+	}
+	// the trading messages are never dropped: a full buffer blocks the
+	// connection
+	tradingBuffer := streams[tradingChannel.String()].Buffer
+	if tradingBuffer <= 0 {
+		tradingBuffer = defaultTradingBuffer
+	}
+	outboxes := map[channel]*outbox{
+		tradingChannel: newOutbox(tradingBuffer, OverflowBlock, sender(ws.chTrading)),
+	}
+	for name, opts := range streams {
+		send, ok := deliver[channel(name)]
+		if !ok {
+			continue
+		}
+		if opts.Buffer <= 0 {
+			opts.Buffer = 64
+		}
+		outboxes[channel(name)] = newOutbox(opts.Buffer, opts.Policy, send)
+	}
+	return outboxes
+}
+
+// stopOutboxes ends the goroutines feeding the streams and the handlers
+func (ws *WebSocketClient) stopOutboxes() {
+	for _, o := range ws.outboxes {
+		o.stop()
+	}
+	ws.handlers.stop()
+}
+
+// sendError reports err to the error handlers and on the Errors() channel,
+// dropping it when the channel is full
+func (ws *WebSocketClient) sendError(err error) {
+	ws.handlers.Dispatch(err)
+	select {
+	case ws.errorsChan <- err:
+	default:
+		atomic.AddUint64(&ws.errorsDropped, 1)
+	}
+}
+
+// Dropped returns the number of messages each buffered stream discarded or
+// coalesced because its consumer was too slow, by channel name, and the
+// number of errors dropped because the Errors() channel was full under
+// "errors"
+func (ws *WebSocketClient) Dropped() map[string]uint64 {
+	dropped := map[string]uint64{"errors": atomic.LoadUint64(&ws.errorsDropped)}
+	for name, o := range ws.outboxes {
+		dropped[name.String()] = o.Dropped()
+	}
+	return dropped
+}
@@ -0,0 +1,216 @@
+package ws
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stalledOutbox returns an outbox whose consumer holds the first message
+// pushed until release is closed, then records the messages it receives
+func stalledOutbox(t *testing.T, size int, policy OverflowPolicy) (o *outbox, release chan struct{}, received chan interface{}) {
+	release = make(chan struct{})
+	received = make(chan interface{}, 16)
+	o = newOutbox(size, policy, func(msg interface{}, _ <-chan struct{}) bool {
+		<-release
+		received <- msg
+		return true
+	})
+	o.push(TradesMsg{Symbol: "stall"})
+	require.Eventually(t, func() bool {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		return len(o.queue) == 0
+	}, time.Second, time.Millisecond)
+	return o, release, received
+}
+
+func drain(received chan interface{}, n int) []interface{} {
+	var msgs []interface{}
+	for i := 0; i < n; i++ {
+		msgs = append(msgs, <-received)
+	}
+	return msgs
+}
+
+func TestOutboxDrop(t *testing.T) {
+	o, release, received := stalledOutbox(t, 2, OverflowDropNewest)
+	for i := 1; i <= 4; i++ {
+		o.push(TradesMsg{Symbol: "BTC-USD", Seqnum: i})
+	}
+	require.Equal(t, uint64(2), o.Dropped())
+	close(release)
+	msgs := drain(received, 3)
+	require.Equal(t, 1, msgs[1].(TradesMsg).Seqnum)
+	require.Equal(t, 2, msgs[2].(TradesMsg).Seqnum)
+
+	o, release, received = stalledOutbox(t, 2, OverflowDropOldest)
+	for i := 1; i <= 4; i++ {
+		o.push(TradesMsg{Symbol: "BTC-USD", Seqnum: i})
+	}
+	require.Equal(t, uint64(2), o.Dropped())
+	close(release)
+	msgs = drain(received, 3)
+	require.Equal(t, 3, msgs[1].(TradesMsg).Seqnum)
+	require.Equal(t, 4, msgs[2].(TradesMsg).Seqnum)
+}
+
+func TestOutboxBlock(t *testing.T) {
+	o, release, received := stalledOutbox(t, 1, OverflowBlock)
+	o.push(TradesMsg{Seqnum: 1})
+	pushed := make(chan struct{})
+	go func() {
+		o.push(TradesMsg{Seqnum: 2})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		require.FailNow(t, "push did not block on a full outbox")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-pushed
+	msgs := drain(received, 3)
+	require.Equal(t, 2, msgs[2].(TradesMsg).Seqnum)
+	require.Equal(t, uint64(0), o.Dropped())
+}
+
+func TestOutboxUnbounded(t *testing.T) {
+	o, release, received := stalledOutbox(t, 0, OverflowBlock)
+	for i := 1; i <= 100; i++ {
+		o.push(TradingUpdated{Seqnum: i})
+	}
+	close(release)
+	msgs := drain(received, 101)
+	for i, msg := range msgs[1:] {
+		require.Equal(t, i+1, msg.(TradingUpdated).Seqnum)
+	}
+	require.Equal(t, uint64(0), o.Dropped())
+}
+
+func TestOutboxStop(t *testing.T) {
+	ch := make(chan TradesMsg)
+	o := newOutbox(1, OverflowBlock, sender(ch))
+	o.push(TradesMsg{Seqnum: 1})
+	o.push(TradesMsg{Seqnum: 2})
+	pushed := make(chan struct{})
+	go func() {
+		o.push(TradesMsg{Seqnum: 3})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		require.FailNow(t, "push did not block on a full outbox")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// the pump blocked on the absent consumer ends and releases the producer
+	done := o.done
+	o.stop()
+	<-done
+	<-pushed
+	o.mu.Lock()
+	require.Len(t, o.queue, 3)
+	o.mu.Unlock()
+
+	// the next push starts a pump delivering the messages kept, in order
+	go o.push(TradesMsg{Seqnum: 4})
+	for i := 1; i <= 4; i++ {
+		require.Equal(t, i, (<-ch).Seqnum)
+	}
+	o.stop()
+}
+
+func TestOutboxCoalesce(t *testing.T) {
+	o, release, received := stalledOutbox(t, 2, OverflowCoalesce)
+	o.push(L2Msg{Event: "snapshot", Symbol: "BTC-USD", Seqnum: 1, Bids: []Level{{Px: 100, Qty: 1}, {Px: 99, Qty: 2}}})
+	o.push(TickerMsg{Symbol: "ETH-USD", LastTradePrice: 10})
+	o.push(L2Msg{Event: "updated", Symbol: "BTC-USD", Seqnum: 2, Bids: []Level{{Px: 100, Qty: 0}, {Px: 98, Qty: 3}}})
+	o.push(TickerMsg{Symbol: "ETH-USD", LastTradePrice: 11})
+	require.Equal(t, uint64(2), o.Dropped())
+	close(release)
+	msgs := drain(received, 3)
+	book := msgs[1].(L2Msg)
+	require.Equal(t, "snapshot", book.Event)
+	require.Equal(t, 2, book.Seqnum)
+	require.Equal(t, []Level{{Px: 99, Qty: 2}, {Px: 98, Qty: 3}}, book.Bids)
+	require.Equal(t, 11.0, msgs[2].(TickerMsg).LastTradePrice)
+
+	// updates merged together keep the removed levels
+	merged := coalesce(
+		L2Msg{Event: "updated", Seqnum: 1, Asks: []Level{{Px: 101, Qty: 1}}},
+		L2Msg{Event: "updated", Seqnum: 2, Asks: []Level{{Px: 101, Qty: 0}, {Px: 102, Qty: 1}}},
+	).(L2Msg)
+	require.Equal(t, []Level{{Px: 101, Qty: 0}, {Px: 102, Qty: 1}}, merged.Asks)
+	// l3 orders are merged by id
+	l3 := coalesce(
+		L3Msg{Event: "updated", Bids: []Level{{Px: 100, Qty: 1, Num: 7}}},
+		L3Msg{Event: "updated", Bids: []Level{{Px: 100, Qty: 2, Num: 8}, {Px: 100, Qty: 0, Num: 7}}},
+	).(L3Msg)
+	require.Equal(t, []Level{{Px: 100, Qty: 0, Num: 7}, {Px: 100, Qty: 2, Num: 8}}, l3.Bids)
+
+	// nothing is coalesced while there is room
+	o, release, received = stalledOutbox(t, 3, OverflowCoalesce)
+	o.push(TickerMsg{Symbol: "ETH-USD", LastTradePrice: 10})
+	o.push(TickerMsg{Symbol: "ETH-USD", LastTradePrice: 11})
+	require.Zero(t, o.Dropped())
+	close(release)
+	msgs = drain(received, 3)
+	require.Equal(t, 10.0, msgs[1].(TickerMsg).LastTradePrice)
+	require.Equal(t, 11.0, msgs[2].(TickerMsg).LastTradePrice)
+}
+
+func TestStreams(t *testing.T) {
+	client := NewWebSocketClient(Configuration{Streams: map[string]StreamOptions{
+		"ticker": {Buffer: 1, Policy: OverflowDropNewest},
+	}})
+	for i := 0; i < 12; i++ {
+		client.sendError(errors.New("read error"))
+	}
+	ticker := client.Ticker()
+	for i := 1; i <= 5; i++ {
+		client.dispatch(TickerMsg{Symbol: "BTC-USD", Seqnum: i})
+	}
+	// the trading stream is buffered up to its default size, its consumer is absent
+	require.Equal(t, defaultTradingBuffer, client.outboxes[tradingChannel].size)
+	for i := 0; i < 100; i++ {
+		client.dispatch(&TradingUpdated{Seqnum: i})
+	}
+	require.Equal(t, 1, (<-ticker).Seqnum)
+	dropped := client.Dropped()
+	require.Equal(t, uint64(2), dropped["errors"])
+	require.Equal(t, uint64(0), dropped["trading"])
+	require.Positive(t, dropped["ticker"])
+	require.Equal(t, 0, (<-client.Trading()).(*TradingUpdated).Seqnum)
+}
+
+func TestStopEndsStreams(t *testing.T) {
+	client := NewWebSocketClient(Configuration{Streams: map[string]StreamOptions{
+		"ticker":  {Buffer: 1},
+		"trading": {Buffer: 2, Policy: OverflowDropNewest},
+	}})
+	trading := client.outboxes[tradingChannel]
+	require.Equal(t, 2, trading.size)
+	require.Equal(t, OverflowBlock, trading.policy)
+
+	client.Ticker()
+	client.Trading()
+	client.dispatch(TickerMsg{Symbol: "BTC-USD", Seqnum: 1})
+	client.dispatch(&TradingUpdated{Seqnum: 1})
+	stopped := []chan struct{}{client.outboxes[tickerChannel].done, trading.done}
+	require.NoError(t, client.Stop())
+	for _, done := range stopped {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			require.FailNow(t, "stream pump not stopped")
+		}
+	}
+	require.Equal(t, 1, (<-func() chan TradingMsg {
+		client.dispatch(&TradingUpdated{Seqnum: 2})
+		return client.Trading()
+	}()).(*TradingUpdated).Seqnum)
+	client.Stop()
+}
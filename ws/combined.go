@@ -0,0 +1,83 @@
+package ws
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SymbolErrors reports the symbols a combined subscription failed for
+type SymbolErrors map[Symbol]error
+
+func (e SymbolErrors) Error() string {
+	symbols := make([]string, 0, len(e))
+	for symbol := range e {
+		symbols = append(symbols, string(symbol))
+	}
+	sort.Strings(symbols)
+	msgs := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		msgs[i] = fmt.Sprintf("%s: %s", symbol, e[Symbol(symbol)])
+	}
+	return "subscription failed for " + strings.Join(msgs, ", ")
+}
+
+// SubscribeToL2Combined subscribes to the l2 books of symbols, see SubscribeToTickerCombined
+func (ws *WebSocketClient) SubscribeToL2Combined(symbols []Symbol) error {
+	return ws.subscribeCombined(streamKeys(l2Channel, symbols, 0))
+}
+
+// SubscribeToL3Combined subscribes to the l3 books of symbols, see SubscribeToTickerCombined
+func (ws *WebSocketClient) SubscribeToL3Combined(symbols []Symbol) error {
+	return ws.subscribeCombined(streamKeys(l3Channel, symbols, 0))
+}
+
+// SubscribeToPricesCombined subscribes to the candles of symbols, see SubscribeToTickerCombined
+func (ws *WebSocketClient) SubscribeToPricesCombined(symbols []Symbol, granularity Granularity) error {
+	return ws.subscribeCombined(streamKeys(pricesChannel, symbols, granularity))
+}
+
+// SubscribeToTickerCombined subscribes to the tickers of symbols. The requests
+// are sent together, then their confirmations collected. The symbols that
+// could not be subscribed are reported in a SymbolErrors, the others are
+// subscribed.
+func (ws *WebSocketClient) SubscribeToTickerCombined(symbols []Symbol) error {
+	return ws.subscribeCombined(streamKeys(tickerChannel, symbols, 0))
+}
+
+// SubscribeToTradesCombined subscribes to the trades of symbols, see SubscribeToTickerCombined
+func (ws *WebSocketClient) SubscribeToTradesCombined(symbols []Symbol) error {
+	return ws.subscribeCombined(streamKeys(tradesChannel, symbols, 0))
+}
+
+func streamKeys(c channel, symbols []Symbol, granularity Granularity) []streamKey {
+	keys := make([]streamKey, len(symbols))
+	for i, symbol := range symbols {
+		keys[i] = streamKey{channel: c, symbol: symbol, granularity: granularity}
+	}
+	return keys
+}
+
+func (ws *WebSocketClient) subscribeCombined(keys []streamKey) error {
+	errs := SymbolErrors{}
+	entries := make(map[streamKey]*registryEntry, len(keys))
+	for _, key := range keys {
+		entry, err := ws.send(key, key.request(actionSubscribe))
+		if err != nil {
+			errs[key.symbol] = err
+			continue
+		}
+		entries[key] = entry
+	}
+	deadline := time.Now().Add(ws.config.Timeout)
+	for key, entry := range entries {
+		if err := ws.registry.wait(entry, time.Until(deadline)); err != nil {
+			errs[key.symbol] = err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
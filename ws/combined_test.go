@@ -0,0 +1,37 @@
+package ws_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribeCombined(t *testing.T) {
+	e := newExchange(t)
+	client := ws.NewWebSocketClient(ws.Configuration{Host: "ws" + strings.TrimPrefix(e.URL, "http"), Timeout: time.Second})
+	// the snapshots go to a listener, the accessors are never read
+	client.Listen(ws.ListenerOptions{})
+	require.NoError(t, client.Start(false))
+	defer client.Stop()
+
+	require.NoError(t, client.SubscribeToTradesCombined([]ws.Symbol{"BTC-USD", "ETH-USD"}))
+	require.Len(t, e.requestsOf(0), 2)
+
+	err := client.SubscribeToTickerCombined([]ws.Symbol{"BTC-USD", "BAD-USD", "ANON-1", "ETH-USD", "ANON-2"})
+	var errs ws.SymbolErrors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 3)
+	require.EqualError(t, errs["BAD-USD"], "invalid symbol")
+	// rejections naming no symbol answer the subscriptions in order
+	require.EqualError(t, errs["ANON-1"], "ANON-1 unknown")
+	require.EqualError(t, errs["ANON-2"], "ANON-2 unknown")
+	require.EqualError(t, err, "subscription failed for ANON-1: ANON-1 unknown, ANON-2: ANON-2 unknown, BAD-USD: invalid symbol")
+
+	require.NoError(t, client.SubscribeToPricesCombined([]ws.Symbol{"BTC-USD"}, ws.Granularity60))
+	require.Equal(t, 60, e.requestsOf(0)[7].Granularity)
+}
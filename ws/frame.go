@@ -0,0 +1,112 @@
+package ws
+
+import (
+	stdjson "encoding/json"
+	"log"
+	"time"
+)
+
+// Frame is a raw message as read from the websocket connection, stamped with
+// its receive time and the channel and symbol it belongs to
+type Frame struct {
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel,omitempty"`
+	Symbol  string    `json:"symbol,omitempty"`
+	// Data holds the message when it is valid JSON
+	Data stdjson.RawMessage `json:"data,omitempty"`
+	// Text holds the message when it is not JSON, e.g. "ping"
+	Text string `json:"text,omitempty"`
+}
+
+// NewFrame wraps a raw message received at the given time
+func NewFrame(msg []byte, received time.Time) Frame {
+	frame := Frame{Time: received}
+	var commonMsg msgCommon
+	if stdjson.Valid(msg) && json.Unmarshal(msg, &commonMsg) == nil {
+		frame.Channel = commonMsg.Channel.String()
+		frame.Symbol = string(commonMsg.Symbol)
+		frame.Data = append(stdjson.RawMessage(nil), msg...)
+	} else {
+		frame.Text = string(msg)
+	}
+	return frame
+}
+
+// Bytes returns the raw message carried by the frame
+func (f Frame) Bytes() []byte {
+	if f.Data != nil {
+		return f.Data
+	}
+	return []byte(f.Text)
+}
+
+// FrameRecorder receives every message read from the connection before it is
+// decoded, so messages that fail to decode are captured as well
+type FrameRecorder interface {
+	Record(frame Frame) error
+}
+
+// SetRecorder installs a recorder receiving every raw message, nil to remove it
+func (ws *WebSocketClient) SetRecorder(recorder FrameRecorder) {
+	ws.hooksMu.Lock()
+	defer ws.hooksMu.Unlock()
+	ws.recorder = recorder
+}
+
+func (ws *WebSocketClient) recordFrame(msg []byte, received time.Time) {
+	ws.hooksMu.RLock()
+	recorder := ws.recorder
+	ws.hooksMu.RUnlock()
+	if recorder == nil {
+		return
+	}
+	if err := recorder.Record(NewFrame(msg, received)); err != nil {
+		log.Printf("Error recording frame: %s", err.Error())
+	}
+}
+
+// MarketData decodes a frame of the l2, l3, prices, ticker or trades channel
+// into the message type the live connection delivers for it, L2Msg, L3Msg,
+// PricesMsg, TickerMsg or TradesMsg. Other frames decode to nil.
+func (f Frame) MarketData() (interface{}, error) {
+	if f.Data == nil {
+		return nil, nil
+	}
+	var msg interface{}
+	switch channel(f.Channel) {
+	case l2Channel:
+		msg = &L2Msg{}
+	case l3Channel:
+		msg = &L3Msg{}
+	case pricesChannel:
+		msg = &PricesMsg{}
+	case tickerChannel:
+		msg = &TickerMsg{}
+	case tradesChannel:
+		msg = &TradesMsg{}
+	default:
+		return nil, nil
+	}
+	var commonMsg msgCommon
+	if err := json.Unmarshal(f.Data, &commonMsg); err != nil {
+		return nil, err
+	}
+	if commonMsg.Event != eventUpdate && commonMsg.Event != eventSnapshot {
+		return nil, nil
+	}
+	if err := json.Unmarshal(f.Data, msg); err != nil {
+		return nil, err
+	}
+	switch m := msg.(type) {
+	case *L2Msg:
+		return *m, nil
+	case *L3Msg:
+		return *m, nil
+	case *PricesMsg:
+		return *m, nil
+	case *TickerMsg:
+		return *m, nil
+	default:
+		return *m.(*TradesMsg), nil
+	}
+}
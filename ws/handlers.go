@@ -0,0 +1,306 @@
+package ws
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+)
+
+// WsTradesMsgHandler handle websocket trades event
+type WsTradesMsgHandler func(event *TradesMsg)
+
+// WsTradingMsgHandler handle websocket trading event: an execution report
+// (*TradingUpdated), a reject (*TradingReject) or the open orders
+// (*TradingSnapshot)
+type WsTradingMsgHandler func(event TradingMsg)
+
+// WsBalancesMsgHandler handle websocket balances event
+type WsBalancesMsgHandler func(event *BalancesSnapshot)
+
+// WsHeartbeatMsgHandler handle websocket heartbeat event
+type WsHeartbeatMsgHandler func(event *HeartbeatMsg)
+
+const (
+	// handlerShards is the number of goroutines calling the handlers
+	handlerShards = 8
+	// handlerBuffer is the number of messages a shard holds before the
+	// connection waits for its handlers
+	handlerBuffer = 1024
+)
+
+// Handlers calls typed handlers with the messages of a connection.
+// Messages are handed to a fixed set of goroutines by symbol, so the handlers
+// receive the messages of a symbol in order, and the trading messages in
+// order, while a slow handler of one symbol does not delay the others sharing
+// no goroutine with it. A panic in a handler is recovered and reported to the
+// error handlers.
+type Handlers struct {
+	mu        sync.RWMutex
+	l2        []WsL2MsgHandler
+	l3        []WsL3MsgHandler
+	ticker    []WsTickerMsgHandler
+	prices    []WsPriceMsgHandler
+	trades    []WsTradesMsgHandler
+	trading   []WsTradingMsgHandler
+	balances  []WsBalancesMsgHandler
+	heartbeat []WsHeartbeatMsgHandler
+	errors    []ErrHandler
+
+	shards []*outbox
+}
+
+// NewHandlers returns handlers without any registered handler
+func NewHandlers() *Handlers {
+	h := &Handlers{shards: make([]*outbox, handlerShards)}
+	for i := range h.shards {
+		h.shards[i] = newOutbox(handlerBuffer, OverflowBlock, func(msg interface{}, _ <-chan struct{}) bool {
+			h.call(msg)
+			return true
+		})
+	}
+	return h
+}
+
+// stop ends the goroutines calling the handlers, the next message starts them again
+func (h *Handlers) stop() {
+	for _, shard := range h.shards {
+		shard.stop()
+	}
+}
+
+// OnL2 registers a handler of the l2 messages
+func (h *Handlers) OnL2(handler WsL2MsgHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.l2 = append(h.l2, handler)
+}
+
+// OnL3 registers a handler of the l3 messages
+func (h *Handlers) OnL3(handler WsL3MsgHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.l3 = append(h.l3, handler)
+}
+
+// OnTicker registers a handler of the ticker messages
+func (h *Handlers) OnTicker(handler WsTickerMsgHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ticker = append(h.ticker, handler)
+}
+
+// OnPrices registers a handler of the prices messages
+func (h *Handlers) OnPrices(handler WsPriceMsgHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prices = append(h.prices, handler)
+}
+
+// OnTrade registers a handler of the trades messages
+func (h *Handlers) OnTrade(handler WsTradesMsgHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.trades = append(h.trades, handler)
+}
+
+// OnExecutionReport registers a handler of the trading messages
+func (h *Handlers) OnExecutionReport(handler WsTradingMsgHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.trading = append(h.trading, handler)
+}
+
+// OnBalances registers a handler of the balances messages
+func (h *Handlers) OnBalances(handler WsBalancesMsgHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.balances = append(h.balances, handler)
+}
+
+// OnHeartbeat registers a handler of the heartbeat messages
+func (h *Handlers) OnHeartbeat(handler WsHeartbeatMsgHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.heartbeat = append(h.heartbeat, handler)
+}
+
+// OnError registers a handler of the connection errors and of the panics of
+// the other handlers
+func (h *Handlers) OnError(handler ErrHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.errors = append(h.errors, handler)
+}
+
+// handles reports whether a handler is registered for msg
+func (h *Handlers) handles(msg interface{}) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	switch msg.(type) {
+	case L2Msg:
+		return len(h.l2) > 0
+	case L3Msg:
+		return len(h.l3) > 0
+	case TickerMsg:
+		return len(h.ticker) > 0
+	case PricesMsg:
+		return len(h.prices) > 0
+	case TradesMsg:
+		return len(h.trades) > 0
+	case TradingMsg:
+		return len(h.trading) > 0
+	case BalancesSnapshot:
+		return len(h.balances) > 0
+	case HeartbeatMsg:
+		return len(h.heartbeat) > 0
+	case error:
+		return len(h.errors) > 0
+	}
+	return false
+}
+
+// Dispatch queues msg, a message or an error, for its handlers. It waits
+// when the handlers of its symbol are too far behind.
+func (h *Handlers) Dispatch(msg interface{}) {
+	if !h.handles(msg) {
+		return
+	}
+	// messages without symbol are ordered by channel, execution reports
+	// across symbols
+	channel, symbol, _ := describe(msg)
+	key := symbol
+	if key == "" || channel == tradingChannel.String() {
+		key = channel
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	h.shards[hash.Sum32()%uint32(len(h.shards))].push(msg)
+}
+
+// call runs the handlers of msg. The handlers are read under the lock and
+// called without it, so a handler can register other handlers.
+func (h *Handlers) call(msg interface{}) {
+	h.mu.RLock()
+	l2, l3, ticker, prices, trades := h.l2, h.l3, h.ticker, h.prices, h.trades
+	trading, balances, heartbeat := h.trading, h.balances, h.heartbeat
+	h.mu.RUnlock()
+
+	switch m := msg.(type) {
+	case L2Msg:
+		for _, handler := range l2 {
+			h.safely(func() { handler(&m) })
+		}
+	case L3Msg:
+		for _, handler := range l3 {
+			h.safely(func() { handler(&m) })
+		}
+	case TickerMsg:
+		for _, handler := range ticker {
+			h.safely(func() { handler(&m) })
+		}
+	case PricesMsg:
+		for _, handler := range prices {
+			h.safely(func() { handler(&m) })
+		}
+	case TradesMsg:
+		for _, handler := range trades {
+			h.safely(func() { handler(&m) })
+		}
+	case TradingMsg:
+		for _, handler := range trading {
+			h.safely(func() { handler(m) })
+		}
+	case BalancesSnapshot:
+		for _, handler := range balances {
+			h.safely(func() { handler(&m) })
+		}
+	case HeartbeatMsg:
+		for _, handler := range heartbeat {
+			h.safely(func() { handler(&m) })
+		}
+	case error:
+		h.callErrors(m)
+	}
+}
+
+// safely calls f, reporting a panic to the error handlers
+func (h *Handlers) safely(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			h.callErrors(fmt.Errorf("handler panic: %v", r))
+		}
+	}()
+	f()
+}
+
+func (h *Handlers) callErrors(err error) {
+	h.mu.RLock()
+	handlers := h.errors
+	h.mu.RUnlock()
+	for _, handler := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Error handler panic: %v", r)
+				}
+			}()
+			handler(err)
+		}()
+	}
+}
+
+// OnL2 registers a handler of the l2 messages
+func (ws *WebSocketClient) OnL2(handler WsL2MsgHandler) {
+	ws.tap(listening)
+	ws.handlers.OnL2(handler)
+}
+
+// OnL3 registers a handler of the l3 messages
+func (ws *WebSocketClient) OnL3(handler WsL3MsgHandler) {
+	ws.tap(listening)
+	ws.handlers.OnL3(handler)
+}
+
+// OnTicker registers a handler of the ticker messages
+func (ws *WebSocketClient) OnTicker(handler WsTickerMsgHandler) {
+	ws.tap(listening)
+	ws.handlers.OnTicker(handler)
+}
+
+// OnPrices registers a handler of the prices messages
+func (ws *WebSocketClient) OnPrices(handler WsPriceMsgHandler) {
+	ws.tap(listening)
+	ws.handlers.OnPrices(handler)
+}
+
+// OnTrade registers a handler of the trades messages
+func (ws *WebSocketClient) OnTrade(handler WsTradesMsgHandler) {
+	ws.tap(listening)
+	ws.handlers.OnTrade(handler)
+}
+
+// OnExecutionReport registers a handler of the trading messages
+func (ws *WebSocketClient) OnExecutionReport(handler WsTradingMsgHandler) {
+	ws.tap(listening)
+	ws.handlers.OnExecutionReport(handler)
+}
+
+// OnBalances registers a handler of the balances messages
+func (ws *WebSocketClient) OnBalances(handler WsBalancesMsgHandler) {
+	ws.tap(listening)
+	ws.handlers.OnBalances(handler)
+}
+
+// OnHeartbeat registers a handler of the heartbeat messages
+func (ws *WebSocketClient) OnHeartbeat(handler WsHeartbeatMsgHandler) {
+	ws.tap(listening)
+	ws.handlers.OnHeartbeat(handler)
+}
+
+// OnError registers a handler of the connection errors and of the panics of
+// the other handlers
+func (ws *WebSocketClient) OnError(handler ErrHandler) {
+	ws.tap(listening)
+	ws.handlers.OnError(handler)
+}
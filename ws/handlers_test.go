@@ -0,0 +1,98 @@
+package ws_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers(t *testing.T) {
+	client := ws.NewWebSocketClient(ws.Configuration{})
+
+	var (
+		mu      sync.Mutex
+		seqnums = map[string][]int{}
+		reports []string
+		errs    []error
+	)
+	done := make(chan struct{})
+	client.OnL2(func(event *ws.L2Msg) {
+		if event.Seqnum == 2 {
+			panic("boom")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		seqnums[event.Symbol] = append(seqnums[event.Symbol], event.Seqnum)
+	})
+	client.OnExecutionReport(func(event ws.TradingMsg) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch report := event.(type) {
+		case *ws.TradingUpdated:
+			reports = append(reports, report.OrderID)
+		case *ws.TradingReject:
+			reports = append(reports, "reject "+report.Text)
+			close(done)
+		}
+	})
+	client.OnError(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+
+	var msgs []string
+	for i := 1; i <= 50; i++ {
+		for _, symbol := range []string{"BTC-USD", "ETH-USD"} {
+			msgs = append(msgs, fmt.Sprintf(`{"seqnum":%d,"event":"updated","channel":"l2","symbol":"%s","bids":[],"asks":[]}`, i, symbol))
+		}
+	}
+	msgs = append(msgs,
+		`{"seqnum":1,"event":"updated","channel":"trading","orderID":"1","symbol":"BTC-USD"}`,
+		`{"seqnum":2,"event":"updated","channel":"trading","orderID":"2","symbol":"ETH-USD"}`,
+		`{"seqnum":3,"event":"rejected","channel":"trading","text":"invalid"}`,
+	)
+	// no accessor is read: the handlers alone must not block the replay
+	require.NoError(t, client.Replay(newFrames(msgs...), ws.ReplayOptions{}))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "execution reports not handled")
+	}
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seqnums["BTC-USD"]) == 49 && len(seqnums["ETH-USD"]) == 49
+	}, time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, symbol := range []string{"BTC-USD", "ETH-USD"} {
+		for i, seqnum := range seqnums[symbol] {
+			expected := i + 1
+			if expected >= 2 {
+				expected++
+			}
+			require.Equal(t, expected, seqnum, symbol)
+		}
+	}
+	require.Equal(t, []string{"1", "2", "reject invalid"}, reports)
+	require.Len(t, errs, 2)
+	require.EqualError(t, errs[0], "handler panic: boom")
+}
+
+func TestHandlersErrors(t *testing.T) {
+	handlers := ws.NewHandlers()
+	received := make(chan error, 2)
+	handlers.OnError(func(err error) { panic("error handler") })
+	handlers.OnError(func(err error) { received <- err })
+	handlers.Dispatch(errors.New("read error"))
+	require.EqualError(t, <-received, "read error")
+}
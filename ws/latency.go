@@ -0,0 +1,195 @@
+package ws
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the buckets of the latency
+// histograms, from 100µs doubling up to about 26s
+var LatencyBuckets = func() []time.Duration {
+	buckets := make([]time.Duration, 19)
+	for i := range buckets {
+		buckets[i] = 100 * time.Microsecond << i
+	}
+	return buckets
+}()
+
+// LatencyStats summarizes a latency histogram. Quantiles are estimated by
+// the upper bound of their bucket.
+type LatencyStats struct {
+	Count uint64
+	Sum   time.Duration
+	P50   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+	// Buckets counts the latencies up to each bound of LatencyBuckets,
+	// cumulatively, Count including the larger ones
+	Buckets []uint64
+}
+
+// histogram counts latencies in LatencyBuckets, the last bucket holding the
+// latencies beyond the bounds
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(LatencyBuckets)+1)}
+}
+
+// observe records d, a negative latency due to clock skew counting as zero
+func (h *histogram) observe(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := 0
+	for i < len(LatencyBuckets) && d > LatencyBuckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+func (h *histogram) stats() LatencyStats {
+	stats := LatencyStats{
+		Count:   h.count,
+		Sum:     h.sum,
+		P50:     h.quantile(0.5),
+		P99:     h.quantile(0.99),
+		Max:     h.max,
+		Buckets: make([]uint64, len(LatencyBuckets)),
+	}
+	var cumulative uint64
+	for i := range LatencyBuckets {
+		cumulative += h.counts[i]
+		stats.Buckets[i] = cumulative
+	}
+	return stats
+}
+
+// quantile returns the upper bound of the bucket of the q quantile, the max
+// when lower
+func (h *histogram) quantile(q float64) time.Duration {
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	var cumulative uint64
+	for i, count := range h.counts {
+		cumulative += count
+		if cumulative >= rank && cumulative > 0 {
+			if i < len(LatencyBuckets) && LatencyBuckets[i] < h.max {
+				return LatencyBuckets[i]
+			}
+			return h.max
+		}
+	}
+	return 0
+}
+
+// latencies measures the exchange to client latency of the messages carrying
+// an exchange time, and the acknowledgement latency of the orders
+type latencies struct {
+	mu         sync.Mutex
+	histograms map[string]*histogram
+	// submitted holds the submit time of the orders waiting for their
+	// acknowledgement by client order id
+	submitted map[string]time.Time
+	// metrics also records the latencies, see SetMetrics
+	metrics *wsMetrics
+}
+
+// orderAck is the key of the order acknowledgement latencies
+const orderAck = "order_ack"
+
+// maxSubmitted bounds the orders waiting for an acknowledgement, the older
+// ones being forgotten first
+const maxSubmitted = 1024
+
+func newLatencies() *latencies {
+	return &latencies{histograms: make(map[string]*histogram), submitted: make(map[string]time.Time)}
+}
+
+func (l *latencies) observeLocked(key string, d time.Duration) {
+	h, ok := l.histograms[key]
+	if !ok {
+		h = newHistogram()
+		l.histograms[key] = h
+	}
+	h.observe(d)
+	l.metrics.observe(key, d)
+}
+
+func (l *latencies) setMetrics(m *wsMetrics) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.metrics = m
+}
+
+// exchange records the latency of a message of channel sent by the exchange
+// at sent, ignored when the message carries no time
+func (l *latencies) exchange(c channel, sent, received time.Time) {
+	if sent.IsZero() {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.observeLocked(c.String(), received.Sub(sent))
+}
+
+func (l *latencies) submit(clOrdID string, at time.Time) {
+	if clOrdID == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.submitted) >= maxSubmitted {
+		oldest, oldestAt := "", at
+		for id, t := range l.submitted {
+			if t.Before(oldestAt) {
+				oldest, oldestAt = id, t
+			}
+		}
+		delete(l.submitted, oldest)
+	}
+	l.submitted[clOrdID] = at
+}
+
+// ack records the acknowledgement latency of the order clOrdID, the first
+// update or reject received for it
+func (l *latencies) ack(clOrdID string, received time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	submitted, ok := l.submitted[clOrdID]
+	if !ok {
+		return
+	}
+	delete(l.submitted, clOrdID)
+	l.metrics.order("ack")
+	l.observeLocked(orderAck, received.Sub(submitted))
+}
+
+func (l *latencies) stats() map[string]LatencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := make(map[string]LatencyStats, len(l.histograms))
+	for key, h := range l.histograms {
+		stats[key] = h.stats()
+	}
+	return stats
+}
+
+// Latencies returns the latency histograms of the client: by channel, the
+// delay between the exchange time of the heartbeat, trades and trading
+// messages and their reception, and under "order_ack" the delay between the
+// submission of an order and its first update or reject. The exchange
+// latencies rely on the clocks of both sides being synchronized.
+func (ws *WebSocketClient) Latencies() map[string]LatencyStats {
+	return ws.latency.stats()
+}
@@ -0,0 +1,52 @@
+package ws_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencies(t *testing.T) {
+	e := newExchange(t)
+	client := ws.NewWebSocketClient(ws.Configuration{Host: "ws" + strings.TrimPrefix(e.URL, "http"), Timeout: time.Second})
+	listener := client.Listen(ws.ListenerOptions{Channels: []string{"trades"}})
+	require.NoError(t, client.Start(false))
+	defer client.Stop()
+
+	sent := time.Now().Add(-5 * time.Millisecond).UTC().Format(time.RFC3339Nano)
+	e.send(0, fmt.Sprintf(`{"seqnum":1,"event":"updated","channel":"trades","symbol":"BTC-USD","timestamp":"%s","side":"buy","qty":1,"price":100}`, sent))
+	select {
+	case msg := <-listener.C:
+		require.WithinDuration(t, time.Now(), msg.(ws.TradesMsg).Received, time.Second)
+	case <-time.After(time.Second):
+		require.FailNow(t, "trade not received")
+	}
+
+	submitted := time.Now()
+	require.NoError(t, client.NewOrderSingleMessage(ws.NewOrderSingleMsg{ClOrdID: "c1", Symbol: "BTC-USD"}))
+	require.Eventually(t, func() bool { return len(e.requestsOf(0)) == 1 }, time.Second, time.Millisecond)
+	e.send(0, `{"seqnum":2,"event":"updated","channel":"trading","orderID":"1","clOrdID":"c1","ordStatus":"open"}`)
+	// only the first update acknowledges the order
+	e.send(0, `{"seqnum":3,"event":"updated","channel":"trading","orderID":"1","clOrdID":"c1","ordStatus":"filled"}`)
+
+	require.Eventually(t, func() bool { return client.Latencies()["order_ack"].Count == 1 }, time.Second, time.Millisecond)
+	ack := client.Latencies()["order_ack"]
+	require.Greater(t, ack.Max, time.Duration(0))
+	require.LessOrEqual(t, ack.Max, time.Since(submitted))
+	require.Equal(t, ack.Max, ack.P50)
+
+	trades := client.Latencies()["trades"]
+	require.Equal(t, uint64(1), trades.Count)
+	require.GreaterOrEqual(t, trades.Max, 5*time.Millisecond)
+	require.Equal(t, trades.Max, trades.P99)
+	require.Len(t, trades.Buckets, len(ws.LatencyBuckets))
+	require.Equal(t, uint64(0), trades.Buckets[0])
+	require.Equal(t, uint64(1), trades.Buckets[len(trades.Buckets)-1])
+	// the trading updates carry no transact time
+	require.NotContains(t, client.Latencies(), "trading")
+}
@@ -0,0 +1,321 @@
+package ws
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ListenerOptions selects the messages delivered to a Listener
+type ListenerOptions struct {
+	// Channels to receive, e.g. "l2", "trades", "trading", all when empty
+	Channels []string
+	// Symbols to receive, all when empty. Messages without a symbol
+	// (heartbeats, balances, trading snapshots...) are always received.
+	Symbols []string
+	// Events to receive, e.g. "snapshot" or "updated", all when empty
+	Events []string
+	// Buffer is the capacity of the listener channel, 64 when zero
+	Buffer int
+	// Lossless makes the market data messages wait for room in the buffer,
+	// as the trading messages do, instead of being dropped when it is full
+	Lossless bool
+}
+
+// Listener is an independent subscription to the messages dispatched by a
+// client. Each listener has its own buffer, so listeners do not steal
+// messages from one another; a listener whose buffer is full misses the
+// market data messages until it catches up, see Dropped, unless it is
+// Lossless. The trading messages are never missed: they wait, without limit,
+// for room in the buffer.
+type Listener struct {
+	// C delivers the messages, by value for the market data messages
+	// (L2Msg, TradesMsg...), as TradingMsg for the trading channel
+	C <-chan interface{}
+
+	ch       chan interface{}
+	channels map[string]bool
+	symbols  map[string]bool
+	events   map[string]bool
+	lossless bool
+	dropped  uint64
+	hub      *Hub
+
+	// overflow holds the messages waiting for room in ch, in order, sent by
+	// a flush goroutine until quit is closed
+	mu       sync.Mutex
+	overflow []interface{}
+	flushing bool
+	flushers sync.WaitGroup
+	quit     chan struct{}
+}
+
+// Close detaches the listener and closes C, discarding the messages still
+// waiting. It does not change the subscriptions of the connection.
+func (l *Listener) Close() {
+	l.hub.remove(l)
+}
+
+// sendLossless delivers a message, queuing it behind the waiting ones when
+// the buffer is full
+func (l *Listener) sendLossless(msg interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.overflow) == 0 {
+		select {
+		case l.ch <- msg:
+			return
+		default:
+		}
+	}
+	l.overflow = append(l.overflow, msg)
+	if !l.flushing {
+		l.flushing = true
+		l.flushers.Add(1)
+		go l.flush()
+	}
+}
+
+// flush sends the waiting messages, the first one leaving the queue once
+// sent so sendLossless keeps the order
+func (l *Listener) flush() {
+	defer l.flushers.Done()
+	for {
+		l.mu.Lock()
+		if len(l.overflow) == 0 {
+			l.flushing = false
+			l.mu.Unlock()
+			return
+		}
+		msg := l.overflow[0]
+		l.mu.Unlock()
+		select {
+		case l.ch <- msg:
+		case <-l.quit:
+			return
+		}
+		l.mu.Lock()
+		l.overflow[0] = nil
+		l.overflow = l.overflow[1:]
+		l.mu.Unlock()
+	}
+}
+
+// Dropped returns the number of messages missed because the buffer was full
+func (l *Listener) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+func set(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
+
+func (l *Listener) accepts(channel, symbol, event string) bool {
+	if l.channels != nil && !l.channels[channel] {
+		return false
+	}
+	if l.symbols != nil && symbol != "" && !l.symbols[symbol] {
+		return false
+	}
+	if l.events != nil && !l.events[event] {
+		return false
+	}
+	return true
+}
+
+// Hub fans messages out to listeners. WebSocketClient publishes every message
+// it decodes to its hub; fakes and replays can use one directly.
+type Hub struct {
+	mu        sync.RWMutex
+	listeners map[*Listener]struct{}
+}
+
+// NewHub returns a hub without listeners
+func NewHub() *Hub {
+	return &Hub{listeners: make(map[*Listener]struct{})}
+}
+
+// Listen adds a listener receiving the messages selected by opts
+func (h *Hub) Listen(opts ListenerOptions) *Listener {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	ch := make(chan interface{}, opts.Buffer)
+	l := &Listener{
+		C:        ch,
+		ch:       ch,
+		channels: set(opts.Channels),
+		symbols:  set(opts.Symbols),
+		events:   set(opts.Events),
+		lossless: opts.Lossless,
+		hub:      h,
+		quit:     make(chan struct{}),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners[l] = struct{}{}
+	return l
+}
+
+func (h *Hub) remove(l *Listener) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.listeners[l]; ok {
+		delete(h.listeners, l)
+		close(l.quit)
+		l.flushers.Wait()
+		close(l.ch)
+	}
+}
+
+// Publish delivers msg to the listeners selecting it, without blocking. The
+// market data messages are dropped for the listeners whose buffer is full,
+// unless they are lossless, the trading messages are queued.
+func (h *Hub) Publish(msg interface{}) {
+	channel, symbol, event := describe(msg)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for l := range h.listeners {
+		if !l.accepts(channel, symbol, event) {
+			continue
+		}
+		if l.lossless || channel == tradingChannel.String() {
+			l.sendLossless(msg)
+			continue
+		}
+		select {
+		case l.ch <- msg:
+		default:
+			atomic.AddUint64(&l.dropped, 1)
+		}
+	}
+}
+
+// describe returns the channel, symbol and event of a dispatched message
+func describe(msg interface{}) (channel, symbol, event string) {
+	switch m := msg.(type) {
+	case HeartbeatMsg:
+		return heartbeatChannel.String(), "", m.Event.String()
+	case SymbolMsg:
+		if m.Event == "" {
+			return symbolsChannel.String(), string(m.Name), eventSnapshot.String()
+		}
+		return symbolsChannel.String(), string(m.Name), m.Event
+	case L3Msg:
+		return l3Channel.String(), m.Symbol, m.Event
+	case L2Msg:
+		return l2Channel.String(), m.Symbol, m.Event
+	case PricesMsg:
+		return pricesChannel.String(), m.Symbol, m.Event
+	case TickerMsg:
+		return tickerChannel.String(), m.Symbol, m.Event
+	case TradesMsg:
+		return tradesChannel.String(), m.Symbol, m.Event
+	case BalancesSnapshot:
+		return balancesChannel.String(), "", m.Event
+	case *TradingUpdated:
+		return tradingChannel.String(), m.Symbol, m.Event
+	case *TradingReject:
+		return tradingChannel.String(), "", m.Event
+	case *TradingSnapshot:
+		return tradingChannel.String(), "", m.Event
+	}
+	return "", "", ""
+}
+
+// flags of the channels returned by the accessors of WebSocketClient
+const (
+	legacyHeartbeat uint32 = 1 << iota
+	legacySymbols
+	legacyL3
+	legacyL2
+	legacyPrices
+	legacyTicker
+	legacyTrades
+	legacyBalances
+	legacyTrading
+	// set once Listen is called or a handler registered
+	listening
+)
+
+var legacyFlags = map[channel]uint32{
+	heartbeatChannel: legacyHeartbeat,
+	symbolsChannel:   legacySymbols,
+	l3Channel:        legacyL3,
+	l2Channel:        legacyL2,
+	pricesChannel:    legacyPrices,
+	tickerChannel:    legacyTicker,
+	tradesChannel:    legacyTrades,
+	balancesChannel:  legacyBalances,
+	tradingChannel:   legacyTrading,
+}
+
+// Listen returns a new listener of the messages received by the client. Any
+// number of listeners can read the same channel without changing the
+// subscriptions of the connection.
+//
+// The channels returned by the accessors (L2Quotes(), Trading()...) are
+// unbuffered and shared by their readers. Once Listen has been called, or a
+// handler registered, they are only fed after their accessor has been called,
+// so a client read through listeners or handlers alone is never blocked by them.
+func (ws *WebSocketClient) Listen(opts ListenerOptions) *Listener {
+	ws.tap(listening)
+	return ws.hub.Listen(opts)
+}
+
+func (ws *WebSocketClient) tap(flag uint32) {
+	for {
+		legacy := atomic.LoadUint32(&ws.legacy)
+		if legacy&flag != 0 || atomic.CompareAndSwapUint32(&ws.legacy, legacy, legacy|flag) {
+			return
+		}
+	}
+}
+
+func (ws *WebSocketClient) tapped(flag uint32) bool {
+	legacy := atomic.LoadUint32(&ws.legacy)
+	return legacy&listening == 0 || legacy&flag != 0
+}
+
+// dispatch publishes a decoded message to the listeners and the handlers, then to its channel
+// unless listeners are used and the accessor of the channel was not called.
+// Channels configured with StreamOptions, and the trading channel, are fed
+// through their outbox.
+func (ws *WebSocketClient) dispatch(msg interface{}) {
+	ws.hub.Publish(msg)
+	ws.handlers.Dispatch(msg)
+	name, _, _ := describe(msg)
+	if !ws.tapped(legacyFlags[channel(name)]) {
+		return
+	}
+	if o, ok := ws.outboxes[channel(name)]; ok {
+		o.push(msg)
+		return
+	}
+	switch m := msg.(type) {
+	case HeartbeatMsg:
+		ws.chHeartbeat <- m
+	case SymbolMsg:
+		ws.chSymbols <- m
+	case L3Msg:
+		ws.chL3 <- m
+	case L2Msg:
+		ws.chL2 <- m
+	case PricesMsg:
+		ws.chPrices <- m
+	case TickerMsg:
+		ws.chTicker <- m
+	case TradesMsg:
+		ws.chTrades <- m
+	case BalancesSnapshot:
+		ws.chBalances <- m
+	case TradingMsg:
+		ws.chTrading <- m
+	}
+}
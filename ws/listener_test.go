@@ -0,0 +1,167 @@
+package ws_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+type frames []ws.Frame
+
+func (f *frames) Next() (ws.Frame, error) {
+	if len(*f) == 0 {
+		return ws.Frame{}, io.EOF
+	}
+	frame := (*f)[0]
+	*f = (*f)[1:]
+	return frame, nil
+}
+
+func newFrames(msgs ...string) *frames {
+	f := frames{}
+	for _, msg := range msgs {
+		f = append(f, ws.NewFrame([]byte(msg), time.Now()))
+	}
+	return &f
+}
+
+func TestListen(t *testing.T) {
+	client := ws.NewWebSocketClient(ws.Configuration{})
+	all := client.Listen(ws.ListenerOptions{})
+	btc := client.Listen(ws.ListenerOptions{Channels: []string{"l2", "trading"}, Symbols: []string{"BTC-USD"}})
+	snapshots := client.Listen(ws.ListenerOptions{Events: []string{"snapshot"}})
+	closed := client.Listen(ws.ListenerOptions{})
+	closed.Close()
+	closed.Close()
+	_, open := <-closed.C
+	require.False(t, open)
+
+	// no accessor was called: the messages only reach the listeners
+	source := newFrames(
+		`{"seqnum":1,"event":"snapshot","channel":"l2","symbol":"BTC-USD","bids":[{"px":100,"qty":1,"num":1}],"asks":[]}`,
+		`{"seqnum":2,"event":"updated","channel":"l2","symbol":"ETH-USD","bids":[{"px":10,"qty":1,"num":1}],"asks":[]}`,
+		`{"seqnum":3,"event":"updated","channel":"heartbeat"}`,
+		`{"seqnum":4,"event":"updated","channel":"trading","orderID":"1","symbol":"BTC-USD","ordStatus":"open"}`,
+	)
+	require.NoError(t, client.Replay(source, ws.ReplayOptions{}))
+
+	require.Len(t, all.C, 4)
+	require.Equal(t, "BTC-USD", (<-all.C).(ws.L2Msg).Symbol)
+	require.Equal(t, "ETH-USD", (<-all.C).(ws.L2Msg).Symbol)
+
+	require.Len(t, btc.C, 2)
+	require.Equal(t, 1, (<-btc.C).(ws.L2Msg).Seqnum)
+	require.Equal(t, "1", (<-btc.C).(*ws.TradingUpdated).OrderID)
+
+	require.Len(t, snapshots.C, 1)
+	require.Equal(t, "snapshot", (<-snapshots.C).(ws.L2Msg).Event)
+}
+
+func TestListenerDropped(t *testing.T) {
+	hub := ws.NewHub()
+	slow := hub.Listen(ws.ListenerOptions{Buffer: 1})
+	fast := hub.Listen(ws.ListenerOptions{Buffer: 4})
+	for i := 0; i < 3; i++ {
+		hub.Publish(ws.TradesMsg{Event: "updated", Symbol: "BTC-USD", Seqnum: i})
+	}
+	require.Equal(t, uint64(2), slow.Dropped())
+	require.Equal(t, uint64(0), fast.Dropped())
+	require.Equal(t, 0, (<-slow.C).(ws.TradesMsg).Seqnum)
+	require.Len(t, fast.C, 3)
+}
+
+func TestListenerTrading(t *testing.T) {
+	hub := ws.NewHub()
+	slow := hub.Listen(ws.ListenerOptions{Buffer: 1})
+	hub.Publish(ws.TradesMsg{Event: "updated", Symbol: "BTC-USD", Seqnum: 1})
+	// the buffer is full: the trading messages wait, the market data is dropped
+	for i := 0; i < 5; i++ {
+		hub.Publish(&ws.TradingUpdated{Seqnum: i})
+	}
+	hub.Publish(ws.TradesMsg{Event: "updated", Symbol: "BTC-USD", Seqnum: 2})
+	require.Equal(t, uint64(1), slow.Dropped())
+
+	require.Equal(t, 1, (<-slow.C).(ws.TradesMsg).Seqnum)
+	for i := 0; i < 5; i++ {
+		require.Equal(t, i, (<-slow.C).(*ws.TradingUpdated).Seqnum)
+	}
+
+	// closing a listener with waiting trading messages
+	hub.Publish(&ws.TradingUpdated{Seqnum: 5})
+	hub.Publish(&ws.TradingUpdated{Seqnum: 6})
+	slow.Close()
+	for range slow.C {
+	}
+}
+
+func TestListenerLossless(t *testing.T) {
+	hub := ws.NewHub()
+	lossless := hub.Listen(ws.ListenerOptions{Buffer: 1, Lossless: true})
+	defer lossless.Close()
+	for i := 0; i < 3; i++ {
+		hub.Publish(ws.SymbolMsg{Event: "updated", Name: "BTC-USD", Status: fmt.Sprint(i)})
+	}
+	require.Zero(t, lossless.Dropped())
+	for i := 0; i < 3; i++ {
+		require.Equal(t, fmt.Sprint(i), (<-lossless.C).(ws.SymbolMsg).Status)
+	}
+}
+
+func TestListenWithAccessor(t *testing.T) {
+	client := ws.NewWebSocketClient(ws.Configuration{})
+	listener := client.Listen(ws.ListenerOptions{})
+	trades := client.Trades()
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Replay(newFrames(`{"seqnum":1,"event":"updated","channel":"trades","symbol":"BTC-USD","price":100,"qty":1}`), ws.ReplayOptions{})
+	}()
+	require.Equal(t, 100.0, (<-trades).Price)
+	require.NoError(t, <-done)
+	require.Equal(t, 100.0, (<-listener.C).(ws.TradesMsg).Price)
+}
+
+func TestTickerUpdates(t *testing.T) {
+	client := ws.NewWebSocketClient(ws.Configuration{})
+	listener := client.Listen(ws.ListenerOptions{Channels: []string{"ticker"}})
+	require.NoError(t, client.Replay(newFrames(
+		`{"seqnum":1,"event":"snapshot","channel":"ticker","symbol":"BTC-USD","price_24h":90,"volume_24h":1000,"last_trade_price":100}`,
+		`{"seqnum":2,"event":"updated","channel":"ticker","symbol":"BTC-USD","last_trade_price":101}`,
+	), ws.ReplayOptions{}))
+
+	require.Len(t, listener.C, 2)
+	require.Equal(t, 100.0, (<-listener.C).(ws.TickerMsg).LastTradePrice)
+	update := (<-listener.C).(ws.TickerMsg)
+	require.Equal(t, "updated", update.Event)
+	require.Equal(t, "BTC-USD", update.Symbol)
+	require.Equal(t, 101.0, update.LastTradePrice)
+	require.False(t, update.Received.IsZero())
+}
+
+func TestSymbolUpdates(t *testing.T) {
+	client := ws.NewWebSocketClient(ws.Configuration{})
+	updates := client.Listen(ws.ListenerOptions{Channels: []string{"symbols"}, Events: []string{"updated"}})
+	all := client.Listen(ws.ListenerOptions{Channels: []string{"symbols"}})
+	require.NoError(t, client.Replay(newFrames(
+		`{"seqnum":1,"event":"snapshot","channel":"symbols","symbols":{"BTC-USD":{"base_currency":"BTC","counter_currency":"USD","status":"open"}}}`,
+		`{"seqnum":2,"event":"updated","channel":"symbols","symbol":"BTC-USD","base_currency":"BTC","counter_currency":"USD","status":"halt","auction_price":100,"auction_size":2,"auction_time":"1430","imbalance":-1}`,
+	), ws.ReplayOptions{}))
+
+	require.Len(t, all.C, 2)
+	snapshot := (<-all.C).(ws.SymbolMsg)
+	require.Equal(t, ws.Symbol("BTC-USD"), snapshot.Name)
+	require.Equal(t, "snapshot", snapshot.Event)
+	require.Equal(t, "open", snapshot.Status)
+
+	require.Len(t, updates.C, 1)
+	update := (<-updates.C).(ws.SymbolMsg)
+	require.Equal(t, ws.Symbol("BTC-USD"), update.Name)
+	require.Equal(t, "halt", update.Status)
+	require.Equal(t, 100.0, update.AuctionPrice)
+	require.Equal(t, "1430", update.AuctionTime)
+	require.False(t, update.Received.IsZero())
+}
@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/hmedkouri/go-bcex/metrics"
+)
+
+// wsMetrics records the activity of a WebSocketClient, see SetMetrics. Its
+// methods do nothing on a nil receiver.
+type wsMetrics struct {
+	messages      *metrics.Counter
+	decodeErrors  *metrics.Counter
+	reconnects    *metrics.Counter
+	gaps          *metrics.Counter
+	dropped       *metrics.Counter
+	orders        *metrics.Counter
+	subscriptions *metrics.Gauge
+	latency       *metrics.Histogram
+}
+
+// SetMetrics records the activity of the client in registry: the messages by
+// channel and event, the decode errors, reconnections, sequence gaps and
+// dropped messages, the orders submitted, acknowledged and rejected, the
+// subscriptions by state and the Latencies. Nil stops the recording.
+func (ws *WebSocketClient) SetMetrics(registry *metrics.Registry) {
+	var m *wsMetrics
+	if registry != nil {
+		m = &wsMetrics{
+			messages:      registry.Counter("bcex_ws_messages_total", "Websocket messages received by channel and event.", "channel", "event"),
+			decodeErrors:  registry.Counter("bcex_ws_decode_errors_total", "Websocket messages that could not be decoded by channel.", "channel"),
+			reconnects:    registry.Counter("bcex_ws_reconnects_total", "Websocket reconnections of the watchdog."),
+			gaps:          registry.Counter("bcex_ws_sequence_gaps_total", "Websocket messages missed according to their sequence numbers."),
+			dropped:       registry.Counter("bcex_ws_dropped_messages_total", "Websocket messages dropped by stream.", "stream"),
+			orders:        registry.Counter("bcex_ws_orders_total", "Orders by event: submit, ack (first response) and reject.", "event"),
+			subscriptions: registry.Gauge("bcex_ws_subscriptions", "Websocket subscriptions by state.", "state"),
+			latency: registry.Histogram("bcex_ws_latency_seconds", "Exchange to client latency by channel, and order acknowledgement latency.",
+				latencyBounds(), "kind"),
+		}
+		registry.OnCollect(func() { ws.collect(m) })
+	}
+	ws.hooksMu.Lock()
+	ws.metrics = m
+	ws.hooksMu.Unlock()
+	ws.latency.setMetrics(m)
+}
+
+func (ws *WebSocketClient) instruments() *wsMetrics {
+	ws.hooksMu.RLock()
+	defer ws.hooksMu.RUnlock()
+	return ws.metrics
+}
+
+// collect copies the counters maintained by the client into m, unless it was
+// replaced since
+func (ws *WebSocketClient) collect(m *wsMetrics) {
+	if ws.instruments() != m {
+		return
+	}
+	for stream, dropped := range ws.Dropped() {
+		m.dropped.Set(float64(dropped), stream)
+	}
+	states := map[SubscriptionState]int{}
+	for _, status := range ws.Subscriptions() {
+		states[status.State]++
+	}
+	m.subscriptions.Reset()
+	for state, count := range states {
+		m.subscriptions.Set(float64(count), string(state))
+	}
+}
+
+func latencyBounds() []float64 {
+	bounds := make([]float64, len(LatencyBuckets))
+	for i, bucket := range LatencyBuckets {
+		bounds[i] = bucket.Seconds()
+	}
+	return bounds
+}
+
+func (m *wsMetrics) message(c channel, e eventType) {
+	if m != nil {
+		m.messages.Inc(c.String(), e.String())
+	}
+}
+
+func (m *wsMetrics) decodeError(c channel) {
+	if m != nil {
+		m.decodeErrors.Inc(c.String())
+	}
+}
+
+func (m *wsMetrics) reconnect() {
+	if m != nil {
+		m.reconnects.Inc()
+	}
+}
+
+func (m *wsMetrics) gap(missed int64) {
+	if m != nil {
+		m.gaps.Add(float64(missed))
+	}
+}
+
+func (m *wsMetrics) order(event string) {
+	if m != nil {
+		m.orders.Inc(event)
+	}
+}
+
+func (m *wsMetrics) observe(kind string, d time.Duration) {
+	if m != nil {
+		m.latency.Observe(d.Seconds(), kind)
+	}
+}
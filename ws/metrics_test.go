@@ -0,0 +1,55 @@
+package ws_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/metrics"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	e := newExchange(t)
+	registry := metrics.NewRegistry()
+	client := ws.NewWebSocketClient(ws.Configuration{Host: "ws" + strings.TrimPrefix(e.URL, "http"), Timeout: time.Second})
+	client.SetMetrics(registry)
+	client.Listen(ws.ListenerOptions{})
+	require.NoError(t, client.Start(false))
+	defer client.Stop()
+
+	require.NoError(t, client.SubscribeToL2("BTC-USD"))
+	require.NoError(t, client.NewOrderSingleMessage(ws.NewOrderSingleMsg{ClOrdID: "c1", Symbol: "BTC-USD"}))
+	e.send(0, `{"seqnum":2,"event":"updated","channel":"l2","symbol":"BTC-USD","bids":[],"asks":[]}`)
+	// seqnums 3 and 4 are missed
+	e.send(0, `{"seqnum":5,"event":"updated","channel":"l2","symbol":"BTC-USD","bids":"none","asks":[]}`)
+	e.send(0, `{"seqnum":6,"event":"updated","channel":"trading","orderID":"1","clOrdID":"c1","ordStatus":"rejected"}`)
+	e.send(0, `{"seqnum":7,"event":"rejected","channel":"trading","clOrdID":"c2","text":"invalid"}`)
+
+	scrape := func() string {
+		var out strings.Builder
+		registry.WriteTo(&out)
+		return out.String()
+	}
+	require.Eventually(t, func() bool {
+		return strings.Contains(scrape(), `bcex_ws_orders_total{event="reject"} 2`)
+	}, time.Second, time.Millisecond)
+
+	out := scrape()
+	for _, line := range []string{
+		`bcex_ws_messages_total{channel="l2",event="snapshot"} 1`,
+		`bcex_ws_messages_total{channel="l2",event="subscribed"} 1`,
+		`bcex_ws_messages_total{channel="l2",event="updated"} 2`,
+		`bcex_ws_decode_errors_total{channel="l2"} 1`,
+		`bcex_ws_sequence_gaps_total 2`,
+		`bcex_ws_orders_total{event="ack"} 1`,
+		`bcex_ws_orders_total{event="submit"} 1`,
+		`bcex_ws_subscriptions{state="active"} 1`,
+		`bcex_ws_dropped_messages_total{stream="errors"} 0`,
+		`bcex_ws_latency_seconds_count{kind="order_ack"} 1`,
+	} {
+		require.Contains(t, out, line+"\n")
+	}
+}
@@ -0,0 +1,183 @@
+package ws
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/model"
+)
+
+// SideFromModel returns the websocket side for a model side
+func SideFromModel(s model.Side) OrderSide {
+	if s == model.SELL {
+		return SELL
+	}
+	return BUY
+}
+
+// OrderTypeFromModel returns the websocket order type for a model order type
+func OrderTypeFromModel(t model.OrderType) OrderType {
+	switch t {
+	case model.MARKET:
+		return MARKET
+	case model.STOP:
+		return STOP
+	case model.STOP_LIMIT:
+		return STOP_LIMIT
+	}
+	return LIMIT
+}
+
+// OrderStatusFromModel returns the websocket order status for a model order status
+func OrderStatusFromModel(s model.OrderStatus) OrderStatus {
+	switch s {
+	case model.PENDING:
+		return ORDER_STATUS_PENDING
+	case model.PARTIAL:
+		return ORDER_STATUS_PARTIAL
+	case model.FILLED:
+		return ORDER_STATUS_FILLED
+	case model.CANCELLED:
+		return ORDER_STATUS_CANCELLED
+	case model.REJECTED:
+		return ORDER_STATUS_REJECTED
+	case model.EXPIRED:
+		return ORDER_STATUS_EXPIRED
+	}
+	return ORDER_STATUS_OPEN
+}
+
+// NewOrderSingleFromModel builds the websocket order message for a model order request
+func NewOrderSingleFromModel(r model.OrderRequest) NewOrderSingleMsg {
+	order := NewOrderSingleMsg{
+		ClOrdID:     r.ClOrdID,
+		Symbol:      Symbol(r.Symbol),
+		OrdType:     OrderTypeFromModel(r.Type),
+		TimeInForce: TimeInForce(r.TimeInForce),
+		Side:        SideFromModel(r.Side),
+		OrderQty:    r.Qty,
+		Price:       r.Price,
+		StopPx:      r.StopPx,
+		MinQty:      r.MinQty,
+	}
+	if r.PostOnly {
+		order.ExecInst = ALO
+	}
+	if !r.ExpireDate.IsZero() {
+		order.ExpireDate, _ = strconv.Atoi(r.ExpireDate.Format("20060102"))
+	}
+	return order
+}
+
+func orderToModel(orderID, clOrdID, symbol, side, ordType, ordStatus, timeInForce, text string) model.Order {
+	o := model.Order{
+		OrderID: orderID,
+		ClOrdID: clOrdID,
+		Symbol:  symbol,
+		Text:    text,
+	}
+	o.Side, _ = model.ParseSide(side)
+	o.Type, _ = model.ParseOrderType(ordType)
+	o.Status, _ = model.ParseOrderStatus(ordStatus)
+	o.TimeInForce, _ = model.ParseTimeInForce(timeInForce)
+	return o
+}
+
+// ToModel converts the order into a model order
+func (o Order) ToModel() model.Order {
+	order := orderToModel(o.OrderID, o.ClOrdID, o.Symbol, o.Side, o.OrdType, o.OrdStatus, o.TimeInForce, o.Text)
+	order.Price = o.Price
+	order.OrderQty = o.OrderQty
+	order.LeavesQty = o.LeavesQty
+	order.CumQty = o.CumQty
+	order.AvgPx = o.AvgPx
+	order.Time = o.TransactTime
+	return order
+}
+
+// ToModel converts the execution report into a model order
+func (t TradingUpdated) ToModel() model.Order {
+	order := orderToModel(t.OrderID, t.ClOrdID, t.Symbol, t.Side, t.OrdType, t.OrdStatus, t.TimeInForce, t.Text)
+	order.Price = t.Price
+	order.OrderQty = t.OrderQty
+	order.LeavesQty = t.LeavesQty
+	order.CumQty = t.CumQty
+	order.AvgPx = t.AvgPx
+	order.Time = t.TransactTime
+	return order
+}
+
+// Fill returns the execution carried by the report, if any
+func (t TradingUpdated) Fill() (model.Fill, bool) {
+	if t.LastShares <= 0 {
+		return model.Fill{}, false
+	}
+	side, _ := model.ParseSide(t.Side)
+	return model.Fill{
+		TradeID: t.TradeID,
+		OrderID: t.OrderID,
+		ClOrdID: t.ClOrdID,
+		Symbol:  t.Symbol,
+		Side:    side,
+		Price:   t.LastPx,
+		Qty:     t.LastShares,
+		Time:    t.TransactTime,
+	}, true
+}
+
+// ToModel converts the balance into a model balance
+func (b BalanceMsg) ToModel() model.Balance {
+	return model.Balance{
+		Currency:       b.Currency,
+		Balance:        b.Balance,
+		Available:      b.Available,
+		BalanceLocal:   b.BalanceLocal,
+		AvailableLocal: b.AvailableLocal,
+		Rate:           b.Rate,
+	}
+}
+
+// ToModel converts the symbol into model reference data
+func (s SymbolMsg) ToModel() model.Symbol {
+	return model.Symbol{
+		Name:                   string(s.Name),
+		ID:                     int64(s.ID),
+		BaseCurrency:           s.BaseCurrency,
+		BaseCurrencyScale:      s.BaseCurrencyScale,
+		CounterCurrency:        s.CounterCurrency,
+		CounterCurrencyScale:   s.CounterCurrencyScale,
+		MinPriceIncrement:      int64(s.MinPriceIncrement),
+		MinPriceIncrementScale: s.MinPriceIncrementScale,
+		MinOrderSize:           int64(s.MinOrderSize),
+		MinOrderSizeScale:      s.MinOrderSizeScale,
+		MaxOrderSize:           int64(s.MaxOrderSize),
+		MaxOrderSizeScale:      s.MaxOrderSizeScale,
+		LotSize:                int64(s.LotSize),
+		LotSizeScale:           s.LotSizeScale,
+		Status:                 s.Status,
+		AuctionPrice:           s.AuctionPrice,
+		AuctionSize:            s.AuctionSize,
+		AuctionTime:            s.AuctionTime,
+		Imbalance:              s.Imbalance,
+	}
+}
+
+// Candle decodes the [timestamp, open, high, low, close, volume] array of the
+// message into a model candle covering the subscribed granularity
+func (p PricesMsg) Candle(granularity Granularity) (model.Candle, error) {
+	if len(p.Price) < 6 {
+		return model.Candle{}, fmt.Errorf("prices message for %s has %d values, expected 6", p.Symbol, len(p.Price))
+	}
+	start := time.UnixMilli(int64(p.Price[0])).UTC()
+	return model.Candle{
+		Symbol: p.Symbol,
+		Start:  start,
+		End:    start.Add(time.Duration(granularity) * time.Second),
+		Open:   p.Price[1],
+		High:   p.Price[2],
+		Low:    p.Price[3],
+		Close:  p.Price[4],
+		Volume: p.Price[5],
+	}, nil
+}
@@ -0,0 +1,464 @@
+package ws
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// PoolOptions bounds the connections opened for the Ws*Serve subscriptions
+type PoolOptions struct {
+	// MaxConnections is the number of connections of the pool, 4 when zero
+	MaxConnections int
+	// MaxSubscriptions is the number of streams a connection carries before
+	// the next ones are sharded to another connection, 50 when zero
+	MaxSubscriptions int
+}
+
+// ErrPoolExhausted is returned when every connection of the pool carries its
+// maximum number of subscriptions
+var ErrPoolExhausted = errors.New("subscription pool exhausted")
+
+// Subscription is a stream served to a handler
+type Subscription interface {
+	// Done is closed when the subscription ends, after Close or an error
+	Done() <-chan struct{}
+	// Err returns the error that ended the subscription, nil while it runs
+	// or when it was closed
+	Err() error
+	// Close ends the subscription
+	Close() error
+}
+
+// streamKey identifies a stream of a connection
+type streamKey struct {
+	channel     channel
+	symbol      Symbol
+	granularity Granularity
+}
+
+func (k streamKey) String() string {
+	if k.granularity != 0 {
+		return fmt.Sprintf("%s %s %d", k.channel, k.symbol, k.granularity)
+	}
+	return fmt.Sprintf("%s %s", k.channel, k.symbol)
+}
+
+func (k streamKey) request(action actionType) interface{} {
+	if k.channel == pricesChannel {
+		return pricesSubscriptionRequest{Action: action, Channel: k.channel, Symbol: k.symbol, Granularity: k.granularity}
+	}
+	return quoteSubscriptionRequest{Action: action, Channel: k.channel, Symbol: k.symbol}
+}
+
+// subscription is a handler of a stream carried by a pooled connection
+type subscription struct {
+	pool       *connPool
+	key        streamKey
+	handler    WsHandler
+	errHandler ErrHandler
+	conn       *pooledConn
+
+	done chan struct{}
+	once sync.Once
+	mu   sync.Mutex
+	err  error
+}
+
+func (s *subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *subscription) Close() error {
+	s.pool.remove(s)
+	s.end(nil)
+	return nil
+}
+
+// end closes Done, reporting err to the error handler
+func (s *subscription) end(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(s.done)
+		if err != nil && s.errHandler != nil {
+			s.errHandler(err)
+		}
+	})
+}
+
+// subscriptionGroup is a subscription to several streams, done once they all are
+type subscriptionGroup struct {
+	subs []Subscription
+	done chan struct{}
+}
+
+func newSubscriptionGroup(subs []Subscription) *subscriptionGroup {
+	g := &subscriptionGroup{subs: subs, done: make(chan struct{})}
+	go func() {
+		for _, s := range subs {
+			<-s.Done()
+		}
+		close(g.done)
+	}()
+	return g
+}
+
+func (g *subscriptionGroup) Done() <-chan struct{} {
+	return g.done
+}
+
+func (g *subscriptionGroup) Err() error {
+	for _, s := range g.subs {
+		if err := s.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *subscriptionGroup) Close() error {
+	for _, s := range g.subs {
+		s.Close()
+	}
+	return nil
+}
+
+// pooledConn is a connection of the pool and the streams it carries
+type pooledConn struct {
+	conn *websocket.Conn
+	// requests are written outside the pool mutex, in the order of the tickets
+	// taken with it held, so that the exchange sees the subscriptions and
+	// unsubscriptions of a stream in the order the pool decided them
+	writeMu sync.Mutex
+	turn    *sync.Cond
+	next    uint64
+	serving uint64
+	// subs is guarded by the pool mutex
+	subs map[streamKey][]*subscription
+}
+
+func newPooledConn(conn *websocket.Conn) *pooledConn {
+	c := &pooledConn{conn: conn, subs: make(map[streamKey][]*subscription)}
+	c.turn = sync.NewCond(&c.writeMu)
+	return c
+}
+
+// ticket reserves the next turn to write on the connection
+func (c *pooledConn) ticket() uint64 {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	t := c.next
+	c.next++
+	return t
+}
+
+// send writes request once the requests of the earlier tickets are written
+func (c *pooledConn) send(ticket uint64, request interface{}) error {
+	c.writeMu.Lock()
+	for c.serving != ticket {
+		c.turn.Wait()
+	}
+	c.writeMu.Unlock()
+	defer func() {
+		c.writeMu.Lock()
+		c.serving++
+		c.turn.Broadcast()
+		c.writeMu.Unlock()
+	}()
+	msg, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+func (c *pooledConn) write(request interface{}) error {
+	return c.send(c.ticket(), request)
+}
+
+// conflicts reports whether key cannot be told apart from a stream of the
+// connection: prices messages do not carry their granularity
+func (c *pooledConn) conflicts(key streamKey) bool {
+	for k := range c.subs {
+		if k.channel == key.channel && k.symbol == key.symbol && k != key {
+			return true
+		}
+	}
+	return false
+}
+
+// connPool multiplexes the subscriptions over a bounded set of connections
+type connPool struct {
+	cfg  Configuration
+	opts PoolOptions
+
+	mu    sync.Mutex
+	conns []*pooledConn
+	// dialing counts the connections being opened, without holding mu, and
+	// dialed is signaled when one of them is done
+	dialing int
+	dialed  *sync.Cond
+}
+
+func newConnPool(cfg Configuration, opts PoolOptions) *connPool {
+	if opts.MaxConnections <= 0 {
+		opts.MaxConnections = 4
+	}
+	if opts.MaxSubscriptions <= 0 {
+		opts.MaxSubscriptions = 50
+	}
+	p := &connPool{cfg: cfg, opts: opts}
+	p.dialed = sync.NewCond(&p.mu)
+	return p
+}
+
+// subscribe serves the stream key to handler. A stream already carried by a
+// connection is shared without subscribing again, so the new handler receives
+// its updates but not its initial snapshot.
+func (p *connPool) subscribe(key streamKey, handler WsHandler, errHandler ErrHandler) (Subscription, error) {
+	p.mu.Lock()
+	c, err := p.acquire(key)
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	s := &subscription{
+		pool:       p,
+		key:        key,
+		handler:    handler,
+		errHandler: errHandler,
+		conn:       c,
+		done:       make(chan struct{}),
+	}
+	first := len(c.subs[key]) == 0
+	c.subs[key] = append(c.subs[key], s)
+	var ticket uint64
+	if first {
+		ticket = c.ticket()
+	}
+	p.mu.Unlock()
+	if first {
+		if err := c.send(ticket, key.request(actionSubscribe)); err != nil {
+			p.drop(s)
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// place returns the connection carrying key, or else the first one with room
+// for it, nil when a connection must be opened
+func (p *connPool) place(key streamKey) *pooledConn {
+	for _, c := range p.conns {
+		if len(c.subs[key]) > 0 {
+			return c
+		}
+	}
+	for _, c := range p.conns {
+		if len(c.subs) < p.opts.MaxSubscriptions && !c.conflicts(key) {
+			return c
+		}
+	}
+	return nil
+}
+
+// acquire returns the connection to carry key, opening one when none has room
+// for it. It is called with p.mu held, released while dialing so the other
+// subscriptions are not blocked by the handshake.
+func (p *connPool) acquire(key streamKey) (*pooledConn, error) {
+	for {
+		if c := p.place(key); c != nil {
+			return c, nil
+		}
+		if len(p.conns)+p.dialing < p.opts.MaxConnections {
+			break
+		}
+		if p.dialing == 0 {
+			return nil, ErrPoolExhausted
+		}
+		// a connection being opened may have room for key
+		p.dialed.Wait()
+	}
+	p.dialing++
+	p.mu.Unlock()
+	c, err := p.open()
+	p.mu.Lock()
+	p.dialing--
+	p.dialed.Broadcast()
+	if err != nil {
+		return nil, err
+	}
+	// the stream may have been placed meanwhile by another subscription
+	if placed := p.place(key); placed != nil {
+		c.conn.Close()
+		return placed, nil
+	}
+	p.conns = append(p.conns, c)
+	go p.read(c)
+	return c, nil
+}
+
+// open dials a connection, authenticated when the configuration is secure. It
+// is not added to the pool.
+func (p *connPool) open() (*pooledConn, error) {
+	var d = websocket.Dialer{
+		Subprotocols:    []string{"p1", "p2"},
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Proxy:           http.ProxyFromEnvironment,
+	}
+
+	d.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	conn, _, err := d.Dial(p.cfg.Host, WsHeaders)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadLimit(655350)
+	c := newPooledConn(conn)
+	if p.cfg.IsSecure {
+		if err := c.write(&privateConnect{Channel: "auth", Token: p.cfg.ApiKey, Action: "subscribe"}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if p.cfg.Keepalive {
+		keepAlive(conn, p.cfg.Timeout, nil)
+	}
+	return c, nil
+}
+
+// closeLocked removes c from the pool and closes it, ending its read loop silently
+func (p *connPool) closeLocked(c *pooledConn) {
+	for i, conn := range p.conns {
+		if conn == c {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			break
+		}
+	}
+	c.conn.Close()
+}
+
+// remove detaches s from its connection, unsubscribing the stream when s was
+// its last handler
+func (p *connPool) remove(s *subscription) {
+	p.mu.Lock()
+	unsubscribe := p.detachLocked(s)
+	var ticket uint64
+	if unsubscribe {
+		ticket = s.conn.ticket()
+	}
+	p.mu.Unlock()
+	if unsubscribe {
+		s.conn.send(ticket, s.key.request(actionUnsubscribe))
+	}
+}
+
+// drop detaches s from its connection without unsubscribing, for a stream the
+// exchange does not carry
+func (p *connPool) drop(s *subscription) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.detachLocked(s)
+}
+
+// detachLocked removes s from its connection, closing the connection when it
+// carries no stream. It reports whether s was the last handler of a stream the
+// connection still carries.
+func (p *connPool) detachLocked(s *subscription) bool {
+	c := s.conn
+	subs := c.subs[s.key]
+	for i, sub := range subs {
+		if sub != s {
+			continue
+		}
+		subs = append(subs[:i], subs[i+1:]...)
+		if len(subs) > 0 {
+			c.subs[s.key] = subs
+			return false
+		}
+		delete(c.subs, s.key)
+		if len(c.subs) == 0 {
+			p.closeLocked(c)
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+func (p *connPool) read(c *pooledConn) {
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			p.fail(c, err)
+			return
+		}
+		p.route(c, msg)
+	}
+}
+
+// fail ends the subscriptions of a connection lost with err. A connection
+// closed by closeLocked is no longer in the pool and has no subscription.
+func (p *connPool) fail(c *pooledConn, err error) {
+	p.mu.Lock()
+	var ended []*subscription
+	for i, conn := range p.conns {
+		if conn == c {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			for _, subs := range c.subs {
+				ended = append(ended, subs...)
+			}
+			c.subs = make(map[streamKey][]*subscription)
+			break
+		}
+	}
+	p.mu.Unlock()
+	c.conn.Close()
+	for _, s := range ended {
+		s.end(err)
+	}
+}
+
+// route hands msg to the handlers of its stream. A rejected subscription ends
+// with the reason of the rejection, without unsubscribing a stream the exchange
+// does not carry.
+func (p *connPool) route(c *pooledConn, msg []byte) {
+	var commonMsg msgCommon
+	if err := json.Unmarshal(msg, &commonMsg); err != nil {
+		return
+	}
+	var subs []*subscription
+	p.mu.Lock()
+	for key, keySubs := range c.subs {
+		if key.channel == commonMsg.Channel && key.symbol == commonMsg.Symbol {
+			subs = append(subs, keySubs...)
+		}
+	}
+	p.mu.Unlock()
+
+	switch commonMsg.Event {
+	case eventSnapshot, eventUpdate:
+		for _, s := range subs {
+			s.handler(msg)
+		}
+	case eventRejected:
+		var rejectMsg RejectMsg
+		json.Unmarshal(msg, &rejectMsg)
+		for _, s := range subs {
+			p.drop(s)
+			s.end(fmt.Errorf("subscription to %s rejected: %s", s.key, rejectMsg.Text))
+		}
+	}
+}
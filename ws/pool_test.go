@@ -0,0 +1,272 @@
+package ws_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	Action      string `json:"action"`
+	Channel     string `json:"channel"`
+	Symbol      string `json:"symbol"`
+	Granularity int    `json:"granularity"`
+}
+
+// exchange is a websocket server answering subscriptions with a snapshot,
+// rejecting the symbols starting with "BAD", those starting with "ANON"
+// without naming them, and the authentications when rejectAuth is set. The responses to the symbols starting with "SLOW" are
+// delayed.
+type exchange struct {
+	*httptest.Server
+	mu       sync.Mutex
+	conns    []*websocket.Conn
+	requests [][]request
+	// accept, when set, is called before a connection is upgraded
+	accept func()
+	// rejectAuth rejects the authentication requests
+	rejectAuth bool
+}
+
+func newExchange(t *testing.T) *exchange {
+	e := &exchange{}
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.mu.Lock()
+		accept := e.accept
+		e.mu.Unlock()
+		if accept != nil {
+			accept()
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		e.mu.Lock()
+		index := len(e.conns)
+		e.conns = append(e.conns, conn)
+		e.requests = append(e.requests, nil)
+		e.mu.Unlock()
+		for {
+			var req request
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			e.mu.Lock()
+			e.requests[index] = append(e.requests[index], req)
+			e.mu.Unlock()
+			if req.Action != "subscribe" {
+				continue
+			}
+			e.mu.Lock()
+			rejectAuth := e.rejectAuth
+			e.mu.Unlock()
+			if req.Channel == "auth" && rejectAuth {
+				e.send(index, `{"event":"rejected","channel":"auth","text":"invalid token"}`)
+				continue
+			}
+			if strings.HasPrefix(req.Symbol, "ANON") {
+				e.send(index, fmt.Sprintf(`{"event":"rejected","channel":"%s","text":"%s unknown"}`, req.Channel, req.Symbol))
+				continue
+			}
+			if strings.HasPrefix(req.Symbol, "BAD") {
+				e.send(index, fmt.Sprintf(`{"event":"rejected","channel":"%s","symbol":"%s","text":"invalid symbol"}`, req.Channel, req.Symbol))
+				continue
+			}
+			respond := func(req request) {
+				e.send(index, fmt.Sprintf(`{"event":"subscribed","channel":"%s","symbol":"%s"}`, req.Channel, req.Symbol))
+				e.send(index, fmt.Sprintf(`{"seqnum":1,"event":"snapshot","channel":"%s","symbol":"%s","bids":[],"asks":[]}`, req.Channel, req.Symbol))
+			}
+			if strings.HasPrefix(req.Symbol, "SLOW") {
+				time.AfterFunc(50*time.Millisecond, func() { respond(req) })
+				continue
+			}
+			respond(req)
+		}
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+func (e *exchange) send(index int, msg string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.conns[index].WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+func (e *exchange) requestsOf(index int) []request {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]request(nil), e.requests[index]...)
+}
+
+func (e *exchange) connections() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.conns)
+}
+
+func TestServePool(t *testing.T) {
+	e := newExchange(t)
+	client := ws.NewWebSocketClient(ws.Configuration{
+		Host: "ws" + strings.TrimPrefix(e.URL, "http"),
+		Pool: ws.PoolOptions{MaxConnections: 2, MaxSubscriptions: 2},
+	})
+
+	var mu sync.Mutex
+	received := map[string]int{}
+	handler := func(event *ws.L2Msg) {
+		mu.Lock()
+		defer mu.Unlock()
+		received[event.Symbol]++
+	}
+	count := func(symbol string, n int) func() bool {
+		return func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return received[symbol] == n
+		}
+	}
+
+	btc, err := client.WsL2Serve("BTC-USD", handler, nil)
+	require.NoError(t, err)
+	require.Eventually(t, count("BTC-USD", 1), time.Second, time.Millisecond)
+	// the same stream is shared without subscribing again, an update reaches both handlers
+	again, err := client.WsL2Serve("BTC-USD", handler, nil)
+	require.NoError(t, err)
+	e.send(0, `{"seqnum":2,"event":"updated","channel":"l2","symbol":"BTC-USD","bids":[],"asks":[]}`)
+	require.Eventually(t, count("BTC-USD", 3), time.Second, time.Millisecond)
+
+	// ETH-USD fills the first connection, the next streams are sharded to the second one
+	combined, err := client.WsL2ServeCombined([]string{"ETH-USD", "LTC-USD"}, handler, nil)
+	require.NoError(t, err)
+	ticker, err := client.WsTickerServe("BTC-USD", func(*ws.TickerMsg) {}, nil)
+	require.NoError(t, err)
+	_, err = client.WsTickerServe("ETH-USD", func(*ws.TickerMsg) {}, nil)
+	require.ErrorIs(t, err, ws.ErrPoolExhausted)
+	require.Eventually(t, count("ETH-USD", 1), time.Second, time.Millisecond)
+	require.Eventually(t, count("LTC-USD", 1), time.Second, time.Millisecond)
+	require.Equal(t, 2, e.connections())
+	require.Len(t, e.requestsOf(0), 2)
+	require.Eventually(t, func() bool { return len(e.requestsOf(1)) == 2 }, time.Second, time.Millisecond)
+
+	// the stream is unsubscribed with its last handler
+	require.NoError(t, again.Close())
+	<-again.Done()
+	require.NoError(t, again.Err())
+	require.NoError(t, btc.Close())
+	require.Eventually(t, func() bool { return len(e.requestsOf(0)) == 3 }, time.Second, time.Millisecond)
+	require.Equal(t, request{Action: "unsubscribe", Channel: "l2", Symbol: "BTC-USD"}, e.requestsOf(0)[2])
+
+	// losing a connection ends its subscriptions with the error
+	e.mu.Lock()
+	e.conns[1].Close()
+	e.mu.Unlock()
+	select {
+	case <-ticker.Done():
+	case <-time.After(time.Second):
+		require.FailNow(t, "ticker subscription not ended")
+	}
+	require.Error(t, ticker.Err())
+	require.Error(t, combined.Err())
+	select {
+	case <-combined.Done():
+		require.FailNow(t, "combined subscription ended with a stream running")
+	default:
+	}
+	require.NoError(t, combined.Close())
+	<-combined.Done()
+}
+
+func TestServeRejected(t *testing.T) {
+	e := newExchange(t)
+	client := ws.NewWebSocketClient(ws.Configuration{Host: "ws" + strings.TrimPrefix(e.URL, "http")})
+	btc, err := client.WsTickerServe("BTC-USD", func(*ws.TickerMsg) {}, nil)
+	require.NoError(t, err)
+	errs := make(chan error, 1)
+	sub, err := client.WsPriceServe("BAD-USD", ws.Granularity60, func(*ws.PricesMsg) {}, func(err error) { errs <- err })
+	require.NoError(t, err)
+	<-sub.Done()
+	require.EqualError(t, sub.Err(), "subscription to prices BAD-USD 60 rejected: invalid symbol")
+	require.Equal(t, sub.Err(), <-errs)
+
+	// the rejected stream is dropped without unsubscribing, the connection
+	// keeps serving the other one
+	_, err = client.WsTickerServe("ETH-USD", func(*ws.TickerMsg) {}, nil)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(e.requestsOf(0)) == 3 }, time.Second, time.Millisecond)
+	require.Equal(t, request{Action: "subscribe", Channel: "ticker", Symbol: "ETH-USD"}, e.requestsOf(0)[2])
+	require.Equal(t, 1, e.connections())
+	select {
+	case <-btc.Done():
+		t.Fatal("the stream sharing the connection ended")
+	default:
+	}
+}
+
+func TestServePoolDialing(t *testing.T) {
+	e := newExchange(t)
+	client := ws.NewWebSocketClient(ws.Configuration{
+		Host: "ws" + strings.TrimPrefix(e.URL, "http"),
+		Pool: ws.PoolOptions{MaxConnections: 2, MaxSubscriptions: 1},
+	})
+	btc, err := client.WsL2Serve("BTC-USD", func(*ws.L2Msg) {}, nil)
+	require.NoError(t, err)
+
+	// the second connection is stuck in its handshake
+	accepting, release := make(chan struct{}, 1), make(chan struct{})
+	e.mu.Lock()
+	e.accept = func() {
+		accepting <- struct{}{}
+		<-release
+	}
+	e.mu.Unlock()
+	opened := make(chan error, 1)
+	go func() {
+		_, err := client.WsL2Serve("ETH-USD", func(*ws.L2Msg) {}, nil)
+		opened <- err
+	}()
+	<-accepting
+
+	// the streams of the first connection are not blocked by the dial
+	shared := make(chan error, 1)
+	go func() {
+		sub, err := client.WsL2Serve("BTC-USD", func(*ws.L2Msg) {}, nil)
+		if err == nil {
+			sub.Close()
+		}
+		shared <- err
+	}()
+	select {
+	case err := <-shared:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "subscription blocked by a dial")
+	}
+	// the connection being opened counts towards the maximum, the next stream
+	// waits for it to find it full
+	exhausted := make(chan error, 1)
+	go func() {
+		_, err := client.WsL2Serve("LTC-USD", func(*ws.L2Msg) {}, nil)
+		exhausted <- err
+	}()
+	select {
+	case <-exhausted:
+		require.FailNow(t, "subscription not waiting for the dial")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	require.NoError(t, <-opened)
+	require.ErrorIs(t, <-exhausted, ws.ErrPoolExhausted)
+	require.Equal(t, 2, e.connections())
+	require.NoError(t, btc.Close())
+}
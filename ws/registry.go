@@ -0,0 +1,291 @@
+package ws
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SubscriptionState is the state of a subscription of the connection
+type SubscriptionState string
+
+const (
+	// SubscriptionPending is waiting for the exchange to confirm the request
+	SubscriptionPending SubscriptionState = "pending"
+	// SubscriptionActive has been confirmed
+	SubscriptionActive SubscriptionState = "active"
+	// SubscriptionRejected has been rejected, see Reason
+	SubscriptionRejected SubscriptionState = "rejected"
+	// SubscriptionUnsubscribed has been ended by the exchange
+	SubscriptionUnsubscribed SubscriptionState = "unsubscribed"
+	// SubscriptionInactive was active on a connection since lost, the
+	// watchdog subscribes it again once reconnected
+	SubscriptionInactive SubscriptionState = "inactive"
+)
+
+// SubscriptionStatus describes a subscription of the connection
+type SubscriptionStatus struct {
+	Channel     string
+	Symbol      Symbol
+	Granularity Granularity
+	State       SubscriptionState
+	// Reason is the text of a rejection
+	Reason string
+	// Updated is when the state last changed
+	Updated time.Time
+}
+
+type registryEntry struct {
+	status SubscriptionStatus
+	// seq orders the pending requests of a channel
+	seq uint64
+	// resolved is closed when the request is confirmed or rejected
+	resolved chan struct{}
+	// resubscribe is set for the request subscribing again to a subscription
+	// lost with the connection, kept inactive when it fails
+	resubscribe bool
+	// failure is the reason of a request that failed without a response
+	failure string
+}
+
+// registry tracks the subscriptions of the connection by channel, symbol and
+// granularity, and correlates the responses of the exchange with the pending
+// requests
+type registry struct {
+	mu      sync.Mutex
+	seq     uint64
+	entries map[streamKey]*registryEntry
+}
+
+func newRegistry() *registry {
+	return &registry{entries: make(map[streamKey]*registryEntry)}
+}
+
+// expect records a request for key about to be sent. A request for key still
+// pending is shared: sent is true and the caller waits for its response
+// without sending the request again.
+func (r *registry) expect(key streamKey) (entry *registryEntry, sent bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, ok := r.entries[key]
+	if ok && previous.status.State == SubscriptionPending {
+		return previous, true
+	}
+	r.seq++
+	entry = &registryEntry{
+		status: SubscriptionStatus{
+			Channel:     key.channel.String(),
+			Symbol:      key.symbol,
+			Granularity: key.granularity,
+			State:       SubscriptionPending,
+			Updated:     time.Now(),
+		},
+		seq:         r.seq,
+		resolved:    make(chan struct{}),
+		resubscribe: ok && previous.status.State == SubscriptionInactive,
+	}
+	r.entries[key] = entry
+	return entry, false
+}
+
+// forget removes the entry of a request that could not be sent, failing the
+// callers sharing it with err
+func (r *registry) forget(key streamKey, entry *registryEntry, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failLocked(key, entry, err.Error())
+}
+
+// failLocked resolves the pending entry of key as failed for reason. A first
+// subscription is removed, rejected; a resubscription stays inactive, to be
+// subscribed again on the next reconnection.
+func (r *registry) failLocked(key streamKey, entry *registryEntry, reason string) {
+	if entry.status.State != SubscriptionPending {
+		return
+	}
+	entry.failure = reason
+	entry.status.Reason = reason
+	entry.status.Updated = time.Now()
+	if entry.resubscribe {
+		entry.status.State = SubscriptionInactive
+	} else {
+		entry.status.State = SubscriptionRejected
+		if r.entries[key] == entry {
+			delete(r.entries, key)
+		}
+	}
+	close(entry.resolved)
+}
+
+// resolve applies a response of the exchange to the oldest pending request it
+// can answer. Responses name the channel, and usually the symbol, but not
+// always the granularity.
+func (r *registry) resolve(msg msgCommon, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		key   streamKey
+		entry *registryEntry
+	)
+	for k, e := range r.entries {
+		if k.channel != msg.Channel || (msg.Symbol != "" && k.symbol != msg.Symbol) ||
+			(msg.Granularity != 0 && k.granularity != msg.Granularity) {
+			continue
+		}
+		if msg.Event == eventUnsubscribed {
+			if e.status.State == SubscriptionActive {
+				e.status.State = SubscriptionUnsubscribed
+				e.status.Updated = time.Now()
+			}
+			continue
+		}
+		if e.status.State == SubscriptionPending && (entry == nil || e.seq < entry.seq) {
+			key, entry = k, e
+		}
+	}
+	if msg.Event == eventUnsubscribed {
+		return
+	}
+	if entry == nil {
+		// a subscription the client did not wait for
+		r.seq++
+		key = streamKey{channel: msg.Channel, symbol: msg.Symbol, granularity: msg.Granularity}
+		entry = &registryEntry{
+			status:   SubscriptionStatus{Channel: msg.Channel.String(), Symbol: msg.Symbol, Granularity: msg.Granularity},
+			seq:      r.seq,
+			resolved: make(chan struct{}),
+		}
+		r.entries[key] = entry
+	}
+	entry.status.Updated = time.Now()
+	if msg.Event == eventRejected {
+		entry.status.State = SubscriptionRejected
+		entry.status.Reason = reason
+	} else {
+		entry.status.State = SubscriptionActive
+		entry.status.Reason = ""
+	}
+	close(entry.resolved)
+}
+
+var errTimeout = errors.New("timed out waiting for subscription response")
+
+// wait returns when the request of entry is confirmed, nil, or rejected, with
+// the reason of the rejection, or after timeout
+func (r *registry) wait(entry *registryEntry, timeout time.Duration) error {
+	select {
+	case <-entry.resolved:
+	case <-time.After(timeout):
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		log.Printf("timed out waiting for subscription response (channel: %s)", entry.status.Channel)
+		// a later request is sent again rather than sharing this one
+		for key, e := range r.entries {
+			if e == entry {
+				r.failLocked(key, entry, errTimeout.Error())
+			}
+		}
+		return errTimeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry.failure != "" || entry.status.State == SubscriptionRejected {
+		log.Printf("Failed to subscribe: %s %s", entry.status.Channel, entry.status.Reason)
+		return errors.New(entry.status.Reason)
+	}
+	log.Printf("Successfully subscribed to %s", entry.status.Channel)
+	return nil
+}
+
+// disconnected marks the confirmed subscriptions inactive, the connection
+// carrying them being lost, and fails the pending requests
+func (r *registry) disconnected() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, entry := range r.entries {
+		if entry.status.State == SubscriptionPending {
+			r.failLocked(key, entry, "connection lost")
+			continue
+		}
+		if entry.status.State == SubscriptionActive {
+			entry.status.State = SubscriptionInactive
+			entry.status.Updated = time.Now()
+		}
+	}
+}
+
+// inactive returns the keys of the subscriptions lost with the connection,
+// authentication excluded
+func (r *registry) inactive() []streamKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []streamKey
+	for key, entry := range r.entries {
+		if key.channel != authChannel && entry.status.State == SubscriptionInactive {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (r *registry) list() []SubscriptionStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	statuses := make([]SubscriptionStatus, 0, len(r.entries))
+	for _, entry := range r.entries {
+		statuses = append(statuses, entry.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+		if a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		return a.Granularity < b.Granularity
+	})
+	return statuses
+}
+
+// Subscriptions returns the subscriptions requested on the connection and
+// their state, sorted by channel, symbol and granularity
+func (ws *WebSocketClient) Subscriptions() []SubscriptionStatus {
+	return ws.registry.list()
+}
+
+// subscribe sends request, the subscription to key, and waits for its
+// response. Subscriptions run concurrently, the registry matching each
+// response with its request; those to a key already pending share its request.
+func (ws *WebSocketClient) subscribe(key streamKey, request interface{}) error {
+	entry, err := ws.send(key, request)
+	if err != nil {
+		return err
+	}
+	return ws.registry.wait(entry, ws.config.Timeout)
+}
+
+// send writes request, the subscription to key, unless one is pending already,
+// and returns the registry entry its response resolves
+func (ws *WebSocketClient) send(key streamKey, request interface{}) (*registryEntry, error) {
+	subscribeRequestBytes, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, sent := ws.registry.expect(key)
+	if !sent {
+		ws.connMu.Lock()
+		err = ws.conn.WriteMessage(websocket.TextMessage, subscribeRequestBytes)
+		ws.connMu.Unlock()
+		if err != nil {
+			ws.registry.forget(key, entry, err)
+			return nil, err
+		}
+	}
+	return entry, nil
+}
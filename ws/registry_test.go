@@ -0,0 +1,95 @@
+package ws_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptions(t *testing.T) {
+	e := newExchange(t)
+	client := ws.NewWebSocketClient(ws.Configuration{Host: "ws" + strings.TrimPrefix(e.URL, "http"), Timeout: time.Second})
+	client.Listen(ws.ListenerOptions{})
+	require.NoError(t, client.Start(false))
+	defer client.Stop()
+
+	// the confirmation of BTC-USD arrives first, it must not answer SLOW-USD
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, symbol := range []ws.Symbol{"SLOW-USD", "BTC-USD"} {
+		wg.Add(1)
+		go func(i int, symbol ws.Symbol) {
+			defer wg.Done()
+			errs[i] = client.SubscribeToL2(symbol)
+		}(i, symbol)
+		// the requests reach the exchange in order
+		require.Eventually(t, func() bool { return len(e.requestsOf(0)) == i+1 }, time.Second, time.Millisecond)
+	}
+	wg.Wait()
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	require.EqualError(t, client.SubscribeToL2("ANON-USD"), "ANON-USD unknown")
+	require.EqualError(t, client.SubscribeToPrices("BAD-USD", ws.Granularity60), "invalid symbol")
+
+	e.send(0, `{"event":"unsubscribed","channel":"l2","symbol":"BTC-USD"}`)
+	require.Eventually(t, func() bool {
+		return client.Subscriptions()[1].State == ws.SubscriptionUnsubscribed
+	}, time.Second, time.Millisecond)
+
+	var states []string
+	for _, status := range client.Subscriptions() {
+		states = append(states, strings.Join([]string{status.Channel, string(status.Symbol), string(status.State), status.Reason}, " "))
+	}
+	require.Equal(t, []string{
+		"l2 ANON-USD rejected ANON-USD unknown",
+		"l2 BTC-USD unsubscribed ",
+		"l2 SLOW-USD active ",
+		"prices BAD-USD rejected invalid symbol",
+	}, states)
+	require.Equal(t, ws.Granularity60, client.Subscriptions()[3].Granularity)
+}
+
+func TestSubscriptionsShared(t *testing.T) {
+	e := newExchange(t)
+	client := ws.NewWebSocketClient(ws.Configuration{Host: "ws" + strings.TrimPrefix(e.URL, "http"), Timeout: time.Second})
+	client.Listen(ws.ListenerOptions{})
+	require.NoError(t, client.Start(false))
+	defer client.Stop()
+
+	// the concurrent subscriptions to a pending stream share its request
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = client.SubscribeToL2("SLOW-USD")
+		}(i)
+		if i == 0 {
+			require.Eventually(t, func() bool { return len(e.requestsOf(0)) == 1 }, time.Second, time.Millisecond)
+		}
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	require.Len(t, e.requestsOf(0), 1)
+	require.Equal(t, ws.SubscriptionActive, client.Subscriptions()[0].State)
+
+	// a lost connection fails the pending requests without waiting for their timeout
+	done := make(chan error, 1)
+	go func() { done <- client.SubscribeToL2("SLOW-ETH") }()
+	require.Eventually(t, func() bool { return len(e.requestsOf(0)) > 1 && client.Subscriptions()[0].State == ws.SubscriptionPending }, time.Second, time.Millisecond)
+	require.NoError(t, client.Stop())
+	select {
+	case err := <-done:
+		require.EqualError(t, err, "connection lost")
+	case <-time.After(500 * time.Millisecond):
+		require.FailNow(t, "pending subscription not failed")
+	}
+}
@@ -0,0 +1,110 @@
+package ws
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// FrameSource provides recorded frames in receive time order, io.EOF at the end
+type FrameSource interface {
+	Next() (Frame, error)
+}
+
+// ReplayOptions controls the playback speed of a replay
+type ReplayOptions struct {
+	// Speed is the playback rate relative to the recording: 1 is real time,
+	// 10 ten times faster, zero or less as fast as possible
+	Speed float64
+	// Start is the time playback starts at. Earlier frames are dispatched
+	// without delay so the state they carry (order books, snapshots) is
+	// rebuilt before paced playback begins. Use the source to skip frames.
+	Start time.Time
+	// Quit stops the replay when closed
+	Quit <-chan struct{}
+}
+
+// Replay feeds recorded frames through the same decoding and dispatch path as
+// a live connection, so L2Quotes(), Trades(), Trading()... deliver them as if
+// they had been received from the exchange. It blocks until the source is
+// exhausted, returning nil, or fails. Subscription confirmations found in the
+// recording are ignored and recorded frames are not recorded again. The frames
+// are only decoded and dispatched: they do not feed the metrics, Latencies,
+// Health or the order spans of the client.
+func (ws *WebSocketClient) Replay(source FrameSource, opts ReplayOptions) error {
+	var (
+		started   bool
+		wallStart time.Time
+		feedStart time.Time
+	)
+	for {
+		frame, err := source.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if opts.Speed > 0 && !frame.Time.Before(opts.Start) {
+			if !started {
+				started = true
+				wallStart = time.Now()
+				feedStart = frame.Time
+			}
+			offset := time.Duration(float64(frame.Time.Sub(feedStart)) / opts.Speed)
+			if wait := time.Until(wallStart.Add(offset)); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-opts.Quit:
+					return nil
+				}
+			}
+		}
+
+		select {
+		case <-opts.Quit:
+			return nil
+		default:
+		}
+
+		ws.replayMessage(frame.Bytes(), frame.Time)
+	}
+}
+
+// replayMessage decodes a recorded message and dispatches it. Unlike
+// handleMessage it leaves the instruments of the live connection alone: the
+// metrics, latencies, health, sequence numbers and order spans.
+func (ws *WebSocketClient) replayMessage(msg []byte, received time.Time) {
+	if string(msg) == "ping" {
+		return
+	}
+	var commonMsg msgCommon
+	if err := json.Unmarshal(msg, &commonMsg); err != nil {
+		log.Printf("Error un-marshalling common message: %s", err.Error())
+		return
+	}
+	if isSubscriptionResponse(commonMsg) {
+		return
+	}
+	decoded, err := decodeMessage(commonMsg, msg, received)
+	if err != nil {
+		log.Printf("Error un-marshalling %s", err.Error())
+		return
+	}
+	for _, message := range decoded {
+		ws.dispatch(message)
+	}
+}
+
+// isSubscriptionResponse reports whether commonMsg answers a subscription
+// request, which only makes sense on the connection that sent the request
+func isSubscriptionResponse(commonMsg msgCommon) bool {
+	switch commonMsg.Event {
+	case eventSubscribed, eventUnsubscribed:
+		return true
+	case eventRejected:
+		return commonMsg.Channel != tradingChannel
+	}
+	return false
+}
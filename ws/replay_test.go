@@ -0,0 +1,56 @@
+package ws_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/metrics"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayDispatchOnly(t *testing.T) {
+	registry := metrics.NewRegistry()
+	client := ws.NewWebSocketClient(ws.Configuration{})
+	client.SetMetrics(registry)
+	listener := client.Listen(ws.ListenerOptions{})
+
+	sent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	require.NoError(t, client.Replay(newFrames(
+		`{"seqnum":1,"event":"updated","channel":"heartbeat","timestamp":"`+sent+`"}`,
+		// seqnums 2 and 3 are missing from the recording
+		`{"seqnum":4,"event":"updated","channel":"trades","symbol":"BTC-USD","timestamp":"`+sent+`","side":"buy","qty":1,"price":100}`,
+		`{"seqnum":5,"event":"updated","channel":"trading","orderID":"1","clOrdID":"c1","ordStatus":"rejected"}`,
+		`{"seqnum":6,"event":"updated","channel":"l2","symbol":"BTC-USD","bids":"none","asks":[]}`,
+	), ws.ReplayOptions{}))
+
+	// the messages are dispatched, but for the one that does not decode
+	for _, expected := range []interface{}{ws.HeartbeatMsg{}, ws.TradesMsg{}, &ws.TradingUpdated{}} {
+		select {
+		case msg := <-listener.C:
+			require.IsType(t, expected, msg)
+		case <-time.After(time.Second):
+			require.FailNow(t, "message not dispatched")
+		}
+	}
+
+	// the instruments of the live connection are left alone
+	require.Empty(t, client.Latencies())
+	health := client.Health()
+	require.Zero(t, health.SequenceGaps)
+	require.Zero(t, health.HeartbeatSeq)
+	require.True(t, health.LastHeartbeat.IsZero())
+	var out strings.Builder
+	registry.WriteTo(&out)
+	for _, series := range []string{
+		"bcex_ws_messages_total{",
+		"bcex_ws_decode_errors_total{",
+		"bcex_ws_orders_total{",
+		"bcex_ws_latency_seconds_count{",
+	} {
+		require.NotContains(t, out.String(), series)
+	}
+	require.NotContains(t, out.String(), "bcex_ws_sequence_gaps_total 2")
+}
@@ -1,8 +1,7 @@
 package ws
 
 import (
-	"crypto/tls"
-	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -36,301 +35,115 @@ type WsTickerMsgHandler func(event *TickerMsg)
 type WsPriceMsgHandler func(event *PricesMsg)
 
 // WsL2Serve serve websocket l2 handler with a symbol
-func (ws *WebSocketClient) WsL2Serve(symbol string, handler WsL2MsgHandler, errHandler ErrHandler) (doneC, stopC chan struct{}, err error) {
-	cfg := ws.config
-	cfg.IsSecure = false
+func (ws *WebSocketClient) WsL2Serve(symbol string, handler WsL2MsgHandler, errHandler ErrHandler) (Subscription, error) {
 	wsHandler := func(message []byte) {
 		var m L2Msg
-		err := json.Unmarshal(message, &m)
-		if err != nil {
+		if err := json.Unmarshal(message, &m); err != nil {
 			errHandler(err)
 			return
-		}		
+		}
 		handler(&m)
 	}
-
-	r := quoteSubscriptionRequest{
-		Action:  actionSubscribe,
-		Channel: l2Channel,
-		Symbol:  Symbol(symbol),
-	}
-
-	return wsServe(cfg, r, wsHandler, errHandler)
+	return ws.pool.subscribe(streamKey{channel: l2Channel, symbol: Symbol(symbol)}, wsHandler, errHandler)
 }
 
 // WsL2ServeCombined serve websocket l2 handler for a list of symbols
-func (ws *WebSocketClient) WsL2ServeCombined(symbols []string, handler WsL2MsgHandler, errHandler ErrHandler) (doneC, stopC chan struct{}, err error) {
-	cfg := ws.config
-	cfg.IsSecure = false
-	wsHandler := func(message []byte) {
-		var m L2Msg
-		err := json.Unmarshal(message, &m)
+func (ws *WebSocketClient) WsL2ServeCombined(symbols []string, handler WsL2MsgHandler, errHandler ErrHandler) (Subscription, error) {
+	subs := make([]Subscription, 0, len(symbols))
+	for _, symbol := range symbols {
+		sub, err := ws.WsL2Serve(symbol, handler, errHandler)
 		if err != nil {
-			errHandler(err)
-			return
-		}		
-		handler(&m)
-	}
-
-	requests := make([]interface{}, len(symbols))
-	for i, symbol := range symbols {
-		r := quoteSubscriptionRequest{
-			Action:  actionSubscribe,
-			Channel: l2Channel,
-			Symbol:  Symbol(symbol),
+			for _, sub := range subs {
+				sub.Close()
+			}
+			return nil, err
 		}
-		requests[i] = r
+		subs = append(subs, sub)
 	}
-
-	return wsServeCombined(cfg, requests, wsHandler, errHandler)
+	return newSubscriptionGroup(subs), nil
 }
 
 // WsL3Serve serve websocket l3 handler with a symbol
-func (ws *WebSocketClient) WsL3Serve(symbol string, handler WsL3MsgHandler, errHandler ErrHandler) (doneC, stopC chan struct{}, err error) {
-	cfg := ws.config
-	cfg.IsSecure = false
+func (ws *WebSocketClient) WsL3Serve(symbol string, handler WsL3MsgHandler, errHandler ErrHandler) (Subscription, error) {
 	wsHandler := func(message []byte) {
 		var m L3Msg
-		err := json.Unmarshal(message, &m)
-		if err != nil {
+		if err := json.Unmarshal(message, &m); err != nil {
 			errHandler(err)
 			return
-		}		
+		}
 		handler(&m)
 	}
-
-	r := quoteSubscriptionRequest{
-		Action:  actionSubscribe,
-		Channel: l3Channel,
-		Symbol:  Symbol(symbol),
-	}
-
-	return wsServe(cfg, r, wsHandler, errHandler)
+	return ws.pool.subscribe(streamKey{channel: l3Channel, symbol: Symbol(symbol)}, wsHandler, errHandler)
 }
 
 // WsTickerServe serve websocket ticker handler with a symbol
-func (ws *WebSocketClient) WsTickerServe(symbol string, handler WsTickerMsgHandler, errHandler ErrHandler) (doneC, stopC chan struct{}, err error) {
-	cfg := ws.config
-	cfg.IsSecure = false
+func (ws *WebSocketClient) WsTickerServe(symbol string, handler WsTickerMsgHandler, errHandler ErrHandler) (Subscription, error) {
 	wsHandler := func(message []byte) {
 		var m TickerMsg
-		err := json.Unmarshal(message, &m)
-		if err != nil {
+		if err := json.Unmarshal(message, &m); err != nil {
 			errHandler(err)
 			return
-		}		
+		}
 		handler(&m)
 	}
-
-	r := tickerSubscriptionRequest{
-		Action:  actionSubscribe,
-		Channel: tickerChannel,
-		Symbol:  Symbol(symbol),
-	}
-
-	return wsServe(cfg, r, wsHandler, errHandler)
+	return ws.pool.subscribe(streamKey{channel: tickerChannel, symbol: Symbol(symbol)}, wsHandler, errHandler)
 }
 
-// WsPriceServe serve websocket ticker handler with a symbol
-func (ws *WebSocketClient) WsPriceServe(symbol string, granularity Granularity, handler WsPriceMsgHandler, errHandler ErrHandler) (doneC, stopC chan struct{}, err error) {
-	cfg := ws.config
-	cfg.IsSecure = false
+// WsPriceServe serve websocket price handler with a symbol
+func (ws *WebSocketClient) WsPriceServe(symbol string, granularity Granularity, handler WsPriceMsgHandler, errHandler ErrHandler) (Subscription, error) {
 	wsHandler := func(message []byte) {
 		var m PricesMsg
-		err := json.Unmarshal(message, &m)
-		if err != nil {
+		if err := json.Unmarshal(message, &m); err != nil {
 			errHandler(err)
 			return
-		}		
-		handler(&m)
-	}
-
-	r := pricesSubscriptionRequest{
-		Action:      actionSubscribe,
-		Channel:     pricesChannel,
-		Symbol:      Symbol(symbol),
-		Granularity: granularity,
-	}
-
-	return wsServe(cfg, r, wsHandler, errHandler)
-}
-
-var wsServe = func(cfg Configuration, request interface{}, handler WsHandler, errHandler ErrHandler) (doneC, stopC chan struct{}, err error) {
-	var d = websocket.Dialer{
-		Subprotocols:    []string{"p1", "p2"},
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		Proxy:           http.ProxyFromEnvironment,
-	}
-
-	d.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	c, _, err := d.Dial(cfg.Host, WsHeaders)
-	if err != nil {
-		return nil, nil, err
-	}
-	c.SetReadLimit(655350)
-	if cfg.IsSecure {
-		//WsHeaders.Add("Cookie", cookie[ws.config.Env]+ws.config.ApiKey)
-		connectMsg, _ := json.Marshal(&privateConnect{
-			Channel: "auth",
-			Token:   cfg.ApiKey,
-			Action:  "subscribe",
-		})
-
-		// Send auth message
-		err = c.WriteMessage(websocket.TextMessage, connectMsg)
-		if err != nil {
-			return nil, nil, err
 		}
+		handler(&m)
 	}
-
-	requestBytes, err := json.Marshal(request)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	// Send subscription request
-	err = c.WriteMessage(websocket.TextMessage, requestBytes)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	doneC = make(chan struct{})
-	stopC = make(chan struct{})
-	go func() {
-		// This function will exit either on error from
-		// websocket.Conn.ReadMessage or when the stopC channel is
-		// closed by the client.
-		defer close(doneC)
-		if cfg.Keepalive {
-			keepAlive(c, cfg.Timeout)
-		}
-		// Wait for the stopC channel to be closed.  We do that in a
-		// separate goroutine because ReadMessage is a blocking
-		// operation.
-		silent := false
-		go func() {
-			select {
-			case <-stopC:
-				silent = true
-			case <-doneC:
-			}
-			c.Close()
-		}()
-		for {
-			_, message, err := c.ReadMessage()
-			if err != nil {
-				if !silent {
-					errHandler(err)
-				}
-				return
-			}
-			handler(message)
-		}
-	}()
-	return
+	key := streamKey{channel: pricesChannel, symbol: Symbol(symbol), granularity: granularity}
+	return ws.pool.subscribe(key, wsHandler, errHandler)
 }
 
-var wsServeCombined = func(cfg Configuration, requests []interface{}, handler WsHandler, errHandler ErrHandler) (doneC, stopC chan struct{}, err error) {
-	var d = websocket.Dialer{
-		Subprotocols:    []string{"p1", "p2"},
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		Proxy:           http.ProxyFromEnvironment,
-	}
-
-	d.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	c, _, err := d.Dial(cfg.Host, WsHeaders)
-	if err != nil {
-		return nil, nil, err
-	}
-	c.SetReadLimit(655350)
-	if cfg.IsSecure {
-		//WsHeaders.Add("Cookie", cookie[ws.config.Env]+ws.config.ApiKey)
-		connectMsg, _ := json.Marshal(&privateConnect{
-			Channel: "auth",
-			Token:   cfg.ApiKey,
-			Action:  "subscribe",
-		})
-
-		// Send auth message
-		err = c.WriteMessage(websocket.TextMessage, connectMsg)
-		if err != nil {
-			return nil, nil, err
-		}
+// keepAlive pings c every timeout, PingFrequency when zero, and closes it when
+// no pong arrived within timeout. roundTrip, when set, is called with the
+// round trip of each ping.
+func keepAlive(c *websocket.Conn, timeout time.Duration, roundTrip func(time.Duration)) {
+	if timeout <= 0 {
+		timeout = PingFrequency
 	}
-
-	for _, request := range requests {
-		requestBytes, err := json.Marshal(request)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		// Send subscription request
-		err = c.WriteMessage(websocket.TextMessage, requestBytes)
-		if err != nil {
-			return nil, nil, err
-		}
-	}
-
-	doneC = make(chan struct{})
-	stopC = make(chan struct{})
-	go func() {
-		// This function will exit either on error from
-		// websocket.Conn.ReadMessage or when the stopC channel is
-		// closed by the client.
-		defer close(doneC)
-		if cfg.Keepalive {
-			keepAlive(c, cfg.Timeout)
-		}
-		// Wait for the stopC channel to be closed.  We do that in a
-		// separate goroutine because ReadMessage is a blocking
-		// operation.
-		silent := false
-		go func() {
-			select {
-			case <-stopC:
-				silent = true
-			case <-doneC:
-			}
-			c.Close()
-		}()
-		for {
-			_, message, err := c.ReadMessage()
-			if err != nil {
-				if !silent {
-					errHandler(err)
-				}
-				return
-			}
-			handler(message)
-		}
-	}()
-	return
-}
-
-func keepAlive(c *websocket.Conn, timeout time.Duration) {
 	ticker := time.NewTicker(timeout)
 
-	lastResponse := time.Now()
+	var mu sync.Mutex
+	lastResponse, lastPing := time.Now(), time.Now()
 	c.SetPongHandler(func(msg string) error {
+		mu.Lock()
 		lastResponse = time.Now()
+		rtt := lastResponse.Sub(lastPing)
+		mu.Unlock()
+		if roundTrip != nil {
+			roundTrip(rtt)
+		}
 		return nil
 	})
 
 	go func() {
 		defer ticker.Stop()
 		for {
+			mu.Lock()
+			lastPing = time.Now()
+			mu.Unlock()
 			deadline := time.Now().Add(10 * time.Second)
 			err := c.WriteControl(websocket.PingMessage, []byte{}, deadline)
 			if err != nil {
 				return
 			}
 			<-ticker.C
-			if time.Since(lastResponse) > timeout {
+			mu.Lock()
+			since := time.Since(lastResponse)
+			mu.Unlock()
+			if since > timeout {
 				c.Close()
 				return
 			}
 		}
 	}()
-}
\ No newline at end of file
+}
@@ -0,0 +1,74 @@
+package ws
+
+import (
+	"github.com/hmedkouri/go-bcex/metrics"
+	"github.com/hmedkouri/go-bcex/tracing"
+)
+
+// Streamer is the set of methods offered by WebSocketClient, so consumers can
+// depend on an interface and substitute a fake in their tests
+type Streamer interface {
+	Start(authenticate bool) error
+	Stop() error
+	IsConnected() bool
+	IsAuthenticated() bool
+	Health() Health
+	Authenticate(token string) error
+
+	Heartbeats() chan HeartbeatMsg
+	Symbols() chan SymbolMsg
+	L3Quotes() chan L3Msg
+	L2Quotes() chan L2Msg
+	Prices() chan PricesMsg
+	Ticker() chan TickerMsg
+	Trades() chan TradesMsg
+	Balances() chan BalancesSnapshot
+	Trading() chan TradingMsg
+	Errors() chan error
+	Listen(opts ListenerOptions) *Listener
+	Dropped() map[string]uint64
+	Latencies() map[string]LatencyStats
+
+	OnL2(handler WsL2MsgHandler)
+	OnL3(handler WsL3MsgHandler)
+	OnTicker(handler WsTickerMsgHandler)
+	OnPrices(handler WsPriceMsgHandler)
+	OnTrade(handler WsTradesMsgHandler)
+	OnExecutionReport(handler WsTradingMsgHandler)
+	OnBalances(handler WsBalancesMsgHandler)
+	OnHeartbeat(handler WsHeartbeatMsgHandler)
+	OnError(handler ErrHandler)
+
+	SubscribeHeartbeat() error
+	SubscribeToSymbols() error
+	SubscribeToL3(symbol Symbol) error
+	SubscribeToL2(symbol Symbol) error
+	SubscribeToPrices(symbol Symbol, granularity Granularity) error
+	SubscribeToTicker(symbol Symbol) error
+	SubscribeToTrades(symbol Symbol) error
+	SubscribeToBalances() error
+	SubscribeToTrading() error
+	SubscribeToL2Combined(symbols []Symbol) error
+	SubscribeToL3Combined(symbols []Symbol) error
+	SubscribeToPricesCombined(symbols []Symbol, granularity Granularity) error
+	SubscribeToTickerCombined(symbols []Symbol) error
+	SubscribeToTradesCombined(symbols []Symbol) error
+	Subscriptions() []SubscriptionStatus
+
+	NewOrderSingleMessage(order NewOrderSingleMsg) error
+	CancelOrder(orderID string) error
+	BulkCancel(symbol *Symbol) error
+
+	SetRecorder(recorder FrameRecorder)
+	SetMetrics(registry *metrics.Registry)
+	SetTracerProvider(provider tracing.TracerProvider)
+	Replay(source FrameSource, opts ReplayOptions) error
+
+	WsL2Serve(symbol string, handler WsL2MsgHandler, errHandler ErrHandler) (Subscription, error)
+	WsL2ServeCombined(symbols []string, handler WsL2MsgHandler, errHandler ErrHandler) (Subscription, error)
+	WsL3Serve(symbol string, handler WsL3MsgHandler, errHandler ErrHandler) (Subscription, error)
+	WsTickerServe(symbol string, handler WsTickerMsgHandler, errHandler ErrHandler) (Subscription, error)
+	WsPriceServe(symbol string, granularity Granularity, handler WsPriceMsgHandler, errHandler ErrHandler) (Subscription, error)
+}
+
+var _ Streamer = (*WebSocketClient)(nil)
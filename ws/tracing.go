@@ -0,0 +1,168 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/tracing"
+)
+
+// TracerName is the name of the tracer of the order spans
+const TracerName = "github.com/hmedkouri/go-bcex/ws"
+
+// SetTracerProvider reports to provider a span for the lifecycle of each order
+// placed with NewOrderSingleMessage, from its submission to its terminal
+// state, with events for its acknowledgement, fills and cancellation
+// requests. The updates are matched to the spans by ClOrdID. The spans of the
+// orders with no terminal state are ended after a day, with an expired event,
+// or by Stop, with a stopped event. Nil disables the tracing, the default.
+func (ws *WebSocketClient) SetTracerProvider(provider tracing.TracerProvider) {
+	var tracer tracing.Tracer
+	if provider != nil {
+		tracer = provider.Tracer(TracerName)
+	}
+	ws.orders.setTracer(tracer)
+}
+
+// orderSpan is the span of an order
+type orderSpan struct {
+	span    tracing.Span
+	acked   bool
+	orderID string
+	started time.Time
+}
+
+// orderSpanTTL bounds the life of the spans of the orders whose terminal
+// state is not received, e.g. lost while disconnected
+const orderSpanTTL = 24 * time.Hour
+
+// orderSpans follows the orders placed on the connection
+type orderSpans struct {
+	mu     sync.Mutex
+	tracer tracing.Tracer
+	// spans by client order id, and client order ids by order id once acked
+	spans    map[string]*orderSpan
+	clOrdIDs map[string]string
+	ttl      time.Duration
+	// swept is when the expired spans were last ended
+	swept time.Time
+}
+
+func newOrderSpans() *orderSpans {
+	return &orderSpans{spans: make(map[string]*orderSpan), clOrdIDs: make(map[string]string), ttl: orderSpanTTL}
+}
+
+func (o *orderSpans) setTracer(tracer tracing.Tracer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.tracer = tracer
+}
+
+// submit starts the span of order, ended with err when it could not be sent
+func (o *orderSpans) submit(order NewOrderSingleMsg, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.tracer == nil || order.ClOrdID == "" {
+		return
+	}
+	_, span := o.tracer.Start(context.Background(), "order",
+		tracing.String("bcex.clOrdID", order.ClOrdID),
+		tracing.String("bcex.symbol", string(order.Symbol)),
+		tracing.String("bcex.side", string(order.Side)),
+		tracing.String("bcex.ordType", string(order.OrdType)),
+		tracing.Float64("bcex.orderQty", order.OrderQty),
+		tracing.Float64("bcex.price", order.Price),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.End()
+		return
+	}
+	now := time.Now()
+	o.spans[order.ClOrdID] = &orderSpan{span: span, started: now}
+	if now.Sub(o.swept) >= o.ttl/24 {
+		o.swept = now
+		o.endLocked("expired", func(s *orderSpan) bool { return now.Sub(s.started) >= o.ttl })
+	}
+}
+
+// stop ends the spans of the orders still followed
+func (o *orderSpans) stop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.endLocked("stopped", func(*orderSpan) bool { return true })
+}
+
+// endLocked ends the spans selected by match with the event name
+func (o *orderSpans) endLocked(name string, match func(*orderSpan) bool) {
+	for clOrdID, s := range o.spans {
+		if !match(s) {
+			continue
+		}
+		s.span.AddEvent(name)
+		s.span.End()
+		delete(o.spans, clOrdID)
+		delete(o.clOrdIDs, s.orderID)
+	}
+}
+
+// update records an execution report of an order, ending its span in a
+// terminal state
+func (o *orderSpans) update(u *TradingUpdated) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s, ok := o.spans[u.ClOrdID]
+	if !ok {
+		return
+	}
+	if !s.acked {
+		s.acked = true
+		s.orderID = u.OrderID
+		o.clOrdIDs[u.OrderID] = u.ClOrdID
+		s.span.SetAttributes(tracing.String("bcex.orderID", u.OrderID))
+		s.span.AddEvent("ack", tracing.String("bcex.ordStatus", u.OrdStatus))
+	}
+	if ExecType(u.ExecType) == EXEC_TYPE_PARTIAL_FILL || u.LastShares > 0 {
+		s.span.AddEvent("fill",
+			tracing.Float64("bcex.lastPx", u.LastPx),
+			tracing.Float64("bcex.lastShares", u.LastShares),
+			tracing.Float64("bcex.cumQty", u.CumQty),
+		)
+	}
+	switch OrderStatus(u.OrdStatus) {
+	case ORDER_STATUS_REJECTED:
+		s.span.RecordError(errors.New(u.Text))
+	case ORDER_STATUS_FILLED, ORDER_STATUS_CANCELLED, ORDER_STATUS_EXPIRED:
+	default:
+		return
+	}
+	s.span.SetAttributes(tracing.String("bcex.ordStatus", u.OrdStatus))
+	s.span.End()
+	delete(o.spans, u.ClOrdID)
+	delete(o.clOrdIDs, u.OrderID)
+}
+
+// reject ends the span of an order rejected before being acknowledged
+func (o *orderSpans) reject(r *TradingReject) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s, ok := o.spans[r.ClOrdID]
+	if !ok {
+		return
+	}
+	s.span.SetAttributes(tracing.String("bcex.ordStatus", string(ORDER_STATUS_REJECTED)))
+	s.span.RecordError(errors.New(r.Text))
+	s.span.End()
+	delete(o.spans, r.ClOrdID)
+}
+
+// cancel records the cancellation request of the order orderID
+func (o *orderSpans) cancel(orderID string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if s, ok := o.spans[o.clOrdIDs[orderID]]; ok {
+		s.span.AddEvent("cancel")
+	}
+}
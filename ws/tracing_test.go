@@ -0,0 +1,61 @@
+package ws_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/tracing/tracetest"
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderTracing(t *testing.T) {
+	e := newExchange(t)
+	recorder := tracetest.NewRecorder()
+	client := ws.NewWebSocketClient(ws.Configuration{Host: "ws" + strings.TrimPrefix(e.URL, "http"), Timeout: time.Second})
+	client.SetTracerProvider(recorder)
+	client.Listen(ws.ListenerOptions{})
+	require.NoError(t, client.Start(false))
+	defer client.Stop()
+
+	require.NoError(t, client.NewOrderSingleMessage(ws.NewOrderSingleMsg{ClOrdID: "c1", Symbol: "BTC-USD", Side: "buy", OrderQty: 2, Price: 100}))
+	require.NoError(t, client.NewOrderSingleMessage(ws.NewOrderSingleMsg{ClOrdID: "c2", Symbol: "ETH-USD"}))
+	e.send(0, `{"seqnum":1,"event":"updated","channel":"trading","orderID":"1","clOrdID":"c1","ordStatus":"open","execType":"0"}`)
+	e.send(0, `{"seqnum":2,"event":"rejected","channel":"trading","clOrdID":"c2","text":"insufficient balance"}`)
+	e.send(0, `{"seqnum":3,"event":"updated","channel":"trading","orderID":"1","clOrdID":"c1","ordStatus":"partial","execType":"F","lastPx":100,"lastShares":1,"cumQty":1}`)
+	require.Eventually(t, func() bool { return len(recorder.Spans()[0].Events) == 2 }, time.Second, time.Millisecond)
+	require.NoError(t, client.CancelOrder("1"))
+	e.send(0, `{"seqnum":4,"event":"updated","channel":"trading","orderID":"1","clOrdID":"c1","ordStatus":"cancelled","execType":"4","cumQty":1}`)
+	require.Eventually(t, func() bool { return recorder.Spans()[0].Ended }, time.Second, time.Millisecond)
+
+	spans := recorder.Named("order")
+	require.Len(t, spans, 2)
+	order := spans[0]
+	require.Equal(t, ws.TracerName, order.Tracer)
+	require.Equal(t, "c1", order.Attributes["bcex.clOrdID"])
+	require.Equal(t, "1", order.Attributes["bcex.orderID"])
+	require.Equal(t, 2.0, order.Attributes["bcex.orderQty"])
+	require.Equal(t, "cancelled", order.Attributes["bcex.ordStatus"])
+	require.NoError(t, order.Err)
+	var events []string
+	for _, event := range order.Events {
+		events = append(events, event.Name)
+	}
+	require.Equal(t, []string{"ack", "fill", "cancel"}, events)
+	require.Equal(t, 1.0, order.Events[1].Attributes["bcex.lastShares"])
+
+	rejected := spans[1]
+	require.True(t, rejected.Ended)
+	require.EqualError(t, rejected.Err, "insufficient balance")
+	require.Equal(t, "rejected", rejected.Attributes["bcex.ordStatus"])
+
+	// the spans of the orders with no terminal state are ended by Stop
+	require.NoError(t, client.NewOrderSingleMessage(ws.NewOrderSingleMsg{ClOrdID: "c3", Symbol: "BTC-USD"}))
+	require.False(t, recorder.Named("order")[2].Ended)
+	require.NoError(t, client.Stop())
+	open := recorder.Named("order")[2]
+	require.True(t, open.Ended)
+	require.Equal(t, "stopped", open.Events[0].Name)
+}
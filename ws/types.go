@@ -68,12 +68,16 @@ type HeartbeatMsg struct {
 	Channel   channel   `json:"channel"`
 	SeqNum    int64     `json:"seqNum"`
 	Timestamp time.Time `json:"timestamp"`
+
+	Received time.Time `json:"-"`
 }
 
 type msgCommon struct {
-	Event   eventType `json:"event"`
-	Channel channel   `json:"channel"`
-	SeqNum  int64     `json:"seqNum"`
+	Event       eventType   `json:"event"`
+	Channel     channel     `json:"channel"`
+	SeqNum      int64       `json:"seqNum"`
+	Symbol      Symbol      `json:"symbol"`
+	Granularity Granularity `json:"granularity"`
 }
 
 type SymbolsSnapshot struct {
@@ -104,6 +108,11 @@ type SymbolMsg struct {
 	AuctionSize            float64 `json:"auction_size"`
 	AuctionTime            string  `json:"auction_time"`
 	Imbalance              float64 `json:"imbalance"`
+
+	// Event is "snapshot" for the symbols of the snapshot, "updated" for a
+	// change of a symbol, e.g. of its status
+	Event    string    `json:"event"`
+	Received time.Time `json:"-"`
 }
 
 type Level struct {
@@ -119,6 +128,8 @@ type L3Msg struct {
 	Symbol  string `json:"symbol"`
 	Bids    []Level `json:"bids"`
 	Asks 	[]Level `json:"asks"`
+
+	Received time.Time `json:"-"`
 }
 
 type L2Msg struct {
@@ -128,6 +139,8 @@ type L2Msg struct {
 	Symbol  string `json:"symbol"`
 	Bids    []Level `json:"bids"`
 	Asks 	[]Level `json:"asks"`
+
+	Received time.Time `json:"-"`
 }
 
 type PricesMsg struct {
@@ -136,6 +149,8 @@ type PricesMsg struct {
 	Channel string    `json:"channel"`
 	Symbol  string    `json:"symbol"`
 	Price   []float64 `json:"price"`
+
+	Received time.Time `json:"-"`
 }
 
 type TickerMsg struct {
@@ -146,6 +161,8 @@ type TickerMsg struct {
 	Price24H       float64 `json:"price_24h"`
 	Volume24H      float64 `json:"volume_24h"`
 	LastTradePrice float64 `json:"last_trade_price"`
+
+	Received time.Time `json:"-"`
 }
 
 type TradesMsg struct {
@@ -158,6 +175,8 @@ type TradesMsg struct {
 	Qty       float64   `json:"qty"`
 	Price     float64   `json:"price"`
 	TradeID   string    `json:"trade_id"`
+
+	Received time.Time `json:"-"`
 }
 
 type BalancesSnapshot struct {
@@ -167,6 +186,8 @@ type BalancesSnapshot struct {
 	Balances            []BalanceMsg `json:"balances"`
 	TotalAvailableLocal float64      `json:"total_available_local"`
 	TotalBalanceLocal   float64      `json:"total_balance_local"`
+
+	Received time.Time `json:"-"`
 }
 
 type BalanceMsg struct {
@@ -196,6 +217,8 @@ type TradingSnapshot struct {
 	Event   string  `json:"event"`
 	Channel string  `json:"channel"`
 	Orders  []Order `json:"orders"`
+
+	Received time.Time `json:"-"`
 }
 
 func (t *TradingSnapshot) IsSnapshot() bool { return true }
@@ -249,6 +272,8 @@ type TradingUpdated struct {
 	LastShares   float64   `json:"lastShares"`
 	TradeID      string    `json:"tradeId"`
 	Price        float64   `json:"price"`
+
+	Received time.Time `json:"-"`
 }
 
 func (t *TradingUpdated) IsSnapshot() bool { return false }
@@ -263,6 +288,8 @@ type TradingReject struct {
 	ClOrdID   string `json:"clOrdID"`
 	OrdStatus string `json:"ordStatus"`
 	Action    string `json:"action"`
+
+	Received time.Time `json:"-"`
 }
 
 func (t *TradingReject) IsSnapshot() bool { return false }
@@ -280,6 +307,9 @@ type newOrderSingleRequest struct {
 	OrderQty    float64     `json:"orderQty"`
 	Price       float64     `json:"price"`
 	ExecInst    ExecInst    `json:"execInst"`
+	StopPx      float64     `json:"stopPx,omitempty"`
+	MinQty      float64     `json:"minQty,omitempty"`
+	ExpireDate  int         `json:"expireDate,omitempty"`
 }
 
 type NewOrderSingleMsg struct {
@@ -291,6 +321,9 @@ type NewOrderSingleMsg struct {
 	OrderQty    float64     `json:"orderQty"`
 	Price       float64     `json:"price"`
 	ExecInst    ExecInst    `json:"execInst"`
+	StopPx      float64     `json:"stopPx,omitempty"`
+	MinQty      float64     `json:"minQty,omitempty"`
+	ExpireDate  int         `json:"expireDate,omitempty"`
 }
 
 type cancelOrderRequest struct {
@@ -0,0 +1,186 @@
+package ws
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Health describes the state of the connection of the client
+type Health struct {
+	Connected bool
+	// Stale is set when nothing was received for Configuration.StaleAfter
+	Stale bool
+	// LastMessage is when the last message was received, LastMessageAge how
+	// long ago. Connecting counts as a message.
+	LastMessage    time.Time
+	LastMessageAge time.Duration
+	// HeartbeatSeq is the sequence number of the last heartbeat, received at
+	// LastHeartbeat, see SubscribeHeartbeat
+	HeartbeatSeq  int64
+	LastHeartbeat time.Time
+	// RoundTrip is the round trip of the last ping, zero unless
+	// Configuration.Keepalive is set
+	RoundTrip time.Duration
+	// Reconnects counts the reconnections of the watchdog
+	Reconnects int
+	// SequenceGaps counts the messages missed according to their sequence
+	// numbers
+	SequenceGaps int64
+}
+
+// health records the activity of the connection
+type health struct {
+	mu            sync.Mutex
+	lastMessage   time.Time
+	heartbeatSeq  int64
+	lastHeartbeat time.Time
+	roundTrip     time.Duration
+	reconnects    int
+}
+
+func (h *health) connected() {
+	h.received()
+}
+
+func (h *health) received() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastMessage = time.Now()
+}
+
+func (h *health) heartbeat(seq int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.heartbeatSeq = seq
+	h.lastHeartbeat = time.Now()
+}
+
+func (h *health) pong(roundTrip time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.roundTrip = roundTrip
+}
+
+func (h *health) reconnected() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reconnects++
+}
+
+// Health returns the state of the connection
+func (ws *WebSocketClient) Health() Health {
+	connected := ws.IsConnected()
+	ws.health.mu.Lock()
+	defer ws.health.mu.Unlock()
+	h := Health{
+		Connected:     connected,
+		LastMessage:   ws.health.lastMessage,
+		HeartbeatSeq:  ws.health.heartbeatSeq,
+		LastHeartbeat: ws.health.lastHeartbeat,
+		RoundTrip:     ws.health.roundTrip,
+		Reconnects:    ws.health.reconnects,
+		SequenceGaps:  atomic.LoadInt64(&ws.gaps),
+	}
+	if !h.LastMessage.IsZero() {
+		h.LastMessageAge = time.Since(h.LastMessage)
+		h.Stale = ws.config.StaleAfter > 0 && h.LastMessageAge > ws.config.StaleAfter
+	}
+	return h
+}
+
+// maxReconnectBackoff bounds the delay between the failed reconnections
+const maxReconnectBackoff = time.Minute
+
+// watch reconnects the connection when it is lost or stale, until stop is
+// closed. The failed reconnections are retried with an exponential backoff.
+func (ws *WebSocketClient) watch(stop chan struct{}) {
+	interval := ws.config.StaleAfter / 4
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var (
+		backoff time.Duration
+		retryAt time.Time
+	)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if time.Now().Before(retryAt) {
+			continue
+		}
+		if h := ws.Health(); !h.Connected || h.Stale {
+			log.Printf("Websocket connection lost or stale (last message %s ago), reconnecting", h.LastMessageAge)
+			if err := ws.reconnect(stop); err != nil {
+				if backoff = 2 * backoff; backoff < interval {
+					backoff = interval
+				} else if backoff > maxReconnectBackoff {
+					backoff = maxReconnectBackoff
+				}
+				retryAt = time.Now().Add(backoff)
+				continue
+			}
+			backoff = 0
+		}
+	}
+}
+
+// reconnect replaces the connection and subscribes again to the subscriptions
+// lost with the previous one, reporting the failures to the error handlers. A
+// connection that could not be authenticated is closed, the reconnection
+// failing.
+func (ws *WebSocketClient) reconnect(stop chan struct{}) error {
+	ws.startMu.Lock()
+	select {
+	case <-stop:
+		// stopped meanwhile
+		ws.startMu.Unlock()
+		return nil
+	default:
+	}
+	ws.disconnect()
+	err := ws.connect(ws.authenticate)
+	if err != nil {
+		ws.disconnect()
+	}
+	ws.startMu.Unlock()
+	if err != nil {
+		log.Printf("Websocket reconnect failed: %s", err.Error())
+		ws.sendError(err)
+		return err
+	}
+	ws.health.reconnected()
+	ws.instruments().reconnect()
+	for _, key := range ws.registry.inactive() {
+		if err := ws.resubscribe(key); err != nil {
+			ws.sendError(fmt.Errorf("subscribing again to %s: %w", key, err))
+		}
+	}
+	return nil
+}
+
+func (ws *WebSocketClient) resubscribe(key streamKey) error {
+	switch key.channel {
+	case heartbeatChannel:
+		return ws.SubscribeHeartbeat()
+	case symbolsChannel:
+		return ws.SubscribeToSymbols()
+	case balancesChannel:
+		return ws.SubscribeToBalances()
+	case tradingChannel:
+		return ws.SubscribeToTrading()
+	case tickerChannel:
+		return ws.SubscribeToTicker(key.symbol)
+	case tradesChannel:
+		return ws.SubscribeToTrades(key.symbol)
+	case pricesChannel:
+		return ws.SubscribeToPrices(key.symbol, key.granularity)
+	case l2Channel, l3Channel:
+		return ws.quoteSubscription(key.symbol, key.channel)
+	}
+	return nil
+}
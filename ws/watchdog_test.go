@@ -0,0 +1,131 @@
+package ws_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hmedkouri/go-bcex/ws"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdog(t *testing.T) {
+	e := newExchange(t)
+	client := ws.NewWebSocketClient(ws.Configuration{
+		Host:       "ws" + strings.TrimPrefix(e.URL, "http"),
+		Timeout:    time.Second,
+		Keepalive:  true,
+		StaleAfter: 200 * time.Millisecond,
+	})
+	client.Listen(ws.ListenerOptions{})
+	require.NoError(t, client.Start(false))
+	defer client.Stop()
+	require.NoError(t, client.SubscribeToL2("BTC-USD"))
+
+	e.send(0, `{"seqnum":3,"event":"updated","channel":"heartbeat","seqNum":42,"timestamp":"2022-01-01T00:00:00Z"}`)
+	require.Eventually(t, func() bool { return client.Health().HeartbeatSeq == 42 }, time.Second, time.Millisecond)
+	health := client.Health()
+	require.True(t, health.Connected)
+	require.False(t, health.Stale)
+	require.Less(t, health.LastMessageAge, 200*time.Millisecond)
+	require.Eventually(t, func() bool { return client.Health().RoundTrip > 0 }, time.Second, time.Millisecond)
+
+	// the exchange goes silent: the connection is replaced and the stream subscribed again
+	require.Eventually(t, func() bool {
+		return e.connections() >= 2 && len(e.requestsOf(1)) == 1
+	}, 2*time.Second, time.Millisecond)
+	require.Equal(t, []request{{Action: "subscribe", Channel: "l2", Symbol: "BTC-USD"}}, e.requestsOf(1))
+	require.GreaterOrEqual(t, client.Health().Reconnects, 1)
+
+	// a lost connection is replaced too
+	e.mu.Lock()
+	connections := len(e.conns)
+	e.conns[connections-1].Close()
+	e.mu.Unlock()
+	require.Eventually(t, func() bool { return e.connections() > connections }, time.Second, time.Millisecond)
+
+	// a stopped client is not
+	require.NoError(t, client.Stop())
+	require.False(t, client.Health().Connected)
+	connections = e.connections()
+	time.Sleep(300 * time.Millisecond)
+	require.Equal(t, connections, e.connections(), "stopped client reconnected")
+}
+
+func TestWatchdogAuthentication(t *testing.T) {
+	e := newExchange(t)
+	client := ws.NewWebSocketClient(ws.Configuration{
+		Host:       "ws" + strings.TrimPrefix(e.URL, "http"),
+		Timeout:    time.Second,
+		StaleAfter: 200 * time.Millisecond,
+		ApiKey:     "token",
+	})
+	client.Listen(ws.ListenerOptions{})
+	require.NoError(t, client.Start(true))
+	defer client.Stop()
+	require.True(t, client.IsAuthenticated())
+	require.NoError(t, client.SubscribeToL2("BTC-USD"))
+
+	// the connection is lost, the subscriptions are inactive until it is
+	// replaced by an authenticated one
+	e.mu.Lock()
+	e.rejectAuth = true
+	e.conns[0].Close()
+	e.mu.Unlock()
+	require.Eventually(t, func() bool { return e.connections() >= 3 }, 2*time.Second, time.Millisecond)
+	require.False(t, client.IsAuthenticated())
+	for _, status := range client.Subscriptions() {
+		if status.Channel == "l2" {
+			require.Equal(t, ws.SubscriptionInactive, status.State)
+		}
+	}
+	for i := 1; i < e.connections()-1; i++ {
+		// the unauthenticated connections are closed, nothing is subscribed on them
+		require.Len(t, e.requestsOf(i), 1)
+	}
+
+	e.mu.Lock()
+	e.rejectAuth = false
+	e.mu.Unlock()
+	require.Eventually(t, client.IsAuthenticated, 3*time.Second, time.Millisecond)
+	last := e.connections() - 1
+	require.Eventually(t, func() bool { return len(e.requestsOf(last)) == 2 }, time.Second, time.Millisecond)
+	require.Equal(t, request{Action: "subscribe", Channel: "l2", Symbol: "BTC-USD"}, e.requestsOf(last)[1])
+}
+
+func TestWatchdogResubscribe(t *testing.T) {
+	e := newExchange(t)
+	client := ws.NewWebSocketClient(ws.Configuration{
+		Host:       "ws" + strings.TrimPrefix(e.URL, "http"),
+		Timeout:    time.Second,
+		StaleAfter: 200 * time.Millisecond,
+	})
+	client.Listen(ws.ListenerOptions{})
+	require.NoError(t, client.Start(false))
+	defer client.Stop()
+	require.NoError(t, client.SubscribeToL2("SLOW-USD"))
+
+	// the connection drops again while the stream is subscribed again, before
+	// the exchange confirms it
+	e.mu.Lock()
+	e.conns[0].Close()
+	e.mu.Unlock()
+	require.Eventually(t, func() bool { return e.connections() >= 2 && len(e.requestsOf(1)) == 1 }, 2*time.Second, time.Millisecond)
+	e.mu.Lock()
+	e.conns[1].Close()
+	e.mu.Unlock()
+	require.Eventually(t, func() bool {
+		statuses := client.Subscriptions()
+		return len(statuses) == 1 && statuses[0].State == ws.SubscriptionInactive
+	}, time.Second, time.Millisecond)
+
+	// the next connection restores it
+	require.Eventually(t, func() bool {
+		statuses := client.Subscriptions()
+		return len(statuses) == 1 && statuses[0].State == ws.SubscriptionActive
+	}, 2*time.Second, time.Millisecond)
+	last := e.connections() - 1
+	require.Greater(t, last, 1)
+	require.Equal(t, []request{{Action: "subscribe", Channel: "l2", Symbol: "SLOW-USD"}}, e.requestsOf(last))
+}
@@ -3,9 +3,11 @@ package ws
 import (
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -26,6 +28,18 @@ type Configuration struct {
 	Timeout   time.Duration
 	Keepalive bool
 	IsSecure  bool
+	// Streams configures the buffering of the streams by channel name
+	// ("l2", "l3", "prices", "ticker", "trades", "heartbeat", "symbols",
+	// "balances"). The trading stream is never dropped: its Policy is
+	// ignored and a full Buffer, 1024 messages when zero, blocks the
+	// connection until Trading() is read.
+	Streams map[string]StreamOptions
+	// Pool bounds the connections of the Ws*Serve subscriptions
+	Pool PoolOptions
+	// StaleAfter is how long the connection may receive nothing, heartbeats
+	// included, before the watchdog reconnects it, see Health. Zero disables
+	// the watchdog.
+	StaleAfter time.Duration
 }
 
 const (
@@ -46,10 +60,11 @@ const (
 	eventUnsubscribed eventType = "unsubscribed"
 	eventUpdate       eventType = "updated"
 
-	actionSubscribe actionType = "subscribe"
-	newOrderSingle  actionType = "NewOrderSingle"
-	cancelOrder     actionType = "CancelOrderRequest"
-	bulkCancel      actionType = "BulkCancelOrderRequest"
+	actionSubscribe   actionType = "subscribe"
+	actionUnsubscribe actionType = "unsubscribe"
+	newOrderSingle    actionType = "NewOrderSingle"
+	cancelOrder       actionType = "CancelOrderRequest"
+	bulkCancel        actionType = "BulkCancelOrderRequest"
 
 	heartbeatChannel channel = "heartbeat"
 	symbolsChannel   channel = "symbols"
@@ -121,11 +136,22 @@ var (
 )
 
 type WebSocketClient struct {
-	connMu         *sync.Mutex
-	conn           *websocket.Conn
-	config         Configuration
-	heartbeatTimer *time.Timer
-	quit           chan struct{}
+	connMu        *sync.Mutex
+	conn          *websocket.Conn
+	config        Configuration
+	quit          chan struct{}
+	connected     bool
+	authenticated bool
+
+	// startMu serializes Start, Stop and the reconnections of the watchdog
+	startMu *sync.Mutex
+	// authenticate is the argument of Start, used to reconnect
+	authenticate bool
+	// watchdog is closed by Stop to end the watchdog
+	watchdog chan struct{}
+	health   *health
+	latency  *latencies
+	orders   *orderSpans
 
 	// anonymous channels
 	chTrades  chan TradesMsg
@@ -136,12 +162,34 @@ type WebSocketClient struct {
 	chL3      chan L3Msg
 
 	// authenticated channels
-	chBalances                  chan BalancesSnapshot
-	chTrading                   chan TradingMsg
-	chHeartbeat                 chan HeartbeatMsg
-	subscriptionResponseChannel chan SubscriptionError
-
-	errorsChan chan error
+	chBalances  chan BalancesSnapshot
+	chTrading   chan TradingMsg
+	chHeartbeat chan HeartbeatMsg
+	// registry tracks the subscriptions and their responses
+	registry *registry
+
+	errorsChan    chan error
+	errorsDropped uint64
+
+	// outboxes buffer the streams configured with StreamOptions
+	outboxes map[channel]*outbox
+
+	hooksMu  *sync.RWMutex
+	recorder FrameRecorder
+	metrics  *wsMetrics
+	// lastSeq is the sequence number of the last message, to detect gaps
+	lastSeq int64
+	// gaps counts the messages missed according to the sequence numbers
+	gaps int64
+
+	// hub fans the messages out to the listeners
+	hub *Hub
+	// handlers are called with the messages, see OnL2
+	handlers *Handlers
+	// pool carries the Ws*Serve subscriptions
+	pool *connPool
+	// legacy flags the channels whose accessor was called, see dispatch
+	legacy uint32
 
 	mutex *sync.RWMutex
 }
@@ -151,64 +199,80 @@ var (
 	ErrInvalidRequest    = errors.New("invalid request")
 )
 
-type SubscriptionError struct {
-	SubscriptionName string
-	ErrorString      string
-}
-
 func NewWebSocketClient(configuration Configuration) *WebSocketClient {
-	return &WebSocketClient{
-		config:                      configuration,
-		errorsChan:                  make(chan error, 10),
-		mutex:                       &sync.RWMutex{},
-		connMu:                      &sync.Mutex{},
-		heartbeatTimer:              time.NewTimer(PingFrequency),
-		subscriptionResponseChannel: make(chan SubscriptionError),
-		chHeartbeat:                 make(chan HeartbeatMsg),
-		chSymbols:                   make(chan SymbolMsg),
-		chL3:                        make(chan L3Msg),
-		chL2:                        make(chan L2Msg),
-		chPrices:                    make(chan PricesMsg),
-		chTicker:                    make(chan TickerMsg),
-		chTrades:                    make(chan TradesMsg),
-		chBalances:                  make(chan BalancesSnapshot),
-		chTrading:                   make(chan TradingMsg),
-	}
+	ws := &WebSocketClient{
+		config:      configuration,
+		errorsChan:  make(chan error, 10),
+		mutex:       &sync.RWMutex{},
+		connMu:      &sync.Mutex{},
+		startMu:     &sync.Mutex{},
+		hooksMu:     &sync.RWMutex{},
+		hub:         NewHub(),
+		handlers:    NewHandlers(),
+		health:      &health{},
+		latency:     newLatencies(),
+		orders:      newOrderSpans(),
+		registry:    newRegistry(),
+		chHeartbeat: make(chan HeartbeatMsg),
+		chSymbols:   make(chan SymbolMsg),
+		chL3:        make(chan L3Msg),
+		chL2:        make(chan L2Msg),
+		chPrices:    make(chan PricesMsg),
+		chTicker:    make(chan TickerMsg),
+		chTrades:    make(chan TradesMsg),
+		chBalances:  make(chan BalancesSnapshot),
+		chTrading:   make(chan TradingMsg),
+	}
+	ws.outboxes = ws.newOutboxes(configuration.Streams)
+	// the Ws*Serve streams are public
+	poolConfig := configuration
+	poolConfig.IsSecure = false
+	ws.pool = newConnPool(poolConfig, configuration.Pool)
+	return ws
 }
 
 func (ws *WebSocketClient) Heartbeats() chan HeartbeatMsg {
+	ws.tap(legacyHeartbeat)
 	return ws.chHeartbeat
 }
 
 func (ws *WebSocketClient) Symbols() chan SymbolMsg {
+	ws.tap(legacySymbols)
 	return ws.chSymbols
 }
 
 func (ws *WebSocketClient) L3Quotes() chan L3Msg {
+	ws.tap(legacyL3)
 	return ws.chL3
 }
 
 func (ws *WebSocketClient) L2Quotes() chan L2Msg {
+	ws.tap(legacyL2)
 	return ws.chL2
 }
 
 func (ws *WebSocketClient) Prices() chan PricesMsg {
+	ws.tap(legacyPrices)
 	return ws.chPrices
 }
 
 func (ws *WebSocketClient) Ticker() chan TickerMsg {
+	ws.tap(legacyTicker)
 	return ws.chTicker
 }
 
 func (ws *WebSocketClient) Trades() chan TradesMsg {
+	ws.tap(legacyTrades)
 	return ws.chTrades
 }
 
 func (ws *WebSocketClient) Balances() chan BalancesSnapshot {
+	ws.tap(legacyBalances)
 	return ws.chBalances
 }
 
 func (ws *WebSocketClient) Trading() chan TradingMsg {
+	ws.tap(legacyTrading)
 	return ws.chTrading
 }
 
@@ -238,8 +302,23 @@ type privateConnect struct {
 	Channel string `json:"channel"`
 }
 
+// Start connects, authenticating the connection when asked, and starts the
+// watchdog when Configuration.StaleAfter is set
 func (ws *WebSocketClient) Start(authenticate bool) error {
-	ws.quit = make(chan struct{})
+	ws.startMu.Lock()
+	defer ws.startMu.Unlock()
+	if err := ws.connect(authenticate); err != nil {
+		return err
+	}
+	ws.authenticate = authenticate
+	if ws.config.StaleAfter > 0 && ws.watchdog == nil {
+		ws.watchdog = make(chan struct{})
+		go ws.watch(ws.watchdog)
+	}
+	return nil
+}
+
+func (ws *WebSocketClient) connect(authenticate bool) error {
 	var d = websocket.Dialer{
 		Subprotocols:    []string{"p1", "p2"},
 		ReadBufferSize:  1024,
@@ -253,8 +332,21 @@ func (ws *WebSocketClient) Start(authenticate bool) error {
 		return err
 	}
 	log.Println("Connected")
+	quit := make(chan struct{})
+	ws.connMu.Lock()
 	ws.conn = conn
+	ws.quit = quit
+	ws.connected = true
+	ws.authenticated = false
+	ws.connMu.Unlock()
+	ws.health.connected()
+	atomic.StoreInt64(&ws.lastSeq, 0)
+	if ws.config.Keepalive {
+		keepAlive(conn, ws.config.Timeout, ws.health.pong)
+	}
+	var auth *registryEntry
 	if authenticate {
+		auth, _ = ws.registry.expect(streamKey{channel: authChannel})
 		//WsHeaders.Add("Cookie", cookie[ws.config.Env]+ws.config.ApiKey)
 		connectMsg, _ := json.Marshal(&privateConnect{
 			Channel: "auth",
@@ -263,56 +355,82 @@ func (ws *WebSocketClient) Start(authenticate bool) error {
 		})
 
 		// Send auth message
-		err = ws.conn.WriteMessage(websocket.TextMessage, connectMsg)
+		ws.connMu.Lock()
+		err = conn.WriteMessage(websocket.TextMessage, connectMsg)
+		ws.connMu.Unlock()
 		if err != nil {
+			ws.registry.forget(streamKey{channel: authChannel}, auth, err)
+			ws.disconnect()
 			return err
 		}
 	}
-	go ws.listenForUpdates(ws.quit)
+	go ws.listenForUpdates(conn, quit)
 
 	if authenticate {
-		return ws.expectSubscriptionResponse(authChannel)
+		err = ws.registry.wait(auth, ws.config.Timeout)
+		ws.setAuthenticated(err == nil)
+		return err
 	}
 	return nil
 }
 
+// Stop stops the watchdog, closes the connection and ends the goroutines
+// feeding the streams and the handlers. The messages they did not deliver
+// yet are kept for a later Start. The spans of the orders still followed are
+// ended.
 func (ws *WebSocketClient) Stop() error {
-	if ws.quit != nil {
-		close(ws.quit)
-		ws.quit = nil
-
-		ws.connMu.Lock()
-		defer ws.connMu.Unlock()
+	ws.startMu.Lock()
+	defer ws.startMu.Unlock()
+	if ws.watchdog != nil {
+		close(ws.watchdog)
+		ws.watchdog = nil
+	}
+	err := ws.disconnect()
+	ws.stopOutboxes()
+	ws.orders.stop()
+	return err
+}
 
-		return ws.conn.Close()
+// disconnect closes the connection, leaving the watchdog to reconnect it
+func (ws *WebSocketClient) disconnect() error {
+	ws.connMu.Lock()
+	defer ws.connMu.Unlock()
+	if ws.quit == nil {
+		return nil
 	}
-	return nil
+	close(ws.quit)
+	ws.quit = nil
+	ws.connected = false
+	ws.authenticated = false
+	ws.registry.disconnected()
+	return ws.conn.Close()
 }
 
-func (ws *WebSocketClient) SubscribeToSymbols() error {
-	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
-
-	subscribeRequest := symbolsSubscriptionRequest{
-		Action:  actionSubscribe,
-		Channel: symbolsChannel,
-	}
+// IsConnected reports whether the websocket connection is up
+func (ws *WebSocketClient) IsConnected() bool {
+	ws.connMu.Lock()
+	defer ws.connMu.Unlock()
+	return ws.connected
+}
 
-	subscribeRequestBytes, err := json.Marshal(subscribeRequest)
-	if err != nil {
-		return err
-	}
+// IsAuthenticated reports whether the connection has been authenticated and can be used for trading
+func (ws *WebSocketClient) IsAuthenticated() bool {
+	ws.connMu.Lock()
+	defer ws.connMu.Unlock()
+	return ws.connected && ws.authenticated
+}
 
+func (ws *WebSocketClient) setAuthenticated(authenticated bool) {
 	ws.connMu.Lock()
-	err = ws.conn.WriteMessage(websocket.TextMessage, subscribeRequestBytes)
-	if err != nil {
-		ws.connMu.Unlock()
-		return err
-	}
-	ws.connMu.Unlock()
+	defer ws.connMu.Unlock()
+	ws.authenticated = authenticated
+}
 
-	err = ws.expectSubscriptionResponse(symbolsChannel)
-	return err
+func (ws *WebSocketClient) SubscribeToSymbols() error {
+	return ws.subscribe(streamKey{channel: symbolsChannel}, symbolsSubscriptionRequest{
+		Action:  actionSubscribe,
+		Channel: symbolsChannel,
+	})
 }
 
 func (ws *WebSocketClient) SubscribeToL3(symbol Symbol) error {
@@ -320,191 +438,60 @@ func (ws *WebSocketClient) SubscribeToL3(symbol Symbol) error {
 }
 
 func (ws *WebSocketClient) quoteSubscription(symbol Symbol, level channel) error {
-	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
-
-	subscribeRequest := quoteSubscriptionRequest{
+	return ws.subscribe(streamKey{channel: level, symbol: symbol}, quoteSubscriptionRequest{
 		Action:  actionSubscribe,
 		Channel: level,
 		Symbol:  symbol,
-	}
-
-	subscribeRequestBytes, err := json.Marshal(subscribeRequest)
-	if err != nil {
-		return err
-	}
-
-	ws.connMu.Lock()
-	err = ws.conn.WriteMessage(websocket.TextMessage, subscribeRequestBytes)
-	if err != nil {
-		ws.connMu.Unlock()
-		return err
-	}
-	ws.connMu.Unlock()
-
-	err = ws.expectSubscriptionResponse(level)
-	return err
+	})
 }
 
 func (ws *WebSocketClient) SubscribeToPrices(symbol Symbol, granularity Granularity) error {
-	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
-
-	subscribeRequest := pricesSubscriptionRequest{
+	return ws.subscribe(streamKey{channel: pricesChannel, symbol: symbol, granularity: granularity}, pricesSubscriptionRequest{
 		Action:      actionSubscribe,
 		Channel:     pricesChannel,
 		Symbol:      symbol,
 		Granularity: granularity,
-	}
-
-	subscribeRequestBytes, err := json.Marshal(subscribeRequest)
-	if err != nil {
-		return err
-	}
-
-	ws.connMu.Lock()
-	err = ws.conn.WriteMessage(websocket.TextMessage, subscribeRequestBytes)
-	if err != nil {
-		ws.connMu.Unlock()
-		return err
-	}
-	ws.connMu.Unlock()
-
-	err = ws.expectSubscriptionResponse(pricesChannel)
-	return err
+	})
 }
 
 func (ws *WebSocketClient) SubscribeToBalances() error {
-	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
-
-	subscribeRequest := balancesSubscriptionRequest{
+	return ws.subscribe(streamKey{channel: balancesChannel}, balancesSubscriptionRequest{
 		Action:  actionSubscribe,
 		Channel: balancesChannel,
-	}
-
-	subscribeRequestBytes, err := json.Marshal(subscribeRequest)
-	if err != nil {
-		return err
-	}
-
-	ws.connMu.Lock()
-	err = ws.conn.WriteMessage(websocket.TextMessage, subscribeRequestBytes)
-	if err != nil {
-		ws.connMu.Unlock()
-		return err
-	}
-	ws.connMu.Unlock()
-
-	err = ws.expectSubscriptionResponse(balancesChannel)
-	return err
+	})
 }
 
 func (ws *WebSocketClient) SubscribeToTrading() error {
-	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
-
-	subscribeRequest := tradingSubscriptionRequest{
+	return ws.subscribe(streamKey{channel: tradingChannel}, tradingSubscriptionRequest{
 		Action:  actionSubscribe,
 		Channel: tradingChannel,
-	}
-
-	subscribeRequestBytes, err := json.Marshal(subscribeRequest)
-	if err != nil {
-		return err
-	}
-
-	ws.connMu.Lock()
-	err = ws.conn.WriteMessage(websocket.TextMessage, subscribeRequestBytes)
-	if err != nil {
-		ws.connMu.Unlock()
-		return err
-	}
-	ws.connMu.Unlock()
-
-	err = ws.expectSubscriptionResponse(tradingChannel)
-	return err
+	})
 }
 
 func (ws *WebSocketClient) Authenticate(token string) error {
-	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
-
-	subscribeRequest := authSubscriptionRequest{
+	err := ws.subscribe(streamKey{channel: authChannel}, authSubscriptionRequest{
 		Action:  actionSubscribe,
 		Channel: authChannel,
 		Token:   token,
-	}
-
-	subscribeRequestBytes, err := json.Marshal(subscribeRequest)
-	if err != nil {
-		return err
-	}
-
-	ws.connMu.Lock()
-	err = ws.conn.WriteMessage(websocket.TextMessage, subscribeRequestBytes)
-	if err != nil {
-		ws.connMu.Unlock()
-		return err
-	}
-	ws.connMu.Unlock()
-
-	err = ws.expectSubscriptionResponse(authChannel)
+	})
+	ws.setAuthenticated(err == nil)
 	return err
 }
 
 func (ws *WebSocketClient) SubscribeToTicker(symbol Symbol) error {
-	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
-
-	subscribeRequest := tickerSubscriptionRequest{
+	return ws.subscribe(streamKey{channel: tickerChannel, symbol: symbol}, tickerSubscriptionRequest{
 		Action:  actionSubscribe,
 		Channel: tickerChannel,
 		Symbol:  symbol,
-	}
-
-	subscribeRequestBytes, err := json.Marshal(subscribeRequest)
-	if err != nil {
-		return err
-	}
-
-	ws.connMu.Lock()
-	err = ws.conn.WriteMessage(websocket.TextMessage, subscribeRequestBytes)
-	if err != nil {
-		ws.connMu.Unlock()
-		return err
-	}
-	ws.connMu.Unlock()
-
-	err = ws.expectSubscriptionResponse(tickerChannel)
-	return err
+	})
 }
 
 func (ws *WebSocketClient) SubscribeToTrades(symbol Symbol) error {
-	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
-
-	subscribeRequest := tradesSubscriptionRequest{
+	return ws.subscribe(streamKey{channel: tradesChannel, symbol: symbol}, tradesSubscriptionRequest{
 		Action:  actionSubscribe,
 		Channel: tradesChannel,
 		Symbol:  symbol,
-	}
-
-	subscribeRequestBytes, err := json.Marshal(subscribeRequest)
-	if err != nil {
-		return err
-	}
-
-	ws.connMu.Lock()
-	err = ws.conn.WriteMessage(websocket.TextMessage, subscribeRequestBytes)
-	if err != nil {
-		ws.connMu.Unlock()
-		return err
-	}
-	ws.connMu.Unlock()
-
-	err = ws.expectSubscriptionResponse(tradesChannel)
-	return err
+	})
 }
 
 func (ws *WebSocketClient) SubscribeToL2(symbol Symbol) error {
@@ -512,51 +499,14 @@ func (ws *WebSocketClient) SubscribeToL2(symbol Symbol) error {
 }
 
 func (ws *WebSocketClient) SubscribeHeartbeat() error {
-	ws.mutex.Lock()
-	defer ws.mutex.Unlock()
-
-	subscribeRequest := heartbeatSubscriptionRequest{
+	return ws.subscribe(streamKey{channel: heartbeatChannel}, heartbeatSubscriptionRequest{
 		Action:  actionSubscribe,
 		Channel: heartbeatChannel,
-	}
-
-	subscribeRequestBytes, err := json.Marshal(subscribeRequest)
-	if err != nil {
-		return err
-	}
-
-	ws.connMu.Lock()
-	err = ws.conn.WriteMessage(websocket.TextMessage, subscribeRequestBytes)
-	if err != nil {
-		ws.connMu.Unlock()
-		return err
-	}
-	ws.connMu.Unlock()
-
-	err = ws.expectSubscriptionResponse(heartbeatChannel)
-	return err
+	})
 }
 
 func (ws *WebSocketClient) resetHeartbeat() {
-	ws.heartbeatTimer.Reset(PingFrequency)
-}
-
-func (ws *WebSocketClient) expectSubscriptionResponse(subChannel channel) error {
-	for {
-		select {
-		case subMsg := <-ws.subscriptionResponseChannel:
-			if subMsg.SubscriptionName == subChannel.String() && len(subMsg.ErrorString) == 0 {
-				log.Printf("Successfully subscribed to %s", subMsg.SubscriptionName)
-				return nil
-			} else if subMsg.SubscriptionName == subChannel.String() && len(subMsg.ErrorString) > 0 {
-				log.Printf("Failed to subscribe: %s %s", subChannel.String(), subMsg.ErrorString)
-				return errors.New(subMsg.ErrorString)
-			}
-		case <-time.After(ws.config.Timeout):
-			log.Printf("timed out waiting for subscription response (channel: %s)", subChannel.String())
-			return errors.New("timed out waiting for subscription response")
-		}
-	}
+	ws.health.received()
 }
 
 func (ws *WebSocketClient) NewOrderSingleMessage(order NewOrderSingleMsg) error {
@@ -574,6 +524,9 @@ func (ws *WebSocketClient) NewOrderSingleMessage(order NewOrderSingleMsg) error
 		OrderQty:    order.OrderQty,
 		Price:       order.Price,
 		ExecInst:    order.ExecInst,
+		StopPx:      order.StopPx,
+		MinQty:      order.MinQty,
+		ExpireDate:  order.ExpireDate,
 	}
 
 	newOrderSingleRequestBytes, err := json.Marshal(newOrderSingleMsgRequest)
@@ -582,12 +535,15 @@ func (ws *WebSocketClient) NewOrderSingleMessage(order NewOrderSingleMsg) error
 	}
 
 	ws.connMu.Lock()
+	ws.latency.submit(order.ClOrdID, time.Now())
 	err = ws.conn.WriteMessage(websocket.TextMessage, newOrderSingleRequestBytes)
+	ws.orders.submit(order, err)
 	if err != nil {
 		ws.connMu.Unlock()
 		return err
 	}
 	ws.connMu.Unlock()
+	ws.instruments().order("submit")
 	return nil
 }
 
@@ -613,6 +569,7 @@ func (ws *WebSocketClient) CancelOrder(orderID string) error {
 		return err
 	}
 	ws.connMu.Unlock()
+	ws.orders.cancel(orderID)
 	return nil
 }
 
@@ -644,14 +601,14 @@ func (ws *WebSocketClient) BulkCancel(symbol *Symbol) error {
 	return nil
 }
 
-func (ws *WebSocketClient) listenForUpdates(quitCh chan struct{}) {
+func (ws *WebSocketClient) listenForUpdates(conn *websocket.Conn, quitCh chan struct{}) {
 	defer log.Println("listenForUpdates closed.")
 	for {
 		select {
 		case <-quitCh:
 			return
 		default:
-			_, msg, err := ws.conn.ReadMessage()
+			_, msg, err := conn.ReadMessage()
 			if err != nil {
 				select {
 				case <-quitCh:
@@ -659,143 +616,213 @@ func (ws *WebSocketClient) listenForUpdates(quitCh chan struct{}) {
 				default:
 				}
 				log.Printf("Websocket read error: %s", err.Error())
-				ws.Stop()
-				ws.errorsChan <- err
+				ws.disconnect()
+				ws.sendError(err)
 				return
-			} else {
-				msgString := string(msg)
-				if msgString == "ping" {
-					log.Println("Received ping.")
-					ws.resetHeartbeat()
-				} else {
-					var commonMsg msgCommon
-					if err := json.Unmarshal(msg, &commonMsg); err != nil {
-						log.Printf("Error un-marshalling common message: %s", err.Error())
-						continue
-					}
-					switch commonMsg.Event {
-					case eventSubscribed:
-						ws.subscriptionResponseChannel <- SubscriptionError{
-							SubscriptionName: commonMsg.Channel.String(),
-						}
-					case eventRejected:
-						switch commonMsg.Channel {
-						case tradingChannel:
-							var rejectMsg TradingReject
-							if err := json.Unmarshal(msg, &rejectMsg); err != nil {
-								log.Printf("Error un-marshalling trading reject message: %s", err.Error())
-								continue
-							}
-							ws.chTrading <- &rejectMsg
-						default:
-							var rejectMsg RejectMsg
-							if err := json.Unmarshal(msg, &rejectMsg); err != nil {
-								log.Printf("Error un-marshalling reject message: %s", err.Error())
-								continue
-							}
-							ws.subscriptionResponseChannel <- SubscriptionError{
-								SubscriptionName: commonMsg.Channel.String(),
-								ErrorString:      rejectMsg.Text,
-							}
-						}
-					case eventUpdate:
-						switch commonMsg.Channel {
-						case heartbeatChannel:
-							var heartbeatMsg HeartbeatMsg
-							if err := json.Unmarshal(msg, &heartbeatMsg); err != nil {
-								log.Printf("Error un-marshalling heartbeat message: %s", err.Error())
-								continue
-							}
-							ws.chHeartbeat <- heartbeatMsg
-						case l3Channel:
-							var l3Msg L3Msg
-							if err := json.Unmarshal(msg, &l3Msg); err != nil {
-								log.Printf("Error un-marshalling l3 update message: %s", err.Error())
-								continue
-							}
-							ws.chL3 <- l3Msg
-						case l2Channel:
-							var l2Msg L2Msg
-							if err := json.Unmarshal(msg, &l2Msg); err != nil {
-								log.Printf("Error un-marshalling l2 update message: %s", err.Error())
-								continue
-							}
-							ws.chL2 <- l2Msg
-						case pricesChannel:
-							var priceMsg PricesMsg
-							if err := json.Unmarshal(msg, &priceMsg); err != nil {
-								log.Printf("Error un-marshalling prices update message: %s", err.Error())
-								continue
-							}
-							ws.chPrices <- priceMsg
-						case tradesChannel:
-							var tradesMsg TradesMsg
-							if err := json.Unmarshal(msg, &tradesMsg); err != nil {
-								log.Printf("Error un-marshalling trades update message: %s", err.Error())
-								continue
-							}
-							ws.chTrades <- tradesMsg
-						case tradingChannel:
-							var tradingUpdate TradingUpdated
-							if err := json.Unmarshal(msg, &tradingUpdate); err != nil {
-								log.Printf("Error un-marshalling trading update message: %s", err.Error())
-								continue
-							}
-							ws.chTrading <- &tradingUpdate
-						}
-					case eventSnapshot:
-						switch commonMsg.Channel {
-						case symbolsChannel:
-							var symbolMsg SymbolsSnapshot
-							if err := json.Unmarshal(msg, &symbolMsg); err != nil {
-								log.Printf("Error un-marshalling symbols snapshot message: %s", err.Error())
-								continue
-							}
-							for name, symbolData := range symbolMsg.Symbols {
-								symbolData.Name = name
-								ws.chSymbols <- symbolData
-							}
-						case l3Channel:
-							var l3Msg L3Msg
-							if err := json.Unmarshal(msg, &l3Msg); err != nil {
-								log.Printf("Error un-marshalling l3 snapshot message: %s", err.Error())
-								continue
-							}
-							ws.chL3 <- l3Msg
-						case l2Channel:
-							var l2Msg L2Msg
-							if err := json.Unmarshal(msg, &l2Msg); err != nil {
-								log.Printf("Error un-marshalling l2 snapshot message: %s", err.Error())
-								continue
-							}
-							ws.chL2 <- l2Msg
-						case tickerChannel:
-							var tickerMsg TickerMsg
-							if err := json.Unmarshal(msg, &tickerMsg); err != nil {
-								log.Printf("Error un-marshalling ticker snapshot message: %s", err.Error())
-								continue
-							}
-							ws.chTicker <- tickerMsg
-						case balancesChannel:
-							var balanceMsg BalancesSnapshot
-							if err := json.Unmarshal(msg, &balanceMsg); err != nil {
-								log.Printf("Error un-marshalling balances snapshot message: %s", err.Error())
-								continue
-							}
-							ws.chBalances <- balanceMsg
-						case tradingChannel:
-							var tradingSnapShot TradingSnapshot
-							if err := json.Unmarshal(msg, &tradingSnapShot); err != nil {
-								log.Printf("Error un-marshalling trading snapshot message: %s", err.Error())
-								continue
-							}
-							ws.chTrading <- &tradingSnapShot
-						}
-					}
-				}
-				//log.Printf("Received message: %s", msg)
-				ws.resetHeartbeat()
 			}
+			received := time.Now()
+			ws.recordFrame(msg, received)
+			ws.handleMessage(msg, received)
+		}
+	}
+}
+
+// handleMessage decodes a raw message received on the connection at received,
+// stamping the messages with it, and dispatches it to the matching channel
+func (ws *WebSocketClient) handleMessage(msg []byte, received time.Time) {
+	if string(msg) == "ping" {
+		log.Println("Received ping.")
+		ws.resetHeartbeat()
+		return
+	}
+	m := ws.instruments()
+	var commonMsg msgCommon
+	if err := json.Unmarshal(msg, &commonMsg); err != nil {
+		log.Printf("Error un-marshalling common message: %s", err.Error())
+		m.decodeError("")
+		return
+	}
+	m.message(commonMsg.Channel, commonMsg.Event)
+	if seq := commonMsg.SeqNum; seq > 0 {
+		if last := atomic.SwapInt64(&ws.lastSeq, seq); last > 0 && seq > last+1 {
+			atomic.AddInt64(&ws.gaps, seq-last-1)
+			m.gap(seq - last - 1)
+		}
+	}
+	switch commonMsg.Event {
+	case eventSubscribed, eventUnsubscribed:
+		ws.registry.resolve(commonMsg, "")
+	}
+	decoded, err := decodeMessage(commonMsg, msg, received)
+	if err != nil {
+		log.Printf("Error un-marshalling %s", err.Error())
+		m.decodeError(commonMsg.Channel)
+		return
+	}
+	for _, message := range decoded {
+		switch message := message.(type) {
+		case *RejectMsg:
+			ws.registry.resolve(commonMsg, message.Text)
+			continue
+		case *TradingReject:
+			m.order("reject")
+			ws.latency.ack(message.ClOrdID, received)
+			ws.orders.reject(message)
+		case HeartbeatMsg:
+			ws.health.heartbeat(message.SeqNum)
+			ws.latency.exchange(heartbeatChannel, message.Timestamp, received)
+		case TradesMsg:
+			ws.latency.exchange(tradesChannel, message.Timestamp, received)
+		case *TradingUpdated:
+			ws.latency.exchange(tradingChannel, message.TransactTime, received)
+			ws.latency.ack(message.ClOrdID, received)
+			if OrderStatus(message.OrdStatus) == ORDER_STATUS_REJECTED {
+				m.order("reject")
+			}
+			ws.orders.update(message)
+		}
+		ws.dispatch(message)
+	}
+	//log.Printf("Received message: %s", msg)
+	ws.resetHeartbeat()
+}
+
+// decodeMessage decodes the raw message msg, whose common fields are
+// commonMsg, into the messages it carries, stamped with received, as they are
+// dispatched. A rejected subscription decodes to a *RejectMsg, which is not
+// dispatched, and the other subscription responses to nothing.
+func decodeMessage(commonMsg msgCommon, msg []byte, received time.Time) ([]interface{}, error) {
+	switch commonMsg.Event {
+	case eventRejected:
+		switch commonMsg.Channel {
+		case tradingChannel:
+			var rejectMsg TradingReject
+			if err := json.Unmarshal(msg, &rejectMsg); err != nil {
+				return nil, fmt.Errorf("trading reject message: %w", err)
+			}
+			rejectMsg.Received = received
+			return []interface{}{&rejectMsg}, nil
+		default:
+			var rejectMsg RejectMsg
+			if err := json.Unmarshal(msg, &rejectMsg); err != nil {
+				return nil, fmt.Errorf("reject message: %w", err)
+			}
+			return []interface{}{&rejectMsg}, nil
+		}
+	case eventUpdate:
+		switch commonMsg.Channel {
+		case heartbeatChannel:
+			var heartbeatMsg HeartbeatMsg
+			if err := json.Unmarshal(msg, &heartbeatMsg); err != nil {
+				return nil, fmt.Errorf("heartbeat message: %w", err)
+			}
+			heartbeatMsg.Received = received
+			return []interface{}{heartbeatMsg}, nil
+		case symbolsChannel:
+			var symbolMsg SymbolMsg
+			if err := json.Unmarshal(msg, &symbolMsg); err != nil {
+				return nil, fmt.Errorf("symbols update message: %w", err)
+			}
+			// the updates name the symbol like the other channels
+			if symbolMsg.Name == "" {
+				symbolMsg.Name = commonMsg.Symbol
+			}
+			symbolMsg.Received = received
+			return []interface{}{symbolMsg}, nil
+		case l3Channel:
+			var l3Msg L3Msg
+			if err := json.Unmarshal(msg, &l3Msg); err != nil {
+				return nil, fmt.Errorf("l3 update message: %w", err)
+			}
+			l3Msg.Received = received
+			return []interface{}{l3Msg}, nil
+		case l2Channel:
+			var l2Msg L2Msg
+			if err := json.Unmarshal(msg, &l2Msg); err != nil {
+				return nil, fmt.Errorf("l2 update message: %w", err)
+			}
+			l2Msg.Received = received
+			return []interface{}{l2Msg}, nil
+		case pricesChannel:
+			var priceMsg PricesMsg
+			if err := json.Unmarshal(msg, &priceMsg); err != nil {
+				return nil, fmt.Errorf("prices update message: %w", err)
+			}
+			priceMsg.Received = received
+			return []interface{}{priceMsg}, nil
+		case tradesChannel:
+			var tradesMsg TradesMsg
+			if err := json.Unmarshal(msg, &tradesMsg); err != nil {
+				return nil, fmt.Errorf("trades update message: %w", err)
+			}
+			tradesMsg.Received = received
+			return []interface{}{tradesMsg}, nil
+		case tickerChannel:
+			var tickerMsg TickerMsg
+			if err := json.Unmarshal(msg, &tickerMsg); err != nil {
+				return nil, fmt.Errorf("ticker update message: %w", err)
+			}
+			tickerMsg.Received = received
+			return []interface{}{tickerMsg}, nil
+		case tradingChannel:
+			var tradingUpdate TradingUpdated
+			if err := json.Unmarshal(msg, &tradingUpdate); err != nil {
+				return nil, fmt.Errorf("trading update message: %w", err)
+			}
+			tradingUpdate.Received = received
+			return []interface{}{&tradingUpdate}, nil
+		}
+	case eventSnapshot:
+		switch commonMsg.Channel {
+		case symbolsChannel:
+			var symbolMsg SymbolsSnapshot
+			if err := json.Unmarshal(msg, &symbolMsg); err != nil {
+				return nil, fmt.Errorf("symbols snapshot message: %w", err)
+			}
+			var symbols []interface{}
+			for name, symbolData := range symbolMsg.Symbols {
+				symbolData.Name = name
+				symbolData.Event = eventSnapshot.String()
+				symbolData.Received = received
+				symbols = append(symbols, symbolData)
+			}
+			return symbols, nil
+		case l3Channel:
+			var l3Msg L3Msg
+			if err := json.Unmarshal(msg, &l3Msg); err != nil {
+				return nil, fmt.Errorf("l3 snapshot message: %w", err)
+			}
+			l3Msg.Received = received
+			return []interface{}{l3Msg}, nil
+		case l2Channel:
+			var l2Msg L2Msg
+			if err := json.Unmarshal(msg, &l2Msg); err != nil {
+				return nil, fmt.Errorf("l2 snapshot message: %w", err)
+			}
+			l2Msg.Received = received
+			return []interface{}{l2Msg}, nil
+		case tickerChannel:
+			var tickerMsg TickerMsg
+			if err := json.Unmarshal(msg, &tickerMsg); err != nil {
+				return nil, fmt.Errorf("ticker snapshot message: %w", err)
+			}
+			tickerMsg.Received = received
+			return []interface{}{tickerMsg}, nil
+		case balancesChannel:
+			var balanceMsg BalancesSnapshot
+			if err := json.Unmarshal(msg, &balanceMsg); err != nil {
+				return nil, fmt.Errorf("balances snapshot message: %w", err)
+			}
+			balanceMsg.Received = received
+			return []interface{}{balanceMsg}, nil
+		case tradingChannel:
+			var tradingSnapShot TradingSnapshot
+			if err := json.Unmarshal(msg, &tradingSnapShot); err != nil {
+				return nil, fmt.Errorf("trading snapshot message: %w", err)
+			}
+			tradingSnapShot.Received = received
+			return []interface{}{&tradingSnapShot}, nil
 		}
 	}
+	return nil, nil
 }
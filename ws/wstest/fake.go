@@ -0,0 +1,494 @@
+// Package wstest provides an in-memory implementation of ws.Streamer for use in tests.
+package wstest
+
+import (
+	"sync"
+
+	"github.com/hmedkouri/go-bcex/metrics"
+	"github.com/hmedkouri/go-bcex/tracing"
+	"github.com/hmedkouri/go-bcex/ws"
+)
+
+// Call records a single invocation of a fake method
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Recorder keeps the calls made on a fake
+type Recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (r *Recorder) record(method string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{method, args})
+}
+
+// Calls returns the calls made so far, in order
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := make([]Call, len(r.calls))
+	copy(calls, r.calls)
+	return calls
+}
+
+// CallsTo returns the calls made so far to method, in order
+func (r *Recorder) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range r.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the calls made so far
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// FakeStreamer is a ws.Streamer recording every call. Messages are injected by
+// writing to the channels returned by the accessors (L2Quotes(), Trading()...),
+// which are buffered with the size given to NewFakeStreamer, or to the
+// listeners and handlers with Publish. The methods returning an error return
+// the result of the matching Func field when set, and nil, with a running
+// FakeSubscription for the Ws*Serve methods, otherwise. The settings are only
+// recorded.
+type FakeStreamer struct {
+	Recorder
+
+	StartFunc                     func(authenticate bool) error
+	StopFunc                      func() error
+	AuthenticateFunc              func(token string) error
+	SubscribeHeartbeatFunc        func() error
+	SubscribeToSymbolsFunc        func() error
+	SubscribeToL3Func             func(symbol ws.Symbol) error
+	SubscribeToL2Func             func(symbol ws.Symbol) error
+	SubscribeToPricesFunc         func(symbol ws.Symbol, granularity ws.Granularity) error
+	SubscribeToTickerFunc         func(symbol ws.Symbol) error
+	SubscribeToTradesFunc         func(symbol ws.Symbol) error
+	SubscribeToBalancesFunc       func() error
+	SubscribeToTradingFunc        func() error
+	SubscribeToL2CombinedFunc     func(symbols []ws.Symbol) error
+	SubscribeToL3CombinedFunc     func(symbols []ws.Symbol) error
+	SubscribeToPricesCombinedFunc func(symbols []ws.Symbol, granularity ws.Granularity) error
+	SubscribeToTickerCombinedFunc func(symbols []ws.Symbol) error
+	SubscribeToTradesCombinedFunc func(symbols []ws.Symbol) error
+	NewOrderSingleMessageFunc     func(order ws.NewOrderSingleMsg) error
+	CancelOrderFunc               func(orderID string) error
+	BulkCancelFunc                func(symbol *ws.Symbol) error
+	ReplayFunc                    func(source ws.FrameSource, opts ws.ReplayOptions) error
+	WsL2ServeFunc                 func(symbol string, handler ws.WsL2MsgHandler, errHandler ws.ErrHandler) (ws.Subscription, error)
+	WsL2ServeCombinedFunc         func(symbols []string, handler ws.WsL2MsgHandler, errHandler ws.ErrHandler) (ws.Subscription, error)
+	WsL3ServeFunc                 func(symbol string, handler ws.WsL3MsgHandler, errHandler ws.ErrHandler) (ws.Subscription, error)
+	WsTickerServeFunc             func(symbol string, handler ws.WsTickerMsgHandler, errHandler ws.ErrHandler) (ws.Subscription, error)
+	WsPriceServeFunc              func(symbol string, granularity ws.Granularity, handler ws.WsPriceMsgHandler, errHandler ws.ErrHandler) (ws.Subscription, error)
+
+	mu            sync.Mutex
+	connected     bool
+	authenticated bool
+
+	chHeartbeat chan ws.HeartbeatMsg
+	chSymbols   chan ws.SymbolMsg
+	chL3        chan ws.L3Msg
+	chL2        chan ws.L2Msg
+	chPrices    chan ws.PricesMsg
+	chTicker    chan ws.TickerMsg
+	chTrades    chan ws.TradesMsg
+	chBalances  chan ws.BalancesSnapshot
+	chTrading   chan ws.TradingMsg
+	chErrors    chan error
+	hub         *ws.Hub
+	handlers    *ws.Handlers
+	statuses    []ws.SubscriptionStatus
+	health      ws.Health
+}
+
+var _ ws.Streamer = (*FakeStreamer)(nil)
+
+// NewFakeStreamer returns a FakeStreamer whose channels hold up to buffer messages
+func NewFakeStreamer(buffer int) *FakeStreamer {
+	return &FakeStreamer{
+		chHeartbeat: make(chan ws.HeartbeatMsg, buffer),
+		chSymbols:   make(chan ws.SymbolMsg, buffer),
+		chL3:        make(chan ws.L3Msg, buffer),
+		chL2:        make(chan ws.L2Msg, buffer),
+		chPrices:    make(chan ws.PricesMsg, buffer),
+		chTicker:    make(chan ws.TickerMsg, buffer),
+		chTrades:    make(chan ws.TradesMsg, buffer),
+		chBalances:  make(chan ws.BalancesSnapshot, buffer),
+		chTrading:   make(chan ws.TradingMsg, buffer),
+		chErrors:    make(chan error, buffer),
+		hub:         ws.NewHub(),
+		handlers:    ws.NewHandlers(),
+	}
+}
+
+// SetConnected sets the state reported by IsConnected and IsAuthenticated
+func (f *FakeStreamer) SetConnected(connected, authenticated bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = connected
+	f.authenticated = authenticated
+}
+
+func (f *FakeStreamer) Start(authenticate bool) error {
+	f.record("Start", authenticate)
+	var err error
+	if f.StartFunc != nil {
+		err = f.StartFunc(authenticate)
+	}
+	if err == nil {
+		f.SetConnected(true, authenticate)
+	}
+	return err
+}
+
+func (f *FakeStreamer) Stop() error {
+	f.record("Stop")
+	f.SetConnected(false, false)
+	if f.StopFunc != nil {
+		return f.StopFunc()
+	}
+	return nil
+}
+
+func (f *FakeStreamer) IsConnected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected
+}
+
+func (f *FakeStreamer) IsAuthenticated() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected && f.authenticated
+}
+
+// SetHealth sets the state returned by Health, Connected aside
+func (f *FakeStreamer) SetHealth(health ws.Health) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.health = health
+}
+
+func (f *FakeStreamer) Health() ws.Health {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	health := f.health
+	health.Connected = f.connected
+	return health
+}
+
+func (f *FakeStreamer) Authenticate(token string) error {
+	f.record("Authenticate", token)
+	var err error
+	if f.AuthenticateFunc != nil {
+		err = f.AuthenticateFunc(token)
+	}
+	if err == nil {
+		f.mu.Lock()
+		f.authenticated = true
+		f.mu.Unlock()
+	}
+	return err
+}
+
+func (f *FakeStreamer) Heartbeats() chan ws.HeartbeatMsg   { return f.chHeartbeat }
+func (f *FakeStreamer) Symbols() chan ws.SymbolMsg         { return f.chSymbols }
+func (f *FakeStreamer) L3Quotes() chan ws.L3Msg            { return f.chL3 }
+func (f *FakeStreamer) L2Quotes() chan ws.L2Msg            { return f.chL2 }
+func (f *FakeStreamer) Prices() chan ws.PricesMsg          { return f.chPrices }
+func (f *FakeStreamer) Ticker() chan ws.TickerMsg          { return f.chTicker }
+func (f *FakeStreamer) Trades() chan ws.TradesMsg          { return f.chTrades }
+func (f *FakeStreamer) Balances() chan ws.BalancesSnapshot { return f.chBalances }
+func (f *FakeStreamer) Trading() chan ws.TradingMsg        { return f.chTrading }
+func (f *FakeStreamer) Errors() chan error                 { return f.chErrors }
+
+func (f *FakeStreamer) Listen(opts ws.ListenerOptions) *ws.Listener {
+	return f.hub.Listen(opts)
+}
+
+// Latencies returns no latency, the fake measures none
+func (f *FakeStreamer) Latencies() map[string]ws.LatencyStats {
+	return map[string]ws.LatencyStats{}
+}
+
+// Dropped returns no drops, the channels of the fake are read directly
+func (f *FakeStreamer) Dropped() map[string]uint64 {
+	return map[string]uint64{}
+}
+
+// Publish delivers msg to the listeners returned by Listen and to the
+// registered handlers. An error is delivered to the error handlers.
+func (f *FakeStreamer) Publish(msg interface{}) {
+	f.hub.Publish(msg)
+	f.handlers.Dispatch(msg)
+}
+
+func (f *FakeStreamer) OnL2(handler ws.WsL2MsgHandler)         { f.handlers.OnL2(handler) }
+func (f *FakeStreamer) OnL3(handler ws.WsL3MsgHandler)         { f.handlers.OnL3(handler) }
+func (f *FakeStreamer) OnTicker(handler ws.WsTickerMsgHandler) { f.handlers.OnTicker(handler) }
+func (f *FakeStreamer) OnPrices(handler ws.WsPriceMsgHandler)  { f.handlers.OnPrices(handler) }
+func (f *FakeStreamer) OnTrade(handler ws.WsTradesMsgHandler)  { f.handlers.OnTrade(handler) }
+func (f *FakeStreamer) OnExecutionReport(handler ws.WsTradingMsgHandler) {
+	f.handlers.OnExecutionReport(handler)
+}
+func (f *FakeStreamer) OnBalances(handler ws.WsBalancesMsgHandler)   { f.handlers.OnBalances(handler) }
+func (f *FakeStreamer) OnHeartbeat(handler ws.WsHeartbeatMsgHandler) { f.handlers.OnHeartbeat(handler) }
+func (f *FakeStreamer) OnError(handler ws.ErrHandler)                { f.handlers.OnError(handler) }
+
+func (f *FakeStreamer) SubscribeHeartbeat() error {
+	f.record("SubscribeHeartbeat")
+	if f.SubscribeHeartbeatFunc != nil {
+		return f.SubscribeHeartbeatFunc()
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToSymbols() error {
+	f.record("SubscribeToSymbols")
+	if f.SubscribeToSymbolsFunc != nil {
+		return f.SubscribeToSymbolsFunc()
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToL3(symbol ws.Symbol) error {
+	f.record("SubscribeToL3", symbol)
+	if f.SubscribeToL3Func != nil {
+		return f.SubscribeToL3Func(symbol)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToL2(symbol ws.Symbol) error {
+	f.record("SubscribeToL2", symbol)
+	if f.SubscribeToL2Func != nil {
+		return f.SubscribeToL2Func(symbol)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToPrices(symbol ws.Symbol, granularity ws.Granularity) error {
+	f.record("SubscribeToPrices", symbol, granularity)
+	if f.SubscribeToPricesFunc != nil {
+		return f.SubscribeToPricesFunc(symbol, granularity)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToTicker(symbol ws.Symbol) error {
+	f.record("SubscribeToTicker", symbol)
+	if f.SubscribeToTickerFunc != nil {
+		return f.SubscribeToTickerFunc(symbol)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToTrades(symbol ws.Symbol) error {
+	f.record("SubscribeToTrades", symbol)
+	if f.SubscribeToTradesFunc != nil {
+		return f.SubscribeToTradesFunc(symbol)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToBalances() error {
+	f.record("SubscribeToBalances")
+	if f.SubscribeToBalancesFunc != nil {
+		return f.SubscribeToBalancesFunc()
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToTrading() error {
+	f.record("SubscribeToTrading")
+	if f.SubscribeToTradingFunc != nil {
+		return f.SubscribeToTradingFunc()
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToL2Combined(symbols []ws.Symbol) error {
+	f.record("SubscribeToL2Combined", symbols)
+	if f.SubscribeToL2CombinedFunc != nil {
+		return f.SubscribeToL2CombinedFunc(symbols)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToL3Combined(symbols []ws.Symbol) error {
+	f.record("SubscribeToL3Combined", symbols)
+	if f.SubscribeToL3CombinedFunc != nil {
+		return f.SubscribeToL3CombinedFunc(symbols)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToPricesCombined(symbols []ws.Symbol, granularity ws.Granularity) error {
+	f.record("SubscribeToPricesCombined", symbols, granularity)
+	if f.SubscribeToPricesCombinedFunc != nil {
+		return f.SubscribeToPricesCombinedFunc(symbols, granularity)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToTickerCombined(symbols []ws.Symbol) error {
+	f.record("SubscribeToTickerCombined", symbols)
+	if f.SubscribeToTickerCombinedFunc != nil {
+		return f.SubscribeToTickerCombinedFunc(symbols)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SubscribeToTradesCombined(symbols []ws.Symbol) error {
+	f.record("SubscribeToTradesCombined", symbols)
+	if f.SubscribeToTradesCombinedFunc != nil {
+		return f.SubscribeToTradesCombinedFunc(symbols)
+	}
+	return nil
+}
+
+// SetSubscriptions sets the statuses returned by Subscriptions
+func (f *FakeStreamer) SetSubscriptions(statuses []ws.SubscriptionStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses = statuses
+}
+
+func (f *FakeStreamer) Subscriptions() []ws.SubscriptionStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ws.SubscriptionStatus(nil), f.statuses...)
+}
+
+func (f *FakeStreamer) NewOrderSingleMessage(order ws.NewOrderSingleMsg) error {
+	f.record("NewOrderSingleMessage", order)
+	if f.NewOrderSingleMessageFunc != nil {
+		return f.NewOrderSingleMessageFunc(order)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) CancelOrder(orderID string) error {
+	f.record("CancelOrder", orderID)
+	if f.CancelOrderFunc != nil {
+		return f.CancelOrderFunc(orderID)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) BulkCancel(symbol *ws.Symbol) error {
+	f.record("BulkCancel", symbol)
+	if f.BulkCancelFunc != nil {
+		return f.BulkCancelFunc(symbol)
+	}
+	return nil
+}
+
+func (f *FakeStreamer) SetRecorder(recorder ws.FrameRecorder) {
+	f.record("SetRecorder", recorder)
+}
+
+func (f *FakeStreamer) SetMetrics(registry *metrics.Registry) {
+	f.record("SetMetrics", registry)
+}
+
+func (f *FakeStreamer) SetTracerProvider(provider tracing.TracerProvider) {
+	f.record("SetTracerProvider", provider)
+}
+
+func (f *FakeStreamer) Replay(source ws.FrameSource, opts ws.ReplayOptions) error {
+	f.record("Replay", source, opts)
+	if f.ReplayFunc != nil {
+		return f.ReplayFunc(source, opts)
+	}
+	return nil
+}
+
+// FakeSubscription is the subscription returned by the Ws*Serve methods of
+// FakeStreamer. End simulates the loss of the stream.
+type FakeSubscription struct {
+	done chan struct{}
+	once sync.Once
+	mu   sync.Mutex
+	err  error
+}
+
+func (s *FakeSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *FakeSubscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *FakeSubscription) Close() error {
+	s.End(nil)
+	return nil
+}
+
+// End ends the subscription with err
+func (s *FakeSubscription) End(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(s.done)
+	})
+}
+
+// NewFakeSubscription returns a subscription running until End or Close is called
+func NewFakeSubscription() *FakeSubscription {
+	return &FakeSubscription{done: make(chan struct{})}
+}
+
+func (f *FakeStreamer) WsL2Serve(symbol string, handler ws.WsL2MsgHandler, errHandler ws.ErrHandler) (ws.Subscription, error) {
+	f.record("WsL2Serve", symbol, handler, errHandler)
+	if f.WsL2ServeFunc != nil {
+		return f.WsL2ServeFunc(symbol, handler, errHandler)
+	}
+	return NewFakeSubscription(), nil
+}
+
+func (f *FakeStreamer) WsL2ServeCombined(symbols []string, handler ws.WsL2MsgHandler, errHandler ws.ErrHandler) (ws.Subscription, error) {
+	f.record("WsL2ServeCombined", symbols, handler, errHandler)
+	if f.WsL2ServeCombinedFunc != nil {
+		return f.WsL2ServeCombinedFunc(symbols, handler, errHandler)
+	}
+	return NewFakeSubscription(), nil
+}
+
+func (f *FakeStreamer) WsL3Serve(symbol string, handler ws.WsL3MsgHandler, errHandler ws.ErrHandler) (ws.Subscription, error) {
+	f.record("WsL3Serve", symbol, handler, errHandler)
+	if f.WsL3ServeFunc != nil {
+		return f.WsL3ServeFunc(symbol, handler, errHandler)
+	}
+	return NewFakeSubscription(), nil
+}
+
+func (f *FakeStreamer) WsTickerServe(symbol string, handler ws.WsTickerMsgHandler, errHandler ws.ErrHandler) (ws.Subscription, error) {
+	f.record("WsTickerServe", symbol, handler, errHandler)
+	if f.WsTickerServeFunc != nil {
+		return f.WsTickerServeFunc(symbol, handler, errHandler)
+	}
+	return NewFakeSubscription(), nil
+}
+
+func (f *FakeStreamer) WsPriceServe(symbol string, granularity ws.Granularity, handler ws.WsPriceMsgHandler, errHandler ws.ErrHandler) (ws.Subscription, error) {
+	f.record("WsPriceServe", symbol, granularity, handler, errHandler)
+	if f.WsPriceServeFunc != nil {
+		return f.WsPriceServeFunc(symbol, granularity, handler, errHandler)
+	}
+	return NewFakeSubscription(), nil
+}